@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+	"cinexus/internal/server/routes"
+	"cinexus/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// auditCmd 表示 emby audit 子命令
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "审计媒体库",
+	Long: `分页遍历 proxy.admin_user_id 可见的媒体库（或 --library 指定的媒体库），检查每个项目：
+  missing-media-info  缺少媒体信息
+  no-path             没有文件路径
+  unmapped            路径不在 proxy.paths 的映射中
+  not-found           115（ck 方案）或 AList 中找不到文件
+  check-failed        检查网盘文件时出错
+  duplicate           多个项目指向同一个文件
+
+ck 方案优先查 pickcode 缓存，未缓存时每个目录列出一次，--no-cloud 跳过网盘检查。
+报告输出到标准输出，进度输出到标准错误。--fix 把缺少媒体信息的项目以低优先级加入任务队列。`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		libraryID, _ := cmd.Flags().GetString("library")
+		types, _ := cmd.Flags().GetString("types")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		all, _ := cmd.Flags().GetBool("all")
+		noCloud, _ := cmd.Flags().GetBool("no-cloud")
+		cloudInterval, _ := cmd.Flags().GetDuration("cloud-interval")
+		pageSize, _ := cmd.Flags().GetInt("page-size")
+		fix, _ := cmd.Flags().GetBool("fix")
+
+		if format != "table" && format != "csv" && format != "json" {
+			exitWithError(fmt.Errorf("--format 必须是 table, csv 或 json 之一"))
+		}
+		if pageSize <= 0 {
+			exitWithError(fmt.Errorf("--page-size 必须大于 0"))
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			exitWithError(fmt.Errorf("加载配置失败: %w", err))
+		}
+
+		log, err := initLogger(cfg)
+		if err != nil {
+			exitWithError(fmt.Errorf("初始化日志失败: %w", err))
+		}
+
+		// pickcode 缓存和任务队列使用同一个数据库
+		if err := storage.InitDB(); err != nil {
+			exitWithError(fmt.Errorf("初始化数据库失败: %w", err))
+		}
+
+		start := time.Now()
+		report, err := routes.AuditLibrary(cfg, log, routes.AuditOptions{
+			LibraryID:     libraryID,
+			Types:         types,
+			PageSize:      pageSize,
+			CheckCloud:    !noCloud,
+			CloudInterval: cloudInterval,
+			Progress: func(library string, scanned, total int) {
+				fmt.Fprintf(os.Stderr, "\r🔍 %s: %d/%d ", library, scanned, total)
+				if scanned >= total {
+					fmt.Fprintln(os.Stderr)
+				}
+			},
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			exitWithError(fmt.Errorf("审计媒体库失败: %w", err))
+		}
+		routes.SortAuditItems(report.Items)
+
+		if !all {
+			items := report.Items[:0:0]
+			for _, item := range report.Items {
+				if len(item.Issues) > 0 {
+					items = append(items, item)
+				}
+			}
+			report.Items = items
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				exitWithError(fmt.Errorf("创建报告文件失败: %w", err))
+			}
+			defer f.Close()
+			w = f
+		}
+
+		switch format {
+		case "json":
+			err = writeAuditJSON(w, report)
+		case "csv":
+			err = writeAuditCSV(w, report.Items)
+		default:
+			writeAuditTable(w, report)
+		}
+		if err != nil {
+			exitWithError(fmt.Errorf("输出报告失败: %w", err))
+		}
+
+		fmt.Fprintf(os.Stderr, "\n📊 审计完成: %d 个媒体库，%d 个项目，耗时: %v\n",
+			report.Libraries, report.Scanned, time.Since(start).Round(time.Second))
+		for _, issue := range routes.AuditIssues {
+			if count := report.Counts[issue]; count > 0 {
+				fmt.Fprintf(os.Stderr, "   %-20s %d\n", issue, count)
+			}
+		}
+
+		if fix {
+			enqueueAuditFixes(cfg, log, report)
+		}
+	},
+}
+
+// writeAuditJSON 输出 JSON 报告
+func writeAuditJSON(w io.Writer, report *routes.AuditReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// writeAuditCSV 输出 CSV 报告，问题之间用分号分隔
+func writeAuditCSV(w io.Writer, items []routes.AuditItem) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"item_id", "name", "type", "library", "path", "cloud_path", "issues", "error"}); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		record := []string{item.ItemID, item.Name, item.Type, item.Library, item.Path, item.CloudPath, joinIssues(item.Issues, ";"), item.Error}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeAuditTable 输出文本表格
+func writeAuditTable(w io.Writer, report *routes.AuditReport) {
+	if len(report.Items) == 0 {
+		fmt.Fprintln(w, "✅ 没有发现问题")
+		return
+	}
+
+	fmt.Fprintf(w, "%-34s %-8s %-32s %s\n", "ItemID", "类型", "问题", "路径")
+	for _, item := range report.Items {
+		issues := joinIssues(item.Issues, ",")
+		if issues == "" {
+			issues = "ok"
+		}
+		line := fmt.Sprintf("%-34s %-8s %-32s %s", item.ItemID, item.Type, issues, item.Path)
+		if item.Error != "" {
+			line += " - " + item.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// enqueueAuditFixes 把缺少媒体信息的项目以低优先级加入任务队列，由服务执行
+// 网盘中找不到的文件需要人工处理，不会自动修复
+func enqueueAuditFixes(cfg *config.Config, log *logger.Logger, report *routes.AuditReport) {
+	var itemIDs []string
+	for _, item := range report.Items {
+		if item.HasIssue(routes.AuditIssueMissingMediaInfo) && !item.HasIssue(routes.AuditIssueNotFound) {
+			itemIDs = append(itemIDs, item.ItemID)
+		}
+	}
+
+	if len(itemIDs) == 0 {
+		fmt.Fprintln(os.Stderr, "📝 没有需要加入队列的项目")
+		return
+	}
+
+	taskQueue, err := storage.OpenTaskQueue(cfg, log)
+	if err != nil {
+		exitWithError(err)
+	}
+
+	added, skipped, err := routes.EnqueueInPages(context.Background(), taskQueue, storage.TaskTypePlaybackInfo, itemIDs, storage.TaskPriorityLow)
+	if err != nil {
+		exitWithError(fmt.Errorf("添加任务失败: %w", err))
+	}
+	fmt.Fprintf(os.Stderr, "✅ 缺少媒体信息的项目已加入队列: 新增 %d 个，已在队列中 %d 个\n", added, skipped)
+}
+
+// joinIssues 拼接审计问题
+func joinIssues(issues []routes.AuditIssue, sep string) string {
+	names := make([]string, len(issues))
+	for i, issue := range issues {
+		names[i] = string(issue)
+	}
+	return strings.Join(names, sep)
+}
+
+func init() {
+	embyCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().String("library", "", "只审计指定 ID 的媒体库")
+	auditCmd.Flags().String("types", "Movie,Episode,Video", "审计的项目类型，逗号分隔")
+	auditCmd.Flags().String("format", "table", "报告格式: table, csv, json")
+	auditCmd.Flags().StringP("output", "o", "", "把报告写入文件，默认输出到标准输出")
+	auditCmd.Flags().Bool("all", false, "报告中包含没有问题的项目")
+	auditCmd.Flags().Bool("no-cloud", false, "不检查文件是否存在于 115 或 AList")
+	auditCmd.Flags().Duration("cloud-interval", time.Second, "两次列出 115 目录的间隔，避免被风控")
+	auditCmd.Flags().Int("page-size", 200, "每页从 Emby 获取的项目数")
+	auditCmd.Flags().Bool("fix", false, "把缺少媒体信息的项目以低优先级加入任务队列")
+}
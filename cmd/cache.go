@@ -0,0 +1,382 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cinexus/internal/server/routes"
+	"cinexus/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd 表示 cache 命令
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "管理缓存",
+}
+
+// cachePickcodeCmd 表示 cache pickcode 子命令
+var cachePickcodeCmd = &cobra.Command{
+	Use:   "pickcode",
+	Short: "管理 pickcode 缓存",
+	Long: `查看和管理 data/storage.db 中的 pickcode 缓存，可以在服务运行时使用。
+路径是 115 中的文件路径，即 Emby 路径按 proxy.paths 的 real 替换后的路径。`,
+}
+
+// cachePickcodeStatsCmd 表示 cache pickcode stats 子命令
+var cachePickcodeStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "pickcode 缓存统计",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		openPickcodeCache()
+
+		count, err := storage.GetPickcodeCacheStats()
+		if err != nil {
+			exitWithError(fmt.Errorf("统计 pickcode 缓存失败: %w", err))
+		}
+		dirs, err := storage.ListPickcodeDirs()
+		if err != nil {
+			exitWithError(fmt.Errorf("统计 pickcode 缓存失败: %w", err))
+		}
+		fmt.Printf("📊 pickcode 缓存: %d 个文件，%d 个目录\n", count, len(dirs))
+
+		crawls, err := storage.ListPickcodeCrawls()
+		if err != nil {
+			exitWithError(fmt.Errorf("获取遍历检查点失败: %w", err))
+		}
+		if len(crawls) == 0 {
+			return
+		}
+
+		fmt.Printf("\n%-10s %-8s %-8s %-10s %-19s %s\n", "状态", "目录", "待列出", "文件", "更新时间", "根目录")
+		for _, crawl := range crawls {
+			fmt.Printf("%-10s %-8d %-8d %-10d %-19s %s\n", crawl.Status, crawl.Dirs, crawl.PendingDirs, crawl.Files,
+				formatTaskTime(&crawl.UpdatedAt), crawl.Root)
+		}
+	},
+}
+
+// cachePickcodeGetCmd 表示 cache pickcode get 子命令
+var cachePickcodeGetCmd = &cobra.Command{
+	Use:   "get <path>",
+	Short: "查询文件的 pickcode",
+	Long:  `查询文件的 pickcode，--json 输出完整的缓存记录，包括文件 ID、大小、SHA1 和所在目录的 CID。`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		openPickcodeCache()
+
+		cache, found := storage.GetPickcodeCache(args[0])
+		if !found {
+			exitWithError(fmt.Errorf("未缓存: %s", args[0]))
+		}
+		if !asJSON {
+			fmt.Println(cache.Pickcode)
+			return
+		}
+		data, _ := json.MarshalIndent(cache, "", "  ")
+		fmt.Println(string(data))
+	},
+}
+
+// cachePickcodeFindCmd 表示 cache pickcode find 子命令
+var cachePickcodeFindCmd = &cobra.Command{
+	Use:   "find",
+	Short: "按 pickcode 或 SHA1 查找缓存的文件",
+	Long: `按 --pickcode 或 --sha1 查找缓存的文件，SHA1 相同的文件会全部列出。
+例如: cinexus cache pickcode find --sha1 0123456789ABCDEF0123456789ABCDEF01234567`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		pickcode, _ := cmd.Flags().GetString("pickcode")
+		sha1, _ := cmd.Flags().GetString("sha1")
+		if (pickcode == "") == (sha1 == "") {
+			exitWithError(fmt.Errorf("必须指定 --pickcode 或 --sha1 中的一个"))
+		}
+		openPickcodeCache()
+
+		var caches []storage.PickcodeCache
+		if pickcode != "" {
+			if cache, found := storage.GetPickcodeCacheByPickcode(pickcode); found {
+				caches = append(caches, *cache)
+			}
+		} else {
+			var err error
+			if caches, err = storage.FindPickcodeCachesBySHA1(sha1); err != nil {
+				exitWithError(fmt.Errorf("查找 pickcode 缓存失败: %w", err))
+			}
+		}
+		if len(caches) == 0 {
+			exitWithError(fmt.Errorf("缓存中没有找到文件"))
+		}
+
+		fmt.Printf("%-20s %-14s %-40s %s\n", "pickcode", "大小", "SHA1", "路径")
+		for _, cache := range caches {
+			fmt.Printf("%-20s %-14d %-40s %s\n", cache.Pickcode, cache.Size, cache.SHA1, cache.FilePath)
+		}
+	},
+}
+
+// cachePickcodeDuplicatesCmd 表示 cache pickcode duplicates 子命令
+var cachePickcodeDuplicatesCmd = &cobra.Command{
+	Use:   "duplicates",
+	Short: "列出 SHA1 相同的文件",
+	Long: `列出缓存中 SHA1 相同的文件，即在 115 中重复上传的文件，按文件大小倒序。
+只有带 SHA1 的缓存参与比较，旧版本写入的缓存可以通过 cinexus cache warm --restart 重新遍历补全。`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		openPickcodeCache()
+
+		duplicates, err := storage.FindDuplicatePickcodeCaches()
+		if err != nil {
+			exitWithError(fmt.Errorf("查找重复文件失败: %w", err))
+		}
+		if len(duplicates) == 0 {
+			fmt.Println("✅ 没有重复的文件")
+			return
+		}
+
+		for _, duplicate := range duplicates {
+			fmt.Printf("%s  %d 字节  %d 个文件\n", duplicate.SHA1, duplicate.Size, len(duplicate.Paths))
+			for _, path := range duplicate.Paths {
+				fmt.Printf("  %s\n", path)
+			}
+		}
+		fmt.Printf("\n📊 共 %d 组重复文件\n", len(duplicates))
+	},
+}
+
+// cachePickcodeDeleteCmd 表示 cache pickcode delete 子命令
+var cachePickcodeDeleteCmd = &cobra.Command{
+	Use:   "delete <path>",
+	Short: "删除文件的 pickcode 缓存",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		openPickcodeCache()
+
+		if _, found := storage.GetPickcodeFromCache(args[0]); !found {
+			exitWithError(fmt.Errorf("未缓存: %s", args[0]))
+		}
+		if err := storage.DeletePickcodeFromCache(args[0]); err != nil {
+			exitWithError(fmt.Errorf("删除 pickcode 缓存失败: %w", err))
+		}
+		fmt.Printf("🧹 已删除 pickcode 缓存: %s\n", args[0])
+	},
+}
+
+// cachePickcodePurgeCmd 表示 cache pickcode purge 子命令
+var cachePickcodePurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "删除目录下的 pickcode 缓存",
+	Long: `删除 --prefix 目录下（包括子目录）的所有 pickcode 缓存。
+例如: cinexus cache pickcode purge --prefix /115/电影`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		prefix, _ := cmd.Flags().GetString("prefix")
+		openPickcodeCache()
+
+		deleted, err := storage.DeletePickcodeByPrefix(prefix)
+		if err != nil {
+			exitWithError(fmt.Errorf("删除 pickcode 缓存失败: %w", err))
+		}
+		fmt.Printf("🧹 已删除 %s 下的 %d 个 pickcode 缓存\n", prefix, deleted)
+	},
+}
+
+// cachePickcodeClearCmd 表示 cache pickcode clear 子命令
+var cachePickcodeClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "清空 pickcode 缓存",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		openPickcodeCache()
+
+		count, err := storage.GetPickcodeCacheStats()
+		if err != nil {
+			exitWithError(fmt.Errorf("统计 pickcode 缓存失败: %w", err))
+		}
+		if err := storage.ClearPickcodeCache(); err != nil {
+			exitWithError(fmt.Errorf("清空 pickcode 缓存失败: %w", err))
+		}
+		fmt.Printf("🧹 已清空 %d 个 pickcode 缓存\n", count)
+	},
+}
+
+// cachePickcodeExportCmd 表示 cache pickcode export 子命令
+var cachePickcodeExportCmd = &cobra.Command{
+	Use:   "export <file.jsonl>",
+	Short: "导出 pickcode 缓存",
+	Long: `把 pickcode 缓存导出为 JSON Lines 文件，每行一个 {"file_path", "pickcode", "updated_at"} 对象，
+文件为 - 时输出到标准输出。导出的文件可以用 import 导入到其他实例，不需要重新列出 115 目录。`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		prefix, _ := cmd.Flags().GetString("prefix")
+		openPickcodeCache()
+
+		var w io.Writer = os.Stdout
+		if args[0] != "-" {
+			f, err := os.Create(args[0])
+			if err != nil {
+				exitWithError(fmt.Errorf("创建导出文件失败: %w", err))
+			}
+			defer f.Close()
+			w = f
+		}
+
+		count, err := storage.ExportPickcodeCache(w, prefix)
+		if err != nil {
+			exitWithError(fmt.Errorf("导出 pickcode 缓存失败: %w", err))
+		}
+		fmt.Fprintf(os.Stderr, "📦 已导出 %d 个 pickcode 缓存\n", count)
+	},
+}
+
+// cachePickcodeImportCmd 表示 cache pickcode import 子命令
+var cachePickcodeImportCmd = &cobra.Command{
+	Use:   "import <file.jsonl>",
+	Short: "导入 pickcode 缓存",
+	Long: `从 export 导出的 JSON Lines 文件导入 pickcode 缓存，文件为 - 时从标准输入读取。
+默认覆盖已存在的缓存，使用 --skip-existing 保留已存在的缓存。`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		skipExisting, _ := cmd.Flags().GetBool("skip-existing")
+		openPickcodeCache()
+
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				exitWithError(fmt.Errorf("打开导入文件失败: %w", err))
+			}
+			defer f.Close()
+			r = f
+		}
+
+		count, err := storage.ImportPickcodeCache(r, !skipExisting)
+		if err != nil {
+			exitWithError(fmt.Errorf("导入 pickcode 缓存失败（已导入 %d 个）: %w", count, err))
+		}
+		fmt.Printf("✅ 已导入 %d 个 pickcode 缓存\n", count)
+	},
+}
+
+// cacheWarmCmd 表示 cache warm 子命令
+var cacheWarmCmd = &cobra.Command{
+	Use:   "warm",
+	Short: "遍历 115 目录树预热 pickcode 缓存",
+	Long: `遍历 115 目录树，把所有文件的 pickcode 写入缓存，播放时不需要再列出目录。
+ck 和 ck+115open 方案通过 Cookie 列出目录，115open 方案通过开放平台 API 列出目录。
+
+--path 可以是 Emby 中的路径（按 proxy.paths 的 real 转换，与播放时查找缓存的路径一致）或 115 中的路径，
+不指定时遍历 proxy.paths 中所有的 real 目录。每列出一个目录保存一次检查点，中断后再次执行会继续遍历，
+--restart 从头开始。--queue 把遍历加入任务队列，由服务以低优先级执行。`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("path")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		restart, _ := cmd.Flags().GetBool("restart")
+		queue, _ := cmd.Flags().GetBool("queue")
+
+		cfg, err := loadConfig()
+		if err != nil {
+			exitWithError(fmt.Errorf("加载配置失败: %w", err))
+		}
+
+		log, err := initLogger(cfg)
+		if err != nil {
+			exitWithError(fmt.Errorf("初始化日志失败: %w", err))
+		}
+
+		if !routes.CrawlEnabled(cfg) {
+			exitWithError(fmt.Errorf("%s 方案不使用 pickcode，只支持 ck、ck+115open 和 115open 方案", cfg.Proxy.Method))
+		}
+
+		roots, err := routes.CrawlRoots(cfg, dir)
+		if err != nil {
+			exitWithError(err)
+		}
+		openPickcodeCache()
+
+		if queue {
+			taskQueue, err := storage.OpenTaskQueue(cfg, log)
+			if err != nil {
+				exitWithError(err)
+			}
+			for _, root := range roots {
+				if restart {
+					if err := storage.DeletePickcodeCrawl(root); err != nil {
+						exitWithError(fmt.Errorf("删除遍历检查点失败: %w", err))
+					}
+				}
+				if err := taskQueue.AddTaskWithPriority(storage.TaskTypeCrawlPickcode, root, nil, storage.TaskPriorityLow); err != nil {
+					exitWithError(fmt.Errorf("添加任务失败: %w", err))
+				}
+				fmt.Printf("✅ 已加入队列: %s\n", root)
+			}
+			return
+		}
+
+		// Ctrl+C 时保存检查点后退出
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		for _, root := range roots {
+			start := time.Now()
+			crawl, err := routes.CrawlPickcodeTree(ctx, cfg, log, root, routes.CrawlOptions{
+				Interval: interval,
+				Restart:  restart,
+				Progress: func(crawl *storage.PickcodeCrawl) {
+					fmt.Fprintf(os.Stderr, "\r🕸️ %s: 已列出 %d 个目录，待列出 %d 个，缓存 %d 个文件 ",
+						root, crawl.Dirs, crawl.PendingDirs, crawl.Files)
+				},
+			})
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				if crawl != nil {
+					fmt.Fprintf(os.Stderr, "⏸️ 已保存检查点，再次执行会从 %d 个待列出的目录继续\n", crawl.PendingDirs)
+				}
+				exitWithError(fmt.Errorf("遍历 %s 失败: %w", root, err))
+			}
+			fmt.Printf("✅ %s 遍历完成: %d 个目录，%d 个文件，耗时: %v\n",
+				root, crawl.Dirs, crawl.Files, time.Since(start).Round(time.Second))
+		}
+	},
+}
+
+// openPickcodeCache 初始化 pickcode 缓存所在的数据库
+func openPickcodeCache() {
+	if err := storage.InitDB(); err != nil {
+		exitWithError(fmt.Errorf("初始化数据库失败: %w", err))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cachePickcodeCmd, cacheWarmCmd)
+	cachePickcodeCmd.AddCommand(cachePickcodeStatsCmd, cachePickcodeGetCmd, cachePickcodeFindCmd,
+		cachePickcodeDuplicatesCmd, cachePickcodeDeleteCmd, cachePickcodePurgeCmd, cachePickcodeClearCmd, cachePickcodeExportCmd, cachePickcodeImportCmd)
+
+	cachePickcodeGetCmd.Flags().Bool("json", false, "输出完整的缓存记录")
+
+	cachePickcodeFindCmd.Flags().String("pickcode", "", "要查找的 pickcode")
+	cachePickcodeFindCmd.Flags().String("sha1", "", "要查找的文件 SHA1，不区分大小写")
+
+	cachePickcodePurgeCmd.Flags().String("prefix", "", "要删除的目录，如 /115/电影")
+	cachePickcodePurgeCmd.MarkFlagRequired("prefix")
+
+	cachePickcodeExportCmd.Flags().String("prefix", "", "只导出指定目录下的缓存")
+
+	cachePickcodeImportCmd.Flags().Bool("skip-existing", false, "保留已存在的缓存，不覆盖")
+
+	cacheWarmCmd.Flags().String("path", "", "要遍历的目录，Emby 或 115 中的路径，默认遍历 proxy.paths 中所有的 real 目录")
+	cacheWarmCmd.Flags().Duration("interval", time.Second, "两次列出 115 目录的间隔，避免被风控")
+	cacheWarmCmd.Flags().Bool("restart", false, "忽略检查点，从根目录重新开始遍历")
+	cacheWarmCmd.Flags().Bool("queue", false, "加入任务队列，由服务以低优先级执行")
+}
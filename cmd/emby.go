@@ -3,16 +3,17 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"cinexus/internal/config"
+	"cinexus/internal/helper"
+	"cinexus/internal/helper/emby"
 	"cinexus/internal/logger"
-	"cinexus/internal/server/routes"
 	"cinexus/internal/storage"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"resty.dev/v3"
 )
 
 // embyCmd 表示 emby 命令
@@ -27,12 +28,22 @@ var embyCmd = &cobra.Command{
 var refreshMediaCmd = &cobra.Command{
 	Use:   "refresh-media [folder-id]",
 	Short: "批量完善文件夹中的媒体信息",
-	Long: `通过Emby文件夹ID，获取文件夹中的所有媒体项目，
-并批量完善其播放信息和元数据。`,
+	Long: `通过Emby文件夹ID，分页获取文件夹中的所有媒体项目，
+并批量完善其播放信息和元数据。
+
+任务加入 data/storage.db 的任务队列后由服务执行，默认为低优先级，受 queue.low_priority_hours 限制。
+可以按类型、路径前缀、加入时间和是否缺少媒体信息过滤项目，--dry-run 只列出将要加入队列的项目。
+--wait 会等待加入队列的任务执行完成并显示进度，需要服务正在运行。`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		folderID := args[0]
 
+		opts, err := refreshMediaOptionsFromFlags(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+
 		// 读取配置
 		cfg, err := loadConfig()
 		if err != nil {
@@ -47,122 +58,255 @@ var refreshMediaCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		// 初始化数据库
-		if err := storage.InitDB(); err != nil {
-			fmt.Fprintf(os.Stderr, "错误: 初始化数据库失败: %v\n", err)
+		// 打开任务队列，任务由服务执行，命令行不启动处理器
+		taskQueue, err := storage.OpenTaskQueue(cfg, log)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 			os.Exit(1)
 		}
 
-		// 创建任务队列
-		playbackCallback := func(itemID string, cfg *config.Config) error {
-			err := routes.GETPlaybackInfo(itemID, cfg)
-			return err
-		}
-		taskQueue := storage.NewPersistentTaskQueue(cfg, log, playbackCallback)
-
-		if err := batchRefreshMedia(folderID, cfg, taskQueue); err != nil {
+		itemIDs, err := batchRefreshMedia(folderID, cfg, taskQueue, opts)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "错误: 批量完善媒体信息失败: %v\n", err)
 			os.Exit(1)
 		}
 
+		if opts.dryRun {
+			fmt.Println("📝 试运行，没有任务加入队列")
+			return
+		}
+
+		if opts.wait && len(itemIDs) > 0 {
+			if cfg.Queue.LowPriorityHours != "" && opts.priority == storage.TaskPriorityLow {
+				fmt.Printf("⚠️  低优先级任务只在 %s 执行，可以使用 --priority normal\n", cfg.Queue.LowPriorityHours)
+			}
+			waitForTasks(taskQueue, itemIDs, opts.startedAt)
+		}
+
 		fmt.Println("✅ 批量完善媒体信息完成!")
 	},
 }
 
-// EmbyFolderItem 定义 Emby 文件夹项目的数据结构
-type EmbyFolderItem struct {
-	Name     string `json:"Name"`
-	ServerId string `json:"ServerId"`
-	Id       string `json:"Id"`
-	IsFolder bool   `json:"IsFolder"`
-	Type     string `json:"Type"`
+// refreshMediaOptions refresh-media 的过滤和执行选项
+type refreshMediaOptions struct {
+	types       string    // 项目类型，逗号分隔，为空时不限制
+	missingOnly bool      // 只处理缺少媒体信息的项目
+	pathPrefix  string    // 只处理路径以此开头的项目
+	since       time.Time // 只处理此时间之后加入媒体库的项目，零值时不限制
+	pageSize    int
+	priority    storage.TaskPriority
+	dryRun      bool
+	wait        bool
+	startedAt   time.Time
 }
 
-// EmbyFolderResponse 定义 Emby 文件夹响应的数据结构
-type EmbyFolderResponse struct {
-	Items            []EmbyFolderItem `json:"Items"`
-	TotalRecordCount int              `json:"TotalRecordCount"`
+// refreshMediaOptionsFromFlags 从命令行参数解析 refresh-media 的选项
+func refreshMediaOptionsFromFlags(cmd *cobra.Command) (*refreshMediaOptions, error) {
+	opts := &refreshMediaOptions{startedAt: time.Now()}
+	opts.types, _ = cmd.Flags().GetString("types")
+	opts.missingOnly, _ = cmd.Flags().GetBool("missing-only")
+	opts.pathPrefix, _ = cmd.Flags().GetString("path-prefix")
+	opts.pageSize, _ = cmd.Flags().GetInt("page-size")
+	opts.dryRun, _ = cmd.Flags().GetBool("dry-run")
+	opts.wait, _ = cmd.Flags().GetBool("wait")
+
+	if opts.pageSize <= 0 {
+		return nil, fmt.Errorf("--page-size 必须大于 0")
+	}
+
+	if since, _ := cmd.Flags().GetString("since"); since != "" {
+		t, err := parseSince(since, opts.startedAt)
+		if err != nil {
+			return nil, err
+		}
+		opts.since = t
+	}
+
+	priority, _ := cmd.Flags().GetString("priority")
+	switch priority {
+	case "low":
+		opts.priority = storage.TaskPriorityLow
+	case "normal":
+		opts.priority = storage.TaskPriorityNormal
+	case "high":
+		opts.priority = storage.TaskPriorityHigh
+	default:
+		return nil, fmt.Errorf("--priority 必须是 low, normal 或 high 之一")
+	}
+
+	return opts, nil
 }
 
-// batchRefreshMedia 批量完善媒体信息
-func batchRefreshMedia(folderID string, cfg *config.Config, taskQueue *storage.PersistentTaskQueue) error {
-	fmt.Printf("🔍 正在获取文件夹 %s 的详情...\n", folderID)
+// parseSince 解析 --since，支持 7d、12h 这样的时长和 2006-01-02 格式的日期
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
 
-	// 获取文件夹中的所有项目
-	items, err := getFolderItems(folderID, cfg)
+	d, err := helper.ParseDuration(value)
 	if err != nil {
-		return fmt.Errorf("获取文件夹详情失败: %w", err)
+		return time.Time{}, fmt.Errorf("--since 必须是 7d、12h 这样的时长或 2006-01-02 格式的日期")
 	}
+	return now.Add(-d), nil
+}
 
-	fmt.Printf("📁 找到 %d 个项目\n", len(items))
+// fields 根据过滤条件返回需要 Emby 额外返回的字段
+func (o *refreshMediaOptions) fields() string {
+	fields := []string{"Path"}
+	if !o.since.IsZero() {
+		fields = append(fields, "DateCreated")
+	}
+	if o.missingOnly {
+		fields = append(fields, "MediaSources")
+	}
+	return strings.Join(fields, ",")
+}
 
-	successCount := 0
-	errorCount := 0
+// match 判断项目是否满足过滤条件，不满足时返回原因
+func (o *refreshMediaOptions) match(item emby.FolderItem) (bool, string) {
+	if item.IsFolder {
+		return false, "文件夹"
+	}
 
-	// 遍历所有项目并添加任务
-	for _, item := range items {
-		// 跳过文件夹类型的项目，只处理媒体文件
-		if item.IsFolder {
-			fmt.Printf("⏭️  跳过文件夹: %s (ID: %s)\n", item.Name, item.Id)
-			continue
+	if o.pathPrefix != "" && !strings.HasPrefix(item.Path, o.pathPrefix) {
+		return false, "路径不匹配"
+	}
+
+	if !o.since.IsZero() {
+		created, err := time.Parse(time.RFC3339Nano, item.DateCreated)
+		if err != nil || created.Before(o.since) {
+			return false, "加入时间较早"
 		}
+	}
 
-		fmt.Printf("🔄 正在完善媒体信息: %s (ID: %s)\n", item.Name, item.Id)
+	if o.missingOnly && len(item.MediaSources) > 0 && !helper.NeedMediaStreams(item.MediaSources[0]) {
+		return false, "已有媒体信息"
+	}
+
+	return true, ""
+}
+
+// batchRefreshMedia 分页获取文件夹中的项目，把满足条件的项目加入队列，返回加入队列或已在队列中的项目 ID
+func batchRefreshMedia(folderID string, cfg *config.Config, taskQueue *storage.PersistentTaskQueue, opts *refreshMediaOptions) ([]string, error) {
+	fmt.Printf("🔍 正在获取文件夹 %s 的详情...\n", folderID)
+
+	client := emby.New(cfg)
+	params := map[string]string{
+		"IsFolder": "false",
+		"Fields":   opts.fields(),
+	}
+	if opts.types != "" {
+		params["IncludeItemTypes"] = opts.types
+	}
+
+	var queued []string
+	scanned, matched, added, skipped := 0, 0, 0, 0
+	filtered := make(map[string]int)
+
+	for start := 0; ; start += opts.pageSize {
+		items, total, err := client.GetFolderItemsPage(folderID, params, start, opts.pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("获取文件夹详情失败: %w", err)
+		}
+		if start == 0 {
+			fmt.Printf("📁 找到 %d 个项目\n", total)
+		}
+
+		var pageIDs []string
+		for _, item := range items {
+			scanned++
+			if ok, reason := opts.match(item); !ok {
+				filtered[reason]++
+				continue
+			}
+
+			matched++
+			if opts.dryRun {
+				fmt.Printf("📝 %s (ID: %s, 类型: %s) %s\n", item.Name, item.Id, item.Type, item.Path)
+				continue
+			}
+			pageIDs = append(pageIDs, item.Id)
+		}
 
-		if err := taskQueue.AddTask(item.Id); err != nil {
-			fmt.Printf("❌ 完善媒体信息失败: %s - %v\n", item.Name, err)
-			errorCount++
-		} else {
-			fmt.Printf("✅ 媒体信息已加入完善队列: %s\n", item.Name)
-			successCount++
+		if len(pageIDs) > 0 {
+			// 批量任务默认使用低优先级，不影响用户即将播放的项目
+			n, s, err := taskQueue.AddTypedTasksWithPriority(storage.TaskTypePlaybackInfo, pageIDs, opts.priority)
+			if err != nil {
+				return nil, fmt.Errorf("添加任务失败: %w", err)
+			}
+			added += n
+			skipped += s
+			queued = append(queued, pageIDs...)
+			fmt.Printf("🔄 已处理 %d/%d 个项目，新加入队列 %d 个\n", scanned, total, added)
 		}
 
-		// 添加小延迟，避免请求过于频繁
-		time.Sleep(100 * time.Millisecond)
+		if len(items) < opts.pageSize || scanned >= total {
+			break
+		}
 	}
 
 	fmt.Printf("\n📊 批量完善媒体信息结果:\n")
-	fmt.Printf("   成功: %d 个媒体项目\n", successCount)
-	fmt.Printf("   失败: %d 个媒体项目\n", errorCount)
-	fmt.Printf("   总计: %d 个项目\n", len(items))
+	fmt.Printf("   扫描: %d 个项目\n", scanned)
+	fmt.Printf("   匹配: %d 个项目\n", matched)
+	for reason, count := range filtered {
+		fmt.Printf("   跳过: %d 个项目（%s）\n", count, reason)
+	}
+	if !opts.dryRun {
+		fmt.Printf("   新加入队列: %d 个\n", added)
+		fmt.Printf("   已在队列中: %d 个\n", skipped)
+	}
 
-	return nil
+	return queued, nil
 }
 
-// getFolderItems 获取文件夹中的所有项目
-func getFolderItems(folderID string, cfg *config.Config) ([]EmbyFolderItem, error) {
-	if cfg.Proxy.AdminUserID == "" {
-		return nil, fmt.Errorf("proxy.admin_user_id 未配置，无法获取文件夹详情")
-	}
+// waitForTasks 等待项目的任务全部执行完成，每 2 秒刷新一次进度条
+func waitForTasks(taskQueue *storage.PersistentTaskQueue, itemIDs []string, since time.Time) {
+	fmt.Println("\n⏳ 等待任务执行完成，按 Ctrl+C 退出（任务会继续由服务执行）")
 
-	client := resty.New()
-	defer client.Close()
+	total := int64(len(itemIDs))
+	for {
+		progress, err := taskQueue.GetTaskProgress(storage.TaskTypePlaybackInfo, itemIDs, since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\n错误: 获取任务进度失败: %v\n", err)
+			os.Exit(1)
+		}
 
-	var folderResp EmbyFolderResponse
-	res, err := client.R().
-		SetQueryParams(map[string]string{
-			"api_key":   cfg.Proxy.APIKey,
-			"ParentId":  folderID,
-			"Recursive": "true",
-		}).
-		SetResult(&folderResp).
-		Get(fmt.Sprintf("%s/emby/Users/%s/Items", cfg.Proxy.URL, cfg.Proxy.AdminUserID))
+		active := progress[storage.TaskStatusPending] + progress[storage.TaskStatusProcessing]
+		completed := progress[storage.TaskStatusCompleted]
+		failed := progress[storage.TaskStatusFailed] + progress[storage.TaskStatusCanceled]
+		done := total - active
 
-	if err != nil {
-		return nil, fmt.Errorf("请求失败: %w", err)
-	}
+		fmt.Printf("\r%s %d/%d 成功 %d 失败 %d 执行中 %d ", progressBar(done, total, 30),
+			done, total, completed, failed, progress[storage.TaskStatusProcessing])
+
+		if active == 0 {
+			fmt.Println()
+			if failed > 0 {
+				fmt.Printf("⚠️  %d 个任务失败，可以执行 cinexus queue list --status failed 查看\n", failed)
+			}
+			return
+		}
 
-	if res.StatusCode() != 200 {
-		return nil, fmt.Errorf("请求失败，状态码: %d - %s", res.StatusCode(), res.String())
+		time.Sleep(2 * time.Second)
 	}
+}
 
-	return folderResp.Items, nil
+// progressBar 生成宽度为 width 的文本进度条
+func progressBar(done, total int64, width int) string {
+	filled := width
+	if total > 0 {
+		filled = int(done * int64(width) / total)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
 }
 
 // loadConfig 加载配置
 func loadConfig() (*config.Config, error) {
 	var cfg config.Config
 
+	// 与服务使用相同的默认值
+	config.SetDefaults()
+
 	// 初始化 Viper 配置
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -187,4 +331,13 @@ func initLogger(cfg *config.Config) (*logger.Logger, error) {
 func init() {
 	rootCmd.AddCommand(embyCmd)
 	embyCmd.AddCommand(refreshMediaCmd)
+
+	refreshMediaCmd.Flags().String("types", "", "只处理指定类型的项目，逗号分隔，如 Movie,Episode")
+	refreshMediaCmd.Flags().Bool("missing-only", false, "只处理缺少媒体信息的项目")
+	refreshMediaCmd.Flags().String("path-prefix", "", "只处理 Emby 中路径以此开头的项目")
+	refreshMediaCmd.Flags().String("since", "", "只处理此后加入媒体库的项目，如 7d、12h 或 2024-01-01")
+	refreshMediaCmd.Flags().Int("page-size", 200, "每页从 Emby 获取的项目数")
+	refreshMediaCmd.Flags().String("priority", "low", "任务优先级: low, normal, high")
+	refreshMediaCmd.Flags().Bool("dry-run", false, "只列出将要加入队列的项目，不添加任务")
+	refreshMediaCmd.Flags().Bool("wait", false, "等待任务执行完成并显示进度，需要服务正在运行")
 }
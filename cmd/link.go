@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/server/routes"
+
+	"github.com/spf13/cobra"
+)
+
+// linkCmd 表示 link 命令
+var linkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "管理直链接口",
+}
+
+// linkSignCmd 表示 link sign 子命令
+var linkSignCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "生成带签名的直链",
+	Long: `使用 link.secret 为 /cinexus-api/115/pick/<pickcode> 或 /cinexus-api/d/<Emby 中的路径> 生成带签名的直链。
+直链不经过 Emby，可以写入 .strm 文件或在 Kodi、Infuse、脚本中使用。
+例如: cinexus link sign --path /media/电影/A/a.mkv --base-url http://192.168.1.2:8080 --expire 0`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		pickcode, _ := cmd.Flags().GetString("pickcode")
+		embyPath, _ := cmd.Flags().GetString("path")
+		baseURL, _ := cmd.Flags().GetString("base-url")
+		if (pickcode == "") == (embyPath == "") {
+			exitWithError(fmt.Errorf("必须指定 --pickcode 或 --path 中的一个"))
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		// 与管理 API 一致，未指定 --expire 时使用 link.expire
+		expire := cfg.Link.Expire
+		if cmd.Flags().Changed("expire") {
+			expire, _ = cmd.Flags().GetInt("expire")
+		}
+		if expire < 0 {
+			exitWithError(fmt.Errorf("--expire 不能小于 0"))
+		}
+		if cfg.Link.Secret == "" {
+			exitWithError(fmt.Errorf("直链接口未启用，请配置 link.secret"))
+		}
+
+		linkPath := routes.PickcodeLinkPath(pickcode)
+		if embyPath != "" {
+			if _, ok := routes.MatchPathConfig(cfg, embyPath); !ok {
+				exitWithError(fmt.Errorf("路径不在 proxy.paths 中: %s", embyPath))
+			}
+			linkPath = routes.EmbyPathLinkPath(embyPath)
+		}
+
+		link, expiresAt := routes.SignLink(cfg.Link.Secret, linkPath, time.Duration(expire)*time.Hour)
+		fmt.Println(strings.TrimRight(baseURL, "/") + link)
+		if expiresAt != nil {
+			fmt.Fprintf(os.Stderr, "⏰ 过期时间: %s\n", expiresAt.Format("2006-01-02 15:04:05"))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(linkCmd)
+	linkCmd.AddCommand(linkSignCmd)
+
+	linkSignCmd.Flags().String("pickcode", "", "115 文件的 pickcode")
+	linkSignCmd.Flags().String("path", "", "Emby 中的文件路径，按 proxy.paths 映射")
+	linkSignCmd.Flags().String("base-url", "", "服务地址，如 http://192.168.1.2:8080，为空时只输出路径")
+	linkSignCmd.Flags().Int("expire", config.DefaultLinkExpire, "有效期，单位：小时，0 为永不过期，默认使用 link.expire")
+}
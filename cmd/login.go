@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"cinexus/internal/config"
+	"cinexus/internal/helper/pan115"
 	"cinexus/internal/logger"
 	"cinexus/internal/storage"
 
@@ -78,7 +79,8 @@ var loginCmd = &cobra.Command{
 	Short: "登录到各种云盘服务",
 	Long: `登录到各种云盘服务。
 支持的服务:
-  115 - 通过115手机客户端扫码登录`,
+  115        - 通过115手机客户端扫码登录（115open）
+  115-cookie - 通过115手机客户端扫码获取 Cookie（ck 方案）`,
 }
 
 // login115Cmd 表示 login 115 子命令
@@ -199,10 +201,107 @@ var login115Cmd = &cobra.Command{
 	},
 }
 
+// login115CookieCmd 表示 login 115-cookie 子命令
+var login115CookieCmd = &cobra.Command{
+	Use:   "115-cookie",
+	Short: "通过115手机客户端扫码获取 Cookie",
+	Long: `通过115手机客户端扫码登录获取 Cookie，供 ck 和 ck+115open 方案使用。
+Cookie 会保存到凭证存储 (data/115_cookie.json)，并优先于配置文件中的 driver115.cookie 使用。
+扫码登录会挤掉同类型客户端的登录状态，建议选择平时不使用的客户端类型。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// 加载配置
+		cfg := config.Load()
+
+		// 初始化日志
+		log := logger.New(cfg.Log)
+
+		appName, _ := cmd.Flags().GetString("app")
+		if appName == "" {
+			appName = cfg.Driver115.App
+		}
+
+		app, err := pan115.ParseLoginApp(appName)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		session, err := pan115.StartQRCodeLogin()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		fmt.Printf("📱 请使用115手机客户端扫描以下二维码 (登录客户端类型: %s):\n", app)
+		fmt.Println()
+
+		qr, err := qrcode.New(session.QrcodeContent, qrcode.Medium)
+		if err != nil {
+			fmt.Printf("❌ 生成二维码错误: %v\n", err)
+			return
+		}
+		qr.DisableBorder = true
+
+		// 显示二维码
+		fmt.Println(qr.ToSmallString(false))
+
+		// 开始轮询二维码状态
+		fmt.Println("⏳ 等待扫码...")
+		scanned := false
+
+		for {
+			status, err := pan115.QRCodeStatus(session)
+			if err != nil {
+				log.Errorf("%v", err)
+				time.Sleep(2 * time.Second)
+				continue
+			}
+
+			log.Debugf("轮询状态: %+v", status)
+
+			switch {
+			case status.IsWaiting():
+			case status.IsScanned():
+				if !scanned {
+					fmt.Println("📲 扫码成功，等待确认...")
+					scanned = true
+				}
+			case status.IsAllowed():
+				fmt.Println("✅ 确认登录成功！")
+
+				cookie, err := pan115.FinishQRCodeLogin(session, app)
+				if err != nil {
+					fmt.Printf("❌ %v\n", err)
+					return
+				}
+
+				fmt.Println("🎉 登录成功！Cookie 已保存")
+				fmt.Printf("   Cookie: %s\n", maskToken(cookie))
+				return
+			case status.IsExpired():
+				fmt.Println("❌ 二维码已过期，请重新尝试")
+				return
+			case status.IsCanceled():
+				fmt.Println("❌ 已取消登录，请重新尝试")
+				return
+			default:
+				fmt.Printf("🔄 未知状态: %d，继续轮询...\n", status.Status)
+			}
+
+			// 避免频繁轮询，稍作延迟
+			time.Sleep(1 * time.Second)
+		}
+	},
+}
+
 func init() {
 	// 将 login 主命令添加到根命令
 	rootCmd.AddCommand(loginCmd)
 
 	// 将 115 子命令添加到 login 命令
 	loginCmd.AddCommand(login115Cmd)
+
+	// 将 115-cookie 子命令添加到 login 命令
+	loginCmd.AddCommand(login115CookieCmd)
+	login115CookieCmd.Flags().String("app", "", "扫码登录的客户端类型: web, android, ios, tv, alipaymini, wechatmini, qandroid (默认使用 driver115.app)")
 }
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+	"cinexus/internal/notify"
+
+	"github.com/spf13/cobra"
+)
+
+// notifyCmd 表示 notify 命令
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "管理通知",
+	Long:  `管理通知渠道的命令。`,
+}
+
+// notifyTestCmd 表示 notify test 子命令
+var notifyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "发送测试通知",
+	Long: `向所有订阅了指定事件的通知渠道发送一条测试通知，用于检查通知配置。
+即使 notify.enabled 为 false 也会发送。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := config.Load()
+		log := logger.New(cfg.Log)
+
+		event, _ := cmd.Flags().GetString("event")
+
+		if len(cfg.Notify.Channels) == 0 {
+			fmt.Println("📝 未配置任何通知渠道")
+			return
+		}
+
+		notifier, err := notify.New(cfg.Notify, log)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 初始化通知失败: %v\n", err)
+			os.Exit(1)
+		}
+
+		err = notifier.Dispatch(notify.Message{
+			Event:   notify.Event(event),
+			Title:   "Cinexus 测试通知",
+			Content: fmt.Sprintf("这是一条 %s 事件的测试通知", event),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 发送测试通知失败: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("✅ 测试通知已发送")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(notifyCmd)
+	notifyCmd.AddCommand(notifyTestCmd)
+
+	notifyTestCmd.Flags().String("event", string(notify.EventTaskFailed), "测试通知的事件类型，只会发送到订阅了该事件的渠道")
+}
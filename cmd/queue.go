@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/helper"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+
+	"github.com/spf13/cobra"
+)
+
+// queueCmd 表示 queue 命令
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "管理任务队列",
+	Long: `查看和管理 data/storage.db 中的任务队列。
+命令只修改数据库中的任务状态，不会执行任务，可以在服务运行时使用，重新排队的任务由服务执行。`,
+}
+
+// queueListCmd 表示 queue list 子命令
+var queueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "列出任务",
+	Long:  `按创建时间倒序列出任务，可以按状态过滤。`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		status, _ := cmd.Flags().GetString("status")
+		limit, _ := cmd.Flags().GetInt("limit")
+		offset, _ := cmd.Flags().GetInt("offset")
+
+		if err := validateTaskStatus(status, true); err != nil {
+			exitWithError(err)
+		}
+
+		taskQueue := openTaskQueue()
+		tasks, total, err := taskQueue.ListTasks(storage.TaskStatus(status), limit, offset)
+		if err != nil {
+			exitWithError(fmt.Errorf("获取任务列表失败: %w", err))
+		}
+
+		if len(tasks) == 0 {
+			fmt.Println("📝 没有任务")
+			return
+		}
+
+		fmt.Printf("%-8s %-18s %-10s %-8s %-5s %-19s %s\n", "ID", "类型", "状态", "优先级", "重试", "更新时间", "ItemID / 错误")
+		for _, task := range tasks {
+			line := fmt.Sprintf("%-8d %-18s %-10s %-8d %-5d %-19s %s",
+				task.ID, task.Type, task.Status, task.Priority, task.Retries,
+				task.UpdatedAt.Format("2006-01-02 15:04:05"), task.ItemID)
+			if task.ErrorMsg != "" {
+				line += " - " + task.ErrorMsg
+			}
+			fmt.Println(line)
+		}
+		fmt.Printf("\n📊 共 %d 个任务，显示 %d-%d\n", total, offset+1, offset+len(tasks))
+	},
+}
+
+// queueShowCmd 表示 queue show 子命令
+var queueShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "查看任务详情",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id := parseTaskIDArg(args[0])
+
+		task, err := openTaskQueue().GetTask(id)
+		if err != nil {
+			exitWithError(fmt.Errorf("任务 %d 不存在", id))
+		}
+
+		fmt.Printf("ID:       %d\n", task.ID)
+		fmt.Printf("类型:     %s\n", task.Type)
+		fmt.Printf("ItemID:   %s\n", task.ItemID)
+		fmt.Printf("状态:     %s\n", task.Status)
+		fmt.Printf("优先级:   %d\n", task.Priority)
+		fmt.Printf("重试次数: %d\n", task.Retries)
+		fmt.Printf("创建时间: %s\n", formatTaskTime(&task.CreatedAt))
+		fmt.Printf("更新时间: %s\n", formatTaskTime(&task.UpdatedAt))
+		fmt.Printf("开始时间: %s\n", formatTaskTime(task.StartedAt))
+		fmt.Printf("完成时间: %s\n", formatTaskTime(task.CompletedAt))
+		fmt.Printf("下次执行: %s\n", formatTaskTime(task.NextRunAt))
+		if task.ErrorMsg != "" {
+			fmt.Printf("错误:     %s\n", task.ErrorMsg)
+		}
+		if task.Payload != "" {
+			var payload any
+			if json.Unmarshal([]byte(task.Payload), &payload) == nil {
+				data, _ := json.MarshalIndent(payload, "", "  ")
+				fmt.Printf("参数:\n%s\n", data)
+			} else {
+				fmt.Printf("参数:     %s\n", task.Payload)
+			}
+		}
+	},
+}
+
+// queueRetryCmd 表示 queue retry 子命令
+var queueRetryCmd = &cobra.Command{
+	Use:   "retry [id]",
+	Short: "重试失败或已取消的任务",
+	Long: `把失败或已取消的任务重新标记为待处理，并清零重试次数。
+使用 --all-failed 重试所有失败的任务。`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		allFailed, _ := cmd.Flags().GetBool("all-failed")
+		if allFailed == (len(args) == 1) {
+			exitWithError(fmt.Errorf("必须指定任务 ID 或 --all-failed 其中之一"))
+		}
+
+		taskQueue := openTaskQueue()
+		if allFailed {
+			count, err := taskQueue.RetryFailedTasks()
+			if err != nil {
+				exitWithError(fmt.Errorf("重试任务失败: %w", err))
+			}
+			fmt.Printf("✅ %d 个失败的任务已重新加入队列\n", count)
+			return
+		}
+
+		id := parseTaskIDArg(args[0])
+		if err := taskQueue.RetryTask(id); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("✅ 任务 %d 已重新加入队列\n", id)
+	},
+}
+
+// queueCancelCmd 表示 queue cancel 子命令
+var queueCancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "取消待处理的任务",
+	Long:  `取消待处理的任务，正在执行的任务无法取消。`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id := parseTaskIDArg(args[0])
+		if err := openTaskQueue().CancelTask(id); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("✅ 任务 %d 已取消\n", id)
+	},
+}
+
+// queuePurgeCmd 表示 queue purge 子命令
+var queuePurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "清理任务",
+	Long: `删除指定状态的任务，可以只删除更新时间早于 --older-than 的任务，不会删除执行中的任务。
+例如: cinexus queue purge --status completed --older-than 7d`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		status, _ := cmd.Flags().GetString("status")
+		olderThanFlag, _ := cmd.Flags().GetString("older-than")
+
+		if err := validateTaskStatus(status, false); err != nil {
+			exitWithError(err)
+		}
+
+		olderThan, err := helper.ParseDuration(olderThanFlag)
+		if err != nil {
+			exitWithError(fmt.Errorf("--older-than 错误: %w", err))
+		}
+		// 为 0 时会删除该状态的所有任务，必须明确不指定 --older-than
+		if olderThanFlag != "" && olderThan <= 0 {
+			exitWithError(fmt.Errorf("--older-than 必须大于 0"))
+		}
+
+		deleted, err := openTaskQueue().PurgeTasks(storage.TaskStatus(status), olderThan)
+		if err != nil {
+			exitWithError(fmt.Errorf("清理任务失败: %w", err))
+		}
+		fmt.Printf("🧹 已删除 %d 个任务\n", deleted)
+	},
+}
+
+// queueStatsCmd 表示 queue stats 子命令
+var queueStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "按类型统计任务数量",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		stats, err := openTaskQueue().GetQueueStatsByType()
+		if err != nil {
+			exitWithError(fmt.Errorf("统计任务失败: %w", err))
+		}
+
+		if len(stats) == 0 {
+			fmt.Println("📝 没有任务")
+			return
+		}
+
+		types := make([]string, 0, len(stats))
+		for taskType := range stats {
+			types = append(types, string(taskType))
+		}
+		sort.Strings(types)
+
+		header := fmt.Sprintf("%-18s", "类型")
+		for _, status := range storage.TaskStatuses {
+			header += fmt.Sprintf(" %10s", status)
+		}
+		fmt.Println(header)
+
+		totals := make(map[storage.TaskStatus]int64)
+		for _, taskType := range types {
+			line := fmt.Sprintf("%-18s", taskType)
+			for _, status := range storage.TaskStatuses {
+				count := stats[storage.TaskType(taskType)][status]
+				totals[status] += count
+				line += fmt.Sprintf(" %10d", count)
+			}
+			fmt.Println(line)
+		}
+
+		line := fmt.Sprintf("%-18s", "合计")
+		for _, status := range storage.TaskStatuses {
+			line += fmt.Sprintf(" %10d", totals[status])
+		}
+		fmt.Println(line)
+	},
+}
+
+// openTaskQueue 打开任务队列，不启动处理器
+func openTaskQueue() *storage.PersistentTaskQueue {
+	cfg := config.Load()
+	taskQueue, err := storage.OpenTaskQueue(cfg, logger.New(cfg.Log))
+	if err != nil {
+		exitWithError(err)
+	}
+	return taskQueue
+}
+
+// validateTaskStatus 检查任务状态参数，allowEmpty 为 true 时允许为空
+func validateTaskStatus(status string, allowEmpty bool) error {
+	if status == "" && allowEmpty {
+		return nil
+	}
+
+	names := make([]string, 0, len(storage.TaskStatuses))
+	for _, s := range storage.TaskStatuses {
+		if string(s) == status {
+			return nil
+		}
+		names = append(names, string(s))
+	}
+	return fmt.Errorf("--status 必须是 %s 之一", strings.Join(names, ", "))
+}
+
+// parseTaskIDArg 解析命令行中的任务 ID
+func parseTaskIDArg(arg string) uint {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		exitWithError(fmt.Errorf("无效的任务 ID: %s", arg))
+	}
+	return uint(id)
+}
+
+// formatTaskTime 格式化任务时间，为空时显示 -
+func formatTaskTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// exitWithError 输出错误并退出
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+	os.Exit(1)
+}
+
+func init() {
+	rootCmd.AddCommand(queueCmd)
+	queueCmd.AddCommand(queueListCmd, queueShowCmd, queueRetryCmd, queueCancelCmd, queuePurgeCmd, queueStatsCmd)
+
+	queueListCmd.Flags().String("status", "", "只列出指定状态的任务: pending, processing, completed, failed, canceled")
+	queueListCmd.Flags().Int("limit", 50, "最多列出的任务数")
+	queueListCmd.Flags().Int("offset", 0, "跳过的任务数")
+
+	queueRetryCmd.Flags().Bool("all-failed", false, "重试所有失败的任务")
+
+	queuePurgeCmd.Flags().String("status", "", "要删除的任务状态: pending, completed, failed, canceled")
+	queuePurgeCmd.Flags().String("older-than", "", "只删除更新时间早于该时长的任务，如 7d、12h")
+	queuePurgeCmd.MarkFlagRequired("status")
+}
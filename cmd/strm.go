@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cinexus/internal/server/routes"
+
+	"github.com/spf13/cobra"
+)
+
+// strmCmd 表示 strm 命令
+var strmCmd = &cobra.Command{
+	Use:   "strm",
+	Short: "管理 STRM 媒体库",
+}
+
+// strmGenerateCmd 表示 strm generate 子命令
+var strmGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "从 115 或 AList 目录树生成 STRM 媒体库",
+	Long: `遍历 115 或 AList 中的 --source 目录，在 --out 中为每个视频生成 .strm，并复制 nfo、图片和字幕等附属文件。
+.strm 中是带签名的直链，Emby 扫描 --out 不需要访问网盘，播放时由 cinexus 直接 302 到下载地址。
+
+默认按 proxy.method 列出 115 目录并使用 pickcode 直链，--alist 通过 AList 列出目录并使用 path 直链。
+path 直链按 proxy.paths 把源路径转换为 Emby 中的路径（115 路径按 real，AList 路径按 new），文件被移动后仍然有效。
+
+再次执行时只写入有变化的文件，并删除源目录中已不存在的文件生成的 .strm 和附属文件，--out 中的其他文件不会被删除。
+例如: cinexus strm generate --source /115/电影 --out /media/strm/电影 --base-url http://192.168.1.2:8080`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		source, _ := cmd.Flags().GetString("source")
+		out, _ := cmd.Flags().GetString("out")
+		baseURL, _ := cmd.Flags().GetString("base-url")
+		fromAList, _ := cmd.Flags().GetBool("alist")
+		mode, _ := cmd.Flags().GetString("mode")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		sidecarMaxSize, _ := cmd.Flags().GetInt64("sidecar-max-size")
+		noPrune, _ := cmd.Flags().GetBool("no-prune")
+		pruneSidecars, _ := cmd.Flags().GetBool("prune-sidecars")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		cfg, err := loadConfig()
+		if err != nil {
+			exitWithError(fmt.Errorf("加载配置失败: %w", err))
+		}
+
+		log, err := initLogger(cfg)
+		if err != nil {
+			exitWithError(fmt.Errorf("初始化日志失败: %w", err))
+		}
+		openPickcodeCache()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		start := time.Now()
+		result, err := routes.GenerateStrm(ctx, cfg, log, routes.StrmOptions{
+			Source:         source,
+			Out:            out,
+			AList:          fromAList,
+			Mode:           mode,
+			BaseURL:        baseURL,
+			Interval:       interval,
+			SidecarMaxSize: sidecarMaxSize << 20,
+			Prune:          !noPrune,
+			PruneSidecars:  pruneSidecars,
+			DryRun:         dryRun,
+			Progress: func(result *routes.StrmResult, dir string) {
+				fmt.Fprintf(os.Stderr, "\r📼 已列出 %d 个目录，写入 %d 个 .strm，复制 %d 个附属文件 ",
+					result.Dirs, result.Strm, result.Sidecars)
+			},
+		})
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			exitWithError(fmt.Errorf("生成 STRM 媒体库失败: %w", err))
+		}
+
+		if dryRun {
+			fmt.Println("🔍 试运行，没有写入和删除文件")
+		}
+		fmt.Printf("✅ 生成完成: %d 个目录，写入 %d 个 .strm，复制 %d 个附属文件，%d 个没有变化，删除 %d 个，耗时: %v\n",
+			result.Dirs, result.Strm, result.Sidecars, result.Unchanged, result.Removed, time.Since(start).Round(time.Second))
+		if result.Failed > 0 {
+			fmt.Printf("⚠️ %d 个附属文件复制失败，详见日志，再次执行会重试\n", result.Failed)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(strmCmd)
+	strmCmd.AddCommand(strmGenerateCmd)
+
+	strmGenerateCmd.Flags().String("source", "", "115 或 AList 中的源目录，如 /115/电影")
+	strmGenerateCmd.Flags().String("out", "", "输出目录，只存放该源目录生成的文件")
+	strmGenerateCmd.Flags().String("base-url", "", "写入 .strm 的服务地址，如 http://192.168.1.2:8080")
+	strmGenerateCmd.Flags().Bool("alist", false, "通过 AList 列出源目录")
+	strmGenerateCmd.Flags().String("mode", "", "直链方式 pickcode 或 path，默认 115 使用 pickcode，AList 使用 path")
+	strmGenerateCmd.Flags().Duration("interval", time.Second, "两次列出目录的间隔，避免被风控")
+	strmGenerateCmd.Flags().Int64("sidecar-max-size", 20, "附属文件的最大大小，单位：MB，0 为不限制")
+	strmGenerateCmd.Flags().Bool("no-prune", false, "不删除源目录中已不存在的文件生成的 .strm")
+	strmGenerateCmd.Flags().Bool("prune-sidecars", false, "同时删除源目录中已不存在的附属文件，Emby 或刮削器保存到输出目录的 nfo 和图片也会被删除")
+	strmGenerateCmd.Flags().Bool("dry-run", false, "只统计，不写入和删除文件")
+	strmGenerateCmd.MarkFlagRequired("source")
+	strmGenerateCmd.MarkFlagRequired("out")
+	strmGenerateCmd.MarkFlagRequired("base-url")
+}
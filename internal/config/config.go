@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"log"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -17,6 +20,12 @@ type Config struct {
 	Driver115   Driver115Config    `mapstructure:"driver115"`
 	Open115     Open115Config      `mapstructure:"open115"`
 	FileWatcher FileWatcherConfigs `mapstructure:"file_watcher"`
+	Notify      NotifyConfig       `mapstructure:"notify"`
+	Admin       AdminConfig        `mapstructure:"admin"`
+	Webhook     WebhookConfig      `mapstructure:"webhook"`
+	Link        LinkConfig         `mapstructure:"link"`
+	Queue       QueueConfig        `mapstructure:"queue"`
+	Scheduler   SchedulerConfig    `mapstructure:"scheduler"`
 }
 
 // ServerConfig 保存服务器配置
@@ -28,21 +37,83 @@ type ServerConfig struct {
 
 // ProxyConfig 保存代理配置
 type ProxyConfig struct {
-	URL              string `mapstructure:"url"`                 // 代理目标 URL
-	APIKey           string `mapstructure:"api_key"`             // API 密钥
-	CacheTime        int    `mapstructure:"cache_time"`          // 缓存直链时间，单位：分钟
-	CachePickcode    bool   `mapstructure:"cache_pickcode"`      // 缓存 pickcode 到 sqlite 数据库，提高服务速度
-	AddMetadata      bool   `mapstructure:"add_metadata"`        // 补充元数据
-	Method           string `mapstructure:"method"`              // alist, 115open
-	Paths            []Path `mapstructure:"paths"`               // 路径映射
-	AdminUserID      string `mapstructure:"admin_user_id"`       // EMBY 管理员用户 ID
-	AddNextMediaInfo bool   `mapstructure:"add_next_media_info"` // 播放时提前获取下一集的媒体信息，提高播放速度
+	URL              string    `mapstructure:"url"`                 // 代理目标 URL
+	APIKey           string    `mapstructure:"api_key"`             // API 密钥
+	CacheTime        int       `mapstructure:"cache_time"`          // 缓存直链时间，单位：分钟
+	CachePickcode    bool      `mapstructure:"cache_pickcode"`      // 缓存 pickcode 到 sqlite 数据库，提高服务速度
+	AddMetadata      bool      `mapstructure:"add_metadata"`        // 补充元数据
+	Method           string    `mapstructure:"method"`              // alist, 115open
+	Paths            []Path    `mapstructure:"paths"`               // 路径映射
+	AdminUserID      string    `mapstructure:"admin_user_id"`       // EMBY 管理员用户 ID
+	AddNextMediaInfo bool      `mapstructure:"add_next_media_info"` // 播放时提前获取下一集的媒体信息，提高播放速度
+	URLRules         []URLRule `mapstructure:"url_rules"`           // .strm 等路径为链接的媒体的改写规则
+	URLRedirect      bool      `mapstructure:"url_redirect"`        // 没有匹配规则的链接直接 302 到链接本身，关闭时交给 Emby 处理
+	LocalRoot        string    `mapstructure:"local_root"`          // 本机文件的根目录，resolver 为 local 的路径映射只能访问其中的文件
 }
 
 type Path struct {
-	Old  string `mapstructure:"old"`
-	New  string `mapstructure:"new"`
-	Real string `mapstructure:"real"`
+	Old      string `mapstructure:"old"`
+	New      string `mapstructure:"new"`
+	Real     string `mapstructure:"real"`
+	Resolver string `mapstructure:"resolver"` // 为空时按 proxy.method 302，local 时 new 为本机路径，由本服务直接提供文件
+}
+
+// PathResolverLocal 路径映射到本机文件，不经过网盘和 Emby
+const PathResolverLocal = "local"
+
+// Validate 验证路径映射，本机路径必须在 root 中
+func (p Path) Validate(root string) error {
+	switch p.Resolver {
+	case "":
+		return nil
+	case PathResolverLocal:
+		if root == "" {
+			return fmt.Errorf("使用 local 时必须配置 proxy.local_root")
+		}
+		if !filepath.IsAbs(p.New) {
+			return fmt.Errorf("local 的 new 必须是绝对路径")
+		}
+		rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(p.New))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("local 的 new 必须在 proxy.local_root 中")
+		}
+		return nil
+	default:
+		return fmt.Errorf("resolver 只能为空或 local")
+	}
+}
+
+// URLRule 按正则匹配路径为链接的媒体，改写后交给指定的解析方式
+type URLRule struct {
+	Name     string `mapstructure:"name"`
+	Match    string `mapstructure:"match"`    // 匹配完整链接的正则
+	Resolver string `mapstructure:"resolver"` // alist, pickcode, path 或 url
+	Template string `mapstructure:"template"` // 改写模板，可以用 $1、${name} 引用正则中的分组，为空时使用完整链接
+	Follow   bool   `mapstructure:"follow"`   // url 方式通过 HEAD 请求跟随重定向，302 到最终地址
+}
+
+// URL 规则的解析方式
+const (
+	URLResolverAList    = "alist"    // 改写为 AList 中的路径或 AList/OpenList 的 /d 链接，获取其 302 地址
+	URLResolverPickcode = "pickcode" // 改写为 115 pickcode
+	URLResolverPath     = "path"     // 改写为 Emby 中的路径，按 proxy.paths 和 proxy.method 解析
+	URLResolverURL      = "url"      // 改写为链接，直接 302
+)
+
+// Validate 验证规则的正则和解析方式
+func (r URLRule) Validate() error {
+	if r.Match == "" {
+		return fmt.Errorf("match 不能为空")
+	}
+	if _, err := regexp.Compile(r.Match); err != nil {
+		return fmt.Errorf("match 不是有效的正则: %w", err)
+	}
+	switch r.Resolver {
+	case URLResolverAList, URLResolverPickcode, URLResolverPath, URLResolverURL:
+		return nil
+	default:
+		return fmt.Errorf("resolver 必须是 alist, pickcode, path 或 url 之一")
+	}
 }
 
 type AlistConfig struct {
@@ -64,7 +135,9 @@ type LogConfig struct {
 }
 
 type Driver115Config struct {
-	Cookie string `mapstructure:"cookie"`
+	Cookie        string `mapstructure:"cookie"`         // 优先使用 cinexus login 115-cookie 保存的 Cookie，未保存时使用该值
+	App           string `mapstructure:"app"`            // 扫码登录默认使用的客户端类型
+	CheckInterval int    `mapstructure:"check_interval"` // Cookie 有效性检查间隔，单位：分钟，0 表示不检查
 }
 
 type Open115Config struct {
@@ -87,12 +160,137 @@ type FileWatcherConfig struct {
 	CopyMode             string   `mapstructure:"copy_mode"`              // 复制模式: copy(复制), move(移动), link(硬链接)
 	CreateDirs           bool     `mapstructure:"create_dirs"`            // 是否自动创建目标目录
 	ProcessExistingFiles bool     `mapstructure:"process_existing_files"` // 是否在启动时处理已存在的文件
+	UseQueue             bool     `mapstructure:"use_queue"`              // 通过持久化任务队列处理文件，失败后自动重试，重启后继续
+}
+
+// AdminConfig 保存管理 API 配置
+type AdminConfig struct {
+	APIKey         string   `mapstructure:"api_key"`          // 管理 API 密钥
+	AllowEmbyAdmin bool     `mapstructure:"allow_emby_admin"` // 允许使用 Emby 管理员的 access token 访问管理 API
+	CORSOrigins    []string `mapstructure:"cors_origins"`     // /cinexus-api 允许跨域访问的来源，为空时不允许跨域
+}
+
+// WebhookConfig 保存 webhook 配置
+type WebhookConfig struct {
+	Secret string `mapstructure:"secret"` // 共享密钥，通过 ?token= 或 X-Cinexus-Signature HMAC 请求头校验，为空时不校验
+}
+
+// LinkConfig 保存直链接口配置
+type LinkConfig struct {
+	Secret string `mapstructure:"secret"` // 签名密钥，为空时不启用 /cinexus-api/115/pick 和 /cinexus-api/d 直链接口
+	Expire int    `mapstructure:"expire"` // 签名的默认有效期，单位：小时，0 为永不过期
+}
+
+// DefaultLinkExpire 未配置 link.expire 时签名的默认有效期，单位：小时
+const DefaultLinkExpire = 24
+
+// QueueConfig 保存任务队列配置
+type QueueConfig struct {
+	Workers     int                        `mapstructure:"workers"`      // 同时执行的任务数
+	Interval    int                        `mapstructure:"interval"`     // 两个任务开始执行的最小间隔，单位：秒，避免请求过于频繁被 115 风控
+	MaxAttempts int                        `mapstructure:"max_attempts"` // 任务类型没有单独设置时的最多执行次数
+	BackoffBase int                        `mapstructure:"backoff_base"` // 失败后第一次重试前的等待时间，之后每次翻倍，单位：秒
+	BackoffMax  int                        `mapstructure:"backoff_max"`  // 重试等待时间的上限，单位：秒
+	Types       map[string]QueueTypeConfig `mapstructure:"types"`        // 按任务类型覆盖的设置，键为任务类型，如 warm-pickcode
+
+	LowPriorityHours string `mapstructure:"low_priority_hours"` // 低优先级任务的执行时段，如 "01:00-08:00"，多个时段用逗号分隔，为空时不限制
+}
+
+// TimeWindow 每天的一个时段，结束时间早于开始时间时跨越午夜，单位：从 00:00 开始的分钟数
+type TimeWindow struct {
+	Start int
+	End   int
+}
+
+// Contains 判断 t 的本地时间是否在时段内
+func (w TimeWindow) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.Start <= w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// ParseTimeWindows 解析 "01:00-08:00,13:00-14:00" 格式的时段
+func ParseTimeWindows(value string) ([]TimeWindow, error) {
+	var windows []TimeWindow
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		start, end, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("时段 %q 格式错误，应为 HH:MM-HH:MM", part)
+		}
+
+		startTime, err := time.Parse("15:04", strings.TrimSpace(start))
+		if err != nil {
+			return nil, fmt.Errorf("时段 %q 的开始时间格式错误: %w", part, err)
+		}
+		endTime, err := time.Parse("15:04", strings.TrimSpace(end))
+		if err != nil {
+			return nil, fmt.Errorf("时段 %q 的结束时间格式错误: %w", part, err)
+		}
+
+		windows = append(windows, TimeWindow{
+			Start: startTime.Hour()*60 + startTime.Minute(),
+			End:   endTime.Hour()*60 + endTime.Minute(),
+		})
+	}
+	return windows, nil
+}
+
+// QueueTypeConfig 保存单个任务类型的队列配置
+type QueueTypeConfig struct {
+	Interval    int `mapstructure:"interval"`     // 同类型任务开始执行的最小间隔，单位：秒，0 表示只受 queue.interval 限制
+	MaxAttempts int `mapstructure:"max_attempts"` // 最多执行次数，0 表示使用任务类型的默认值
+}
+
+// SchedulerConfig 保存定时任务配置，每个定时任务是一个 cron 表达式，为空时不执行该任务
+type SchedulerConfig struct {
+	Enabled          bool   `mapstructure:"enabled"`            // 是否启用定时任务
+	MissingMediaInfo string `mapstructure:"missing_media_info"` // 查找缺少媒体信息的电影和剧集并加入队列
+	PickcodeValidate string `mapstructure:"pickcode_validate"`  // 校验 pickcode 缓存，删除或更新已失效的记录
+	PickcodeVerify   string `mapstructure:"pickcode_verify"`    // 抽样校验最久没有确认过的 pickcode 缓存
+	CookieCheck      string `mapstructure:"cookie_check"`       // 检查 115 Cookie 是否有效
+	Cleanup          string `mapstructure:"cleanup"`            // 清理已完成和失败的旧任务
+}
+
+// NotifyConfig 保存通知配置
+type NotifyConfig struct {
+	Enabled  bool                  `mapstructure:"enabled"`  // 是否启用通知
+	Events   []string              `mapstructure:"events"`   // 触发通知的事件，空表示所有事件
+	Channels []NotifyChannelConfig `mapstructure:"channels"` // 通知渠道
+}
+
+// NotifyChannelConfig 保存单个通知渠道配置
+type NotifyChannelConfig struct {
+	Name         string   `mapstructure:"name"`          // 渠道名称（用于日志标识）
+	Type         string   `mapstructure:"type"`          // webhook, telegram, bark, serverchan, smtp
+	Events       []string `mapstructure:"events"`        // 该渠道接收的事件，空表示使用 notify.events
+	RateLimit    int      `mapstructure:"rate_limit"`    // 每小时最多发送条数，0 表示不限制
+	DedupeWindow int      `mapstructure:"dedupe_window"` // 相同通知的去重时间窗口，单位：分钟，0 表示不去重
+
+	URL       string `mapstructure:"url"`        // webhook 地址，或 telegram/bark/serverchan 的自定义 API 地址
+	BotToken  string `mapstructure:"bot_token"`  // telegram 机器人 token
+	ChatID    string `mapstructure:"chat_id"`    // telegram 会话 ID
+	DeviceKey string `mapstructure:"device_key"` // bark 设备 key
+	SendKey   string `mapstructure:"send_key"`   // serverchan SendKey
+
+	SMTPHost     string   `mapstructure:"smtp_host"`     // SMTP 服务器
+	SMTPPort     int      `mapstructure:"smtp_port"`     // SMTP 端口，465 使用 TLS，其他端口尝试 STARTTLS
+	SMTPUsername string   `mapstructure:"smtp_username"` // SMTP 用户名
+	SMTPPassword string   `mapstructure:"smtp_password"` // SMTP 密码
+	From         string   `mapstructure:"from"`          // 发件人
+	To           []string `mapstructure:"to"`            // 收件人
 }
 
 // Load 从各种来源加载配置
 func Load() *Config {
 	// 设置默认值
-	setDefaults()
+	SetDefaults()
 
 	// 读取配置
 	if err := viper.ReadInConfig(); err != nil {
@@ -131,6 +329,27 @@ func validateConfig(cfg *Config) error {
 		}
 	}
 
+	for i, path := range cfg.Proxy.Paths {
+		if err := path.Validate(cfg.Proxy.LocalRoot); err != nil {
+			return fmt.Errorf("第%d个 proxy.paths 配置错误: %w", i+1, err)
+		}
+	}
+
+	for i, rule := range cfg.Proxy.URLRules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("第%d个 proxy.url_rules 配置错误: %w", i+1, err)
+		}
+	}
+
+	// 验证任务队列配置
+	if cfg.Queue.Workers < 0 || cfg.Queue.Interval < 0 || cfg.Queue.MaxAttempts < 0 ||
+		cfg.Queue.BackoffBase < 0 || cfg.Queue.BackoffMax < 0 {
+		return fmt.Errorf("queue 的配置不能为负数")
+	}
+	if _, err := ParseTimeWindows(cfg.Queue.LowPriorityHours); err != nil {
+		return fmt.Errorf("queue.low_priority_hours 配置错误: %w", err)
+	}
+
 	// 验证文件监控配置
 	if cfg.FileWatcher.Enabled {
 		if len(cfg.FileWatcher.Configs) == 0 {
@@ -153,11 +372,51 @@ func validateConfig(cfg *Config) error {
 		}
 	}
 
+	// 验证通知配置
+	if cfg.Notify.Enabled {
+		for i, channel := range cfg.Notify.Channels {
+			if err := validateNotifyChannel(channel); err != nil {
+				return fmt.Errorf("第%d个通知渠道配置错误: %w", i+1, err)
+			}
+			log.Printf("通知渠道[%s]已启用: %s", channel.Name, channel.Type)
+		}
+	}
+
+	return nil
+}
+
+// validateNotifyChannel 验证单个通知渠道配置
+func validateNotifyChannel(channel NotifyChannelConfig) error {
+	switch channel.Type {
+	case "webhook":
+		if channel.URL == "" {
+			return fmt.Errorf("webhook 渠道的 url 不能为空")
+		}
+	case "telegram":
+		if channel.BotToken == "" || channel.ChatID == "" {
+			return fmt.Errorf("telegram 渠道的 bot_token 和 chat_id 不能为空")
+		}
+	case "bark":
+		if channel.DeviceKey == "" {
+			return fmt.Errorf("bark 渠道的 device_key 不能为空")
+		}
+	case "serverchan":
+		if channel.SendKey == "" {
+			return fmt.Errorf("serverchan 渠道的 send_key 不能为空")
+		}
+	case "smtp":
+		if channel.SMTPHost == "" || channel.From == "" || len(channel.To) == 0 {
+			return fmt.Errorf("smtp 渠道的 smtp_host、from 和 to 不能为空")
+		}
+	default:
+		return fmt.Errorf("type 必须是 webhook, telegram, bark, serverchan 或 smtp 之一")
+	}
+
 	return nil
 }
 
-// setDefaults 设置默认配置值
-func setDefaults() {
+// SetDefaults 设置默认配置值，命令行读取配置前也需要调用
+func SetDefaults() {
 	// 服务器默认值
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.mode", "debug")
@@ -168,11 +427,40 @@ func setDefaults() {
 	viper.SetDefault("proxy.api_key", "")
 	viper.SetDefault("proxy.cache_time", 1)        // 缓存直链时间，单位：小时
 	viper.SetDefault("proxy.cache_pickcode", true) // 默认启用pickcode缓存
+	viper.SetDefault("proxy.url_redirect", true)   // 没有匹配规则的链接直接 302
+
+	// 115 Cookie 默认值
+	viper.SetDefault("driver115.app", "tv")
+	viper.SetDefault("driver115.check_interval", 30)
 
 	// 文件监控默认值
 	viper.SetDefault("file_watcher.enabled", false)
 	viper.SetDefault("file_watcher.configs", []map[string]interface{}{})
 
+	// 管理 API 默认值
+	viper.SetDefault("admin.allow_emby_admin", true)
+
+	// 直链接口默认值
+	viper.SetDefault("link.expire", DefaultLinkExpire)
+
+	// 任务队列默认值
+	viper.SetDefault("queue.workers", 1)
+	viper.SetDefault("queue.interval", 10)
+	viper.SetDefault("queue.max_attempts", 3)
+	viper.SetDefault("queue.backoff_base", 30)
+	viper.SetDefault("queue.backoff_max", 3600)
+
+	// 定时任务默认值
+	viper.SetDefault("scheduler.enabled", false)
+	viper.SetDefault("scheduler.missing_media_info", "0 3 * * *") // 每天 3 点
+	viper.SetDefault("scheduler.pickcode_validate", "0 4 * * 0")  // 每周日 4 点
+	viper.SetDefault("scheduler.pickcode_verify", "@hourly")
+	viper.SetDefault("scheduler.cookie_check", "@every 30m")
+	viper.SetDefault("scheduler.cleanup", "@hourly")
+
+	// 通知默认值
+	viper.SetDefault("notify.enabled", false)
+
 	// 日志默认值
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.format", "text")
@@ -0,0 +1,147 @@
+package cookiechecker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cinexus/internal/helper/pan115"
+	"cinexus/internal/logger"
+	"cinexus/internal/notify"
+)
+
+// CookieChecker 负责定期校验115 Cookie 是否有效
+type CookieChecker struct {
+	logger         *logger.Logger
+	checkInterval  time.Duration
+	fallbackCookie string
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	mu             sync.RWMutex
+	lastValid      bool
+	lastCheckedAt  time.Time
+	warnedAt       time.Time // 播放时已告警过的校验时间，同一次校验结果只告警一次
+}
+
+var defaultChecker *CookieChecker
+
+// SetDefault 设置全局 Cookie 校验器，播放时通过它获取校验结果
+func SetDefault(c *CookieChecker) {
+	defaultChecker = c
+}
+
+// Default 获取全局 Cookie 校验器，未启用校验时返回 nil
+func Default() *CookieChecker {
+	return defaultChecker
+}
+
+// Config 校验器配置
+type Config struct {
+	CheckInterval  time.Duration // 检查间隔，默认30分钟
+	FallbackCookie string        // 凭证存储中没有 Cookie 时使用的 Cookie（配置文件）
+}
+
+// New 创建新的 Cookie 校验器
+func New(logger *logger.Logger, config Config) *CookieChecker {
+	if config.CheckInterval == 0 {
+		config.CheckInterval = 30 * time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &CookieChecker{
+		logger:         logger,
+		checkInterval:  config.CheckInterval,
+		fallbackCookie: config.FallbackCookie,
+		ctx:            ctx,
+		cancel:         cancel,
+		lastValid:      true,
+	}
+}
+
+// Start 启动 Cookie 校验器
+func (c *CookieChecker) Start() {
+	c.wg.Add(1)
+	go c.run()
+	c.logger.Infof("🍪 115 Cookie 校验器已启动，检查间隔: %v", c.checkInterval)
+}
+
+// Stop 停止 Cookie 校验器
+func (c *CookieChecker) Stop() {
+	c.cancel()
+	c.wg.Wait()
+	c.logger.Info("🛑 115 Cookie 校验器已停止")
+}
+
+// IsValid 返回最后一次校验的结果以及校验时间
+func (c *CookieChecker) IsValid() (bool, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastValid, c.lastCheckedAt
+}
+
+// TakeInvalidWarning 最近一次校验失效且还没有告警过时返回校验时间和 true，之后同一次校验结果返回 false
+func (c *CookieChecker) TakeInvalidWarning() (time.Time, bool) {
+	if c == nil {
+		return time.Time{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastValid || c.lastCheckedAt.IsZero() || c.warnedAt.Equal(c.lastCheckedAt) {
+		return time.Time{}, false
+	}
+	c.warnedAt = c.lastCheckedAt
+	return c.lastCheckedAt, true
+}
+
+// run 运行校验器主循环
+func (c *CookieChecker) run() {
+	defer c.wg.Done()
+
+	// 立即执行一次检查
+	c.Check()
+
+	ticker := time.NewTicker(c.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.Check()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Check 立即校验一次 Cookie，返回 Cookie 是否有效
+func (c *CookieChecker) Check() bool {
+	err := pan115.CheckStoredCookie(c.fallbackCookie)
+	c.setResult(err == nil)
+
+	if errors.Is(err, pan115.ErrNoCookie) {
+		c.logger.Warn("⚠️ 未配置 115 Cookie，ck 方案将直接降级，可执行 cinexus login 115-cookie 扫码登录")
+		return false
+	}
+
+	if err != nil {
+		c.logger.Errorf("❌ 115 Cookie 已失效，播放将降级到 115Open/AList 方案，请执行 cinexus login 115-cookie 重新登录: %v", err)
+		notify.Send(notify.EventCookieInvalid, "115 Cookie 已失效", fmt.Sprintf("播放将降级到 115Open/AList 方案，请执行 cinexus login 115-cookie 重新登录: %v", err))
+		return false
+	}
+
+	c.logger.Debug("✅ 115 Cookie 有效")
+	return true
+}
+
+// setResult 记录校验结果
+func (c *CookieChecker) setResult(valid bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastValid = valid
+	c.lastCheckedAt = time.Now()
+}
@@ -1,6 +1,7 @@
 package filewatcher
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +11,8 @@ import (
 	"time"
 
 	"cinexus/internal/config"
+	"cinexus/internal/notify"
+	"cinexus/internal/storage"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/sirupsen/logrus"
@@ -116,6 +119,81 @@ func (m *FileWatcherManager) GetWatcherCount() int {
 	return len(m.watchers)
 }
 
+// GetStatus 获取所有监控器的状态
+func (m *FileWatcherManager) GetStatus() []WatcherStatus {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]WatcherStatus, 0, len(m.watchers))
+	for _, watcher := range m.watchers {
+		statuses = append(statuses, watcher.GetStatus())
+	}
+	return statuses
+}
+
+// CopyFileTaskHandler 任务队列中 copy-file 任务的处理函数，按监控配置复制、移动或链接文件
+func (m *FileWatcherManager) CopyFileTaskHandler() storage.TaskHandler {
+	return storage.TaskHandler{
+		Handle: func(ctx context.Context, task *storage.MediaTask) error {
+			var payload CopyFilePayload
+			if err := task.DecodePayload(&payload); err != nil {
+				return storage.NoRetry(fmt.Errorf("解析任务参数失败: %w", err))
+			}
+
+			fw := m.findWatcher(payload.Watcher)
+			if fw == nil {
+				return storage.NoRetry(fmt.Errorf("文件监控配置 %s 不存在", payload.Watcher))
+			}
+
+			if _, err := os.Stat(payload.Path); os.IsNotExist(err) {
+				return storage.NoRetry(fmt.Errorf("源文件不存在: %s", payload.Path))
+			}
+
+			// 重启后重新执行的任务可能已经处理过
+			if fw.isFileAlreadyProcessed(payload.Path) {
+				return nil
+			}
+
+			err := fw.processFile(payload.Path)
+			fw.recordResult(payload.Path, err)
+			return err
+		},
+		MaxAttempts: 3, // 复制大文件耗时不确定，不设置超时
+	}
+}
+
+// findWatcher 按配置名称查找监控器
+func (m *FileWatcherManager) findWatcher(name string) *FileWatcher {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, watcher := range m.watchers {
+		if watcher.config.Name == name {
+			return watcher
+		}
+	}
+	return nil
+}
+
+// WatcherStatus 单个监控器的运行状态
+type WatcherStatus struct {
+	Name            string    `json:"name"`
+	SourceDir       string    `json:"source_dir"`
+	TargetDir       string    `json:"target_dir"`
+	CopyMode        string    `json:"copy_mode"`
+	Watching        bool      `json:"watching"`
+	ProcessedCount  int64     `json:"processed_count"`
+	ErrorCount      int64     `json:"error_count"`
+	LastFile        string    `json:"last_file,omitempty"`
+	LastProcessedAt time.Time `json:"last_processed_at,omitempty"`
+	LastError       string    `json:"last_error,omitempty"`
+	LastErrorAt     time.Time `json:"last_error_at,omitempty"`
+}
+
 // FileWatcher 单个文件监控器
 type FileWatcher struct {
 	config   *config.FileWatcherConfig
@@ -125,6 +203,9 @@ type FileWatcher struct {
 	wg       sync.WaitGroup
 	watching bool
 	mu       sync.RWMutex
+
+	statsMu sync.Mutex
+	stats   WatcherStatus // 处理统计
 }
 
 // NewFileWatcher 创建新的文件监控器
@@ -211,6 +292,41 @@ func (fw *FileWatcher) Stop() error {
 	return nil
 }
 
+// GetStatus 获取监控器状态
+func (fw *FileWatcher) GetStatus() WatcherStatus {
+	fw.mu.RLock()
+	watching := fw.watching
+	fw.mu.RUnlock()
+
+	fw.statsMu.Lock()
+	defer fw.statsMu.Unlock()
+
+	status := fw.stats
+	status.Name = fw.config.Name
+	status.SourceDir = fw.config.SourceDir
+	status.TargetDir = fw.config.TargetDir
+	status.CopyMode = fw.config.CopyMode
+	status.Watching = watching
+	return status
+}
+
+// recordResult 记录文件处理结果
+func (fw *FileWatcher) recordResult(path string, err error) {
+	fw.statsMu.Lock()
+	defer fw.statsMu.Unlock()
+
+	if err != nil {
+		fw.stats.ErrorCount++
+		fw.stats.LastError = fmt.Sprintf("%s: %v", path, err)
+		fw.stats.LastErrorAt = time.Now()
+		return
+	}
+
+	fw.stats.ProcessedCount++
+	fw.stats.LastFile = path
+	fw.stats.LastProcessedAt = time.Now()
+}
+
 // addWatchPaths 添加监控路径
 func (fw *FileWatcher) addWatchPaths() error {
 	// 添加根目录
@@ -303,8 +419,16 @@ func (fw *FileWatcher) handleEvent(event fsnotify.Event) {
 	}
 
 	// 处理文件
-	if err := fw.processFile(event.Name); err != nil {
+	queued, err := fw.submitFile(event.Name)
+	if queued && err == nil {
+		fw.logger.Infof("监控器[%s]文件已加入任务队列: %s", fw.config.Name, event.Name)
+		return
+	}
+	fw.recordResult(event.Name, err)
+	if err != nil {
 		fw.logger.Errorf("监控器[%s]处理文件失败: %s, 错误: %v", fw.config.Name, event.Name, err)
+		notify.Send(notify.EventFileWatcherError, fmt.Sprintf("文件监控[%s]处理文件失败", fw.config.Name),
+			fmt.Sprintf("文件: %s, 错误: %v", event.Name, err))
 	} else {
 		fw.logger.Infof("监控器[%s]成功处理文件: %s", fw.config.Name, event.Name)
 	}
@@ -359,8 +483,17 @@ func (fw *FileWatcher) processExistingFilesInDir(dirPath string) {
 			}
 
 			// 处理文件
-			if err := fw.processFile(path); err != nil {
+			queued, err := fw.submitFile(path)
+			if queued && err == nil {
+				fw.logger.Infof("监控器[%s]已存在文件已加入任务队列: %s", fw.config.Name, path)
+				processedCount++
+				return nil
+			}
+			fw.recordResult(path, err)
+			if err != nil {
 				fw.logger.Errorf("监控器[%s]处理已存在文件失败: %s, 错误: %v", fw.config.Name, path, err)
+				notify.Send(notify.EventFileWatcherError, fmt.Sprintf("文件监控[%s]处理文件失败", fw.config.Name),
+					fmt.Sprintf("文件: %s, 错误: %v", path, err))
 				errorCount++
 			} else {
 				fw.logger.Infof("监控器[%s]成功处理已存在文件: %s", fw.config.Name, path)
@@ -469,6 +602,31 @@ func (fw *FileWatcher) waitForFileReady(filePath string) error {
 	}
 }
 
+// CopyFilePayload copy-file 任务的参数
+type CopyFilePayload struct {
+	Watcher string `json:"watcher"` // 监控配置名称
+	Path    string `json:"path"`    // 源文件路径
+}
+
+// submitFile 开启 use_queue 时把文件加入任务队列，否则直接处理，返回是否已加入任务队列
+func (fw *FileWatcher) submitFile(sourcePath string) (bool, error) {
+	if !fw.config.UseQueue {
+		return false, fw.processFile(sourcePath)
+	}
+
+	taskQueue := storage.GetTaskQueue()
+	if taskQueue == nil {
+		fw.logger.Warnf("监控器[%s]任务队列未初始化，直接处理文件: %s", fw.config.Name, sourcePath)
+		return false, fw.processFile(sourcePath)
+	}
+
+	err := taskQueue.AddTaskWithPayload(storage.TaskTypeCopyFile, sourcePath, CopyFilePayload{
+		Watcher: fw.config.Name,
+		Path:    sourcePath,
+	})
+	return true, err
+}
+
 // processFile 处理文件（复制/移动/链接）
 func (fw *FileWatcher) processFile(sourcePath string) error {
 	// 计算目标路径
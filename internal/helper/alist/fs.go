@@ -0,0 +1,97 @@
+package alist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotFound AList 中不存在该文件
+var ErrNotFound = errors.New("文件不存在")
+
+// FileInfo AList 返回的文件信息
+type FileInfo struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	IsDir    bool   `json:"is_dir"`
+	Modified string `json:"modified"`
+}
+
+// FsGet 通过 AList 的 /api/fs/get 获取文件信息，文件不存在时返回 ErrNotFound
+func FsGet(baseURL, token, path string) (*FileInfo, error) {
+	var info FileInfo
+	if err := fsRequest(baseURL, token, "/api/fs/get", map[string]any{"path": path}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// fsListPageSize 每次列出目录的数量
+const fsListPageSize = 500
+
+// FsList 通过 AList 的 /api/fs/list 分页列出目录中的所有文件和子目录，目录不存在时返回 ErrNotFound
+func FsList(baseURL, token, path string) ([]FileInfo, error) {
+	var files []FileInfo
+	for page := 1; ; page++ {
+		var data struct {
+			Content []FileInfo `json:"content"`
+			Total   int        `json:"total"`
+		}
+		body := map[string]any{"path": path, "page": page, "per_page": fsListPageSize}
+		if err := fsRequest(baseURL, token, "/api/fs/list", body, &data); err != nil {
+			return nil, err
+		}
+
+		files = append(files, data.Content...)
+		if len(data.Content) == 0 || len(files) >= data.Total {
+			return files, nil
+		}
+	}
+}
+
+// fsRequest 请求 AList 的 /api/fs 接口，把响应中的 data 解析到 out
+func fsRequest(baseURL, token, api string, params map[string]any, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(baseURL, "/")+api, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析 AList 响应失败，状态码: %d: %w", resp.StatusCode, err)
+	}
+
+	if result.Code != 200 {
+		// AList 对不存在的文件返回 code 500，message 包含 not found
+		if strings.Contains(strings.ToLower(result.Message), "not found") {
+			return ErrNotFound
+		}
+		return fmt.Errorf("AList 返回错误: %d %s", result.Code, result.Message)
+	}
+
+	return json.Unmarshal(result.Data, out)
+}
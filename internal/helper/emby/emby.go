@@ -3,6 +3,7 @@ package emby
 import (
 	"cinexus/internal/config"
 	"fmt"
+	"strconv"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -91,6 +92,31 @@ func (c *Client) GetItem(itemID string) (map[string]any, error) {
 	return response, nil
 }
 
+// GetItemPath 获取项目在 Emby 中的文件路径
+func (c *Client) GetItemPath(itemID string) (string, error) {
+	response, err := c.GetItems("", map[string]string{
+		"Ids":    itemID,
+		"Fields": "Path",
+		"Limit":  "1",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	items, ok := response["Items"].([]any)
+	if !ok || len(items) == 0 {
+		return "", fmt.Errorf("项目 %s 不存在", itemID)
+	}
+
+	item, _ := items[0].(map[string]any)
+	path, _ := item["Path"].(string)
+	if path == "" {
+		return "", fmt.Errorf("项目 %s 没有文件路径", itemID)
+	}
+
+	return path, nil
+}
+
 // GetItems 获取项目列表
 func (c *Client) GetItems(parentID string, params map[string]string) (map[string]any, error) {
 	var response map[string]any
@@ -120,6 +146,112 @@ func (c *Client) GetItems(parentID string, params map[string]string) (map[string
 	return response, nil
 }
 
+// FolderItem 文件夹中的项目
+type FolderItem struct {
+	Name         string           `json:"Name"`
+	Id           string           `json:"Id"`
+	IsFolder     bool             `json:"IsFolder"`
+	Type         string           `json:"Type"`
+	Path         string           `json:"Path"`         // 需要在 Fields 中请求 Path
+	DateCreated  string           `json:"DateCreated"`  // 加入媒体库的时间，需要在 Fields 中请求 DateCreated
+	MediaSources []map[string]any `json:"MediaSources"` // 需要在 Fields 中请求 MediaSources
+}
+
+// folderTypes 不能直接播放、需要展开为子项目的类型
+var folderTypes = map[string]bool{
+	"Series":           true,
+	"Season":           true,
+	"BoxSet":           true,
+	"Folder":           true,
+	"CollectionFolder": true,
+}
+
+// IsFolderType 判断项目类型是否为文件夹
+func IsFolderType(itemType string) bool {
+	return folderTypes[itemType]
+}
+
+// folderItemsPageSize 递归获取文件夹中的项目时每页请求的数量
+const folderItemsPageSize = 500
+
+// GetFolderItems 递归获取文件夹中的所有项目，需要配置 proxy.admin_user_id
+func (c *Client) GetFolderItems(folderID string) ([]FolderItem, error) {
+	var all []FolderItem
+
+	for start := 0; ; start += folderItemsPageSize {
+		items, total, err := c.GetFolderItemsPage(folderID, nil, start, folderItemsPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, items...)
+		if len(items) < folderItemsPageSize || len(all) >= total {
+			return all, nil
+		}
+	}
+}
+
+// GetFolderItemsPage 分页递归获取文件夹中的项目，params 为额外的查询参数，如 IncludeItemTypes、Fields
+// 返回当前页的项目和符合条件的项目总数，需要配置 proxy.admin_user_id
+func (c *Client) GetFolderItemsPage(folderID string, params map[string]string, startIndex, limit int) ([]FolderItem, int, error) {
+	if c.config.Proxy.AdminUserID == "" {
+		return nil, 0, fmt.Errorf("proxy.admin_user_id 未配置，无法获取文件夹详情")
+	}
+
+	var response struct {
+		Items            []FolderItem `json:"Items"`
+		TotalRecordCount int          `json:"TotalRecordCount"`
+	}
+
+	req := c.client.R().
+		SetQueryParams(map[string]string{
+			"ParentId":   folderID,
+			"Recursive":  "true",
+			"SortBy":     "SortName",
+			"StartIndex": strconv.Itoa(startIndex),
+			"Limit":      strconv.Itoa(limit),
+		}).
+		SetResult(&response)
+
+	for key, value := range params {
+		req.SetQueryParam(key, value)
+	}
+
+	resp, err := req.Get(fmt.Sprintf("/emby/Users/%s/Items", c.config.Proxy.AdminUserID))
+	if err != nil {
+		return nil, 0, fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, 0, fmt.Errorf("请求失败，状态码: %d - %s", resp.StatusCode(), resp.String())
+	}
+
+	return response.Items, response.TotalRecordCount, nil
+}
+
+// RefreshItem 刷新项目的元数据和图片，不替换已有的元数据
+func (c *Client) RefreshItem(itemID string) error {
+	resp, err := c.client.R().
+		SetQueryParams(map[string]string{
+			"Recursive":           "true",
+			"MetadataRefreshMode": "FullRefresh",
+			"ImageRefreshMode":    "FullRefresh",
+			"ReplaceAllMetadata":  "false",
+			"ReplaceAllImages":    "false",
+		}).
+		Post(fmt.Sprintf("/emby/Items/%s/Refresh", itemID))
+
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.StatusCode() != 204 && resp.StatusCode() != 200 {
+		return fmt.Errorf("请求失败，状态码: %d", resp.StatusCode())
+	}
+
+	return nil
+}
+
 // GetUserViews 获取用户视图
 func (c *Client) GetUserViews(userID string) (map[string]any, error) {
 	var response map[string]any
@@ -139,6 +271,28 @@ func (c *Client) GetUserViews(userID string) (map[string]any, error) {
 	return response, nil
 }
 
+// GetSessions 获取会话列表，activeOnly 为 true 时只返回正在播放的会话
+func (c *Client) GetSessions(activeOnly bool) ([]map[string]any, error) {
+	var response []map[string]any
+
+	req := c.client.R().SetResult(&response)
+	if activeOnly {
+		req.SetQueryParam("IsPlaying", "true")
+	}
+
+	resp, err := req.Get("/emby/Sessions")
+
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("请求失败，状态码: %d", resp.StatusCode())
+	}
+
+	return response, nil
+}
+
 // PostPlaybackStart 发送播放开始事件
 func (c *Client) PostPlaybackStart(data map[string]any) error {
 	resp, err := c.client.R().
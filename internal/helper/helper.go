@@ -3,9 +3,12 @@ package helper
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // 正则表达式用于匹配 Windows 盘符格式
@@ -82,3 +85,35 @@ func Md5CacheKey(data string) string {
 
 	return hashString
 }
+
+// ParseDuration 解析时间长度，在 time.ParseDuration 的基础上支持天 (d)，例如 7d、1d12h，不接受负数
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	var days int
+	if i := strings.Index(s, "d"); i > 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("无效的时间长度: %s", s)
+		}
+		days = n
+		s = s[i+1:]
+	}
+
+	var rest time.Duration
+	if s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时间长度: %w", err)
+		}
+		rest = d
+	}
+
+	if days < 0 || rest < 0 {
+		return 0, fmt.Errorf("时间长度不能为负数")
+	}
+
+	return time.Duration(days)*24*time.Hour + rest, nil
+}
@@ -155,16 +155,19 @@ func GetEmbyItems(itemInfoUri string, itemId string, etag string, mediaSourceId
 		rvt.Protocol = mediaSource["Protocol"].(string)
 		rvt.Path = mediaSource["Path"].(string)
 
-		mediaStreams, exists := mediaSource["MediaStreams"]
-		if !exists || len(mediaStreams.([]any)) == 0 {
-			rvt.NeedAddMediaStreams = true
-		}
-
-		_, exists = mediaSource["Bitrate"]
-		if !exists {
-			rvt.NeedAddMediaStreams = true
-		}
+		rvt.NeedAddMediaStreams = NeedMediaStreams(mediaSource)
 	}
 
 	return rvt, nil
 }
+
+// NeedMediaStreams 判断媒体源是否缺少媒体信息，缺少时需要通过 PlaybackInfo 让 Emby 探测媒体
+func NeedMediaStreams(mediaSource map[string]any) bool {
+	mediaStreams, ok := mediaSource["MediaStreams"].([]any)
+	if !ok || len(mediaStreams) == 0 {
+		return true
+	}
+
+	_, exists := mediaSource["Bitrate"]
+	return !exists
+}
@@ -0,0 +1,112 @@
+package pan115
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"cinexus/internal/storage"
+
+	driver115 "github.com/SheltonZhu/115driver/pkg/driver"
+)
+
+// ErrNoCookie 未配置 115 Cookie
+var ErrNoCookie = errors.New("未配置 115 Cookie")
+
+// LoginApps 支持扫码登录的客户端类型
+var LoginApps = []driver115.LoginApp{
+	driver115.LoginAppWeb,
+	driver115.LoginAppAndroid,
+	driver115.LoginAppIOS,
+	driver115.LoginAppTV,
+	driver115.LoginAppAlipayMini,
+	driver115.LoginAppWechatMini,
+	driver115.LoginQAppAndroid,
+}
+
+// ParseLoginApp 解析客户端类型，为空时使用 tv
+func ParseLoginApp(app string) (driver115.LoginApp, error) {
+	if app == "" {
+		return driver115.LoginAppTV, nil
+	}
+
+	for _, loginApp := range LoginApps {
+		if strings.EqualFold(string(loginApp), app) {
+			return loginApp, nil
+		}
+	}
+
+	names := make([]string, 0, len(LoginApps))
+	for _, loginApp := range LoginApps {
+		names = append(names, string(loginApp))
+	}
+	return "", fmt.Errorf("不支持的客户端类型: %s，可选: %s", app, strings.Join(names, ", "))
+}
+
+// NewClient 通过 Cookie 创建 115 客户端
+func NewClient(cookie string) (*driver115.Pan115Client, error) {
+	cr := &driver115.Credential{}
+	if err := cr.FromCookie(cookie); err != nil {
+		return nil, err
+	}
+
+	return driver115.Defalut().ImportCredential(cr), nil
+}
+
+// CheckCookie 校验 Cookie 是否有效，不会踢掉其他设备的登录
+func CheckCookie(cookie string) error {
+	client, err := NewClient(cookie)
+	if err != nil {
+		return err
+	}
+
+	return client.CookieCheck()
+}
+
+// CheckStoredCookie 校验当前使用的 Cookie 并把结果写入凭证存储，fallback 为配置文件中的 Cookie
+func CheckStoredCookie(fallback string) error {
+	cookie := storage.GetCookie(fallback)
+	if cookie == "" {
+		return ErrNoCookie
+	}
+
+	err := CheckCookie(cookie)
+	if statusErr := storage.UpdateCookieStatus(err == nil, err); statusErr != nil {
+		return fmt.Errorf("保存 Cookie 校验状态失败: %w", statusErr)
+	}
+
+	return err
+}
+
+// StartQRCodeLogin 开始扫码登录会话
+func StartQRCodeLogin() (*driver115.QRCodeSession, error) {
+	session, err := driver115.Defalut().QRCodeStart()
+	if err != nil {
+		return nil, fmt.Errorf("获取登录二维码失败: %w", err)
+	}
+	return session, nil
+}
+
+// QRCodeStatus 查询扫码状态
+func QRCodeStatus(session *driver115.QRCodeSession) (*driver115.QRCodeStatus, error) {
+	status, err := driver115.Defalut().QRCodeStatus(session)
+	if err != nil {
+		return nil, fmt.Errorf("查询扫码状态失败: %w", err)
+	}
+	return status, nil
+}
+
+// FinishQRCodeLogin 在确认登录后换取 Cookie 并保存到凭证存储，返回获取到的 Cookie
+func FinishQRCodeLogin(session *driver115.QRCodeSession, app driver115.LoginApp) (string, error) {
+	cr, err := driver115.Defalut().QRCodeLoginWithApp(session, app)
+	if err != nil {
+		return "", fmt.Errorf("扫码登录失败: %w", err)
+	}
+
+	cookie := cr.Cookie()
+	if err := storage.WriteCookie(cookie, string(app)); err != nil {
+		return "", fmt.Errorf("保存 cookie 失败: %w", err)
+	}
+
+	return cookie, nil
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cinexus/internal/config"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// barkChannel Bark 推送渠道
+type barkChannel struct {
+	client    *resty.Client
+	serverURL string
+	deviceKey string
+}
+
+func newBarkChannel(cfg config.NotifyChannelConfig) *barkChannel {
+	serverURL := cfg.URL
+	if serverURL == "" {
+		serverURL = "https://api.day.app"
+	}
+
+	return &barkChannel{
+		client:    resty.New(),
+		serverURL: strings.TrimRight(serverURL, "/"),
+		deviceKey: cfg.DeviceKey,
+	}
+}
+
+// Send 发送消息
+func (c *barkChannel) Send(ctx context.Context, msg Message) error {
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(map[string]string{
+			"device_key": c.deviceKey,
+			"title":      msg.Title,
+			"body":       msg.Content,
+			"group":      "cinexus",
+		}).
+		SetResult(&result).
+		SetError(&result).
+		Post(c.serverURL + "/push")
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.IsError() || result.Code != 200 {
+		return fmt.Errorf("发送失败，状态码: %d, 错误: %s", resp.StatusCode(), result.Message)
+	}
+
+	return nil
+}
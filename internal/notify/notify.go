@@ -0,0 +1,266 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+)
+
+// Event 通知事件类型
+type Event string
+
+const (
+	EventCookieInvalid      Event = "cookie_invalid"       // 115 Cookie 失效
+	EventResolverFailed     Event = "resolver_failed"      // 直链解析失败，降级到 AList
+	EventTokenRefreshFailed Event = "token_refresh_failed" // 115open token 刷新失败
+	EventTaskFailed         Event = "task_failed"          // 队列任务超过重试次数
+	EventFileWatcherError   Event = "filewatcher_error"    // 文件监控复制失败
+)
+
+// Events 所有支持的通知事件
+var Events = []Event{
+	EventCookieInvalid,
+	EventResolverFailed,
+	EventTokenRefreshFailed,
+	EventTaskFailed,
+	EventFileWatcherError,
+}
+
+// Message 通知消息
+type Message struct {
+	Event   Event     `json:"event"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Time    time.Time `json:"time"`
+}
+
+// Channel 通知渠道
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// sendTimeout 单次发送的超时时间
+const sendTimeout = 15 * time.Second
+
+// channelState 保存渠道及其限流、去重状态
+type channelState struct {
+	name         string
+	channel      Channel
+	events       map[Event]bool
+	rateLimit    int
+	dedupeWindow time.Duration
+
+	mu       sync.Mutex
+	sentAt   []time.Time          // 最近一小时内的发送时间
+	lastSent map[string]time.Time // 去重 key -> 最后发送时间
+}
+
+// Notifier 通知分发器
+type Notifier struct {
+	channels []*channelState
+	log      *logger.Logger
+}
+
+var defaultNotifier *Notifier
+
+// SetDefault 设置全局通知分发器
+func SetDefault(n *Notifier) {
+	defaultNotifier = n
+}
+
+// Send 通过全局通知分发器异步发送通知，未启用通知时不做任何事
+func Send(event Event, title, content string) {
+	n := defaultNotifier
+	if n == nil {
+		return
+	}
+
+	go n.Dispatch(Message{
+		Event:   event,
+		Title:   title,
+		Content: content,
+		Time:    time.Now(),
+	})
+}
+
+// New 根据配置创建通知分发器，notify.events 和 channels[].events 中不支持的事件名会返回错误
+func New(cfg config.NotifyConfig, log *logger.Logger) (*Notifier, error) {
+	n := &Notifier{log: log}
+
+	if _, err := parseEvents(cfg.Events); err != nil {
+		return nil, fmt.Errorf("notify.events 配置错误: %w", err)
+	}
+
+	for i, channelCfg := range cfg.Channels {
+		channel, err := newChannel(channelCfg)
+		if err != nil {
+			return nil, fmt.Errorf("创建第%d个通知渠道失败: %w", i+1, err)
+		}
+
+		events := channelCfg.Events
+		if len(events) == 0 {
+			events = cfg.Events
+		}
+		eventSet, err := parseEvents(events)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个通知渠道的 events 配置错误: %w", i+1, err)
+		}
+
+		name := channelCfg.Name
+		if name == "" {
+			name = channelCfg.Type
+		}
+
+		n.channels = append(n.channels, &channelState{
+			name:         name,
+			channel:      channel,
+			events:       eventSet,
+			rateLimit:    channelCfg.RateLimit,
+			dedupeWindow: time.Duration(channelCfg.DedupeWindow) * time.Minute,
+			lastSent:     make(map[string]time.Time),
+		})
+	}
+
+	return n, nil
+}
+
+// newChannel 根据渠道类型创建通知渠道
+func newChannel(cfg config.NotifyChannelConfig) (Channel, error) {
+	switch cfg.Type {
+	case "webhook":
+		return newWebhookChannel(cfg), nil
+	case "telegram":
+		return newTelegramChannel(cfg), nil
+	case "bark":
+		return newBarkChannel(cfg), nil
+	case "serverchan":
+		return newServerChanChannel(cfg), nil
+	case "smtp":
+		return newSMTPChannel(cfg), nil
+	default:
+		return nil, fmt.Errorf("不支持的通知渠道类型: %s", cfg.Type)
+	}
+}
+
+// parseEvents 把事件列表转换为集合，空列表表示所有事件，不在 Events 中的事件名返回错误
+func parseEvents(events []string) (map[Event]bool, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+
+	set := make(map[Event]bool, len(events))
+	for _, event := range events {
+		if !slices.Contains(Events, Event(event)) {
+			return nil, fmt.Errorf("不支持的通知事件: %s", event)
+		}
+		set[Event(event)] = true
+	}
+	return set, nil
+}
+
+// Dispatch 同步发送通知到所有订阅了该事件的渠道，返回发送失败的错误
+func (n *Notifier) Dispatch(msg Message) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+
+	var errs []error
+	for _, state := range n.channels {
+		if !state.allow(msg) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := state.channel.Send(ctx, msg)
+		cancel()
+
+		if err != nil {
+			// 发送失败时归还限流和去重名额，下一次相同的通知仍会发送
+			state.release(msg)
+			n.log.Warnf("通知渠道[%s]发送失败: %v", state.name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", state.name, err))
+			continue
+		}
+
+		n.log.Debugf("通知渠道[%s]发送成功: %s", state.name, msg.Title)
+	}
+
+	return errors.Join(errs...)
+}
+
+// allow 判断渠道是否需要发送该消息，同时预留限流和去重名额，发送失败时需要调用 release 归还
+func (s *channelState) allow(msg Message) bool {
+	if s.events != nil && !s.events[msg.Event] {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := msg.Time
+
+	// 去重：同一事件同一标题在窗口期内只发送一次
+	key := dedupeKey(msg)
+	if s.dedupeWindow > 0 {
+		if last, ok := s.lastSent[key]; ok && now.Sub(last) < s.dedupeWindow {
+			return false
+		}
+	}
+
+	// 限流：每小时最多发送 rateLimit 条
+	if s.rateLimit > 0 {
+		recent := s.sentAt[:0]
+		for _, t := range s.sentAt {
+			if now.Sub(t) < time.Hour {
+				recent = append(recent, t)
+			}
+		}
+		s.sentAt = recent
+
+		if len(s.sentAt) >= s.rateLimit {
+			return false
+		}
+		s.sentAt = append(s.sentAt, now)
+	}
+
+	if s.dedupeWindow > 0 {
+		// 清理过期的去重记录
+		for k, last := range s.lastSent {
+			if now.Sub(last) >= s.dedupeWindow {
+				delete(s.lastSent, k)
+			}
+		}
+		s.lastSent[key] = now
+	}
+
+	return true
+}
+
+// dedupeKey 去重的 key，同一事件同一标题视为相同的通知
+func dedupeKey(msg Message) string {
+	return string(msg.Event) + "|" + msg.Title
+}
+
+// release 归还 allow 为发送失败的消息预留的限流和去重名额
+func (s *channelState) release(msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rateLimit > 0 {
+		if i := slices.Index(s.sentAt, msg.Time); i >= 0 {
+			s.sentAt = slices.Delete(s.sentAt, i, i+1)
+		}
+	}
+	if s.dedupeWindow > 0 {
+		key := dedupeKey(msg)
+		if last, ok := s.lastSent[key]; ok && last.Equal(msg.Time) {
+			delete(s.lastSent, key)
+		}
+	}
+}
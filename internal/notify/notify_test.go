@@ -0,0 +1,301 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+)
+
+// stubServer 记录收到的请求的本地 HTTP 服务
+type stubServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string][]string // path -> 请求体
+}
+
+func newStubServer(t *testing.T) *stubServer {
+	s := &stubServer{requests: make(map[string][]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.requests[r.URL.Path] = append(s.requests[r.URL.Path], string(body))
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/botTOKEN/sendMessage":
+			w.Write([]byte(`{"ok":true}`))
+		case "/push":
+			w.Write([]byte(`{"code":200,"message":"success"}`))
+		case "/SENDKEY.send":
+			w.Write([]byte(`{"code":0,"message":""}`))
+		case "/webhook":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubServer) bodies(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func newTestLogger() *logger.Logger {
+	return logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+}
+
+func TestDispatchChannels(t *testing.T) {
+	stub := newStubServer(t)
+
+	n, err := New(config.NotifyConfig{
+		Channels: []config.NotifyChannelConfig{
+			{Type: "webhook", URL: stub.URL + "/webhook"},
+			{Type: "telegram", URL: stub.URL, BotToken: "TOKEN", ChatID: "42"},
+			{Type: "bark", URL: stub.URL, DeviceKey: "DEVICE"},
+			{Type: "serverchan", URL: stub.URL, SendKey: "SENDKEY"},
+		},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New 失败: %v", err)
+	}
+
+	msg := Message{Event: EventTaskFailed, Title: "任务失败", Content: "ItemID=1", Time: time.Now()}
+	if err := n.Dispatch(msg); err != nil {
+		t.Fatalf("Dispatch 失败: %v", err)
+	}
+
+	// webhook 发送完整的 JSON 消息
+	webhookBodies := stub.bodies("/webhook")
+	if len(webhookBodies) != 1 {
+		t.Fatalf("webhook 应该收到 1 条消息, 实际: %d", len(webhookBodies))
+	}
+	var received Message
+	if err := json.Unmarshal([]byte(webhookBodies[0]), &received); err != nil {
+		t.Fatalf("解析 webhook 消息失败: %v", err)
+	}
+	if received.Event != EventTaskFailed || received.Title != "任务失败" || received.Content != "ItemID=1" {
+		t.Errorf("webhook 消息不匹配: %+v", received)
+	}
+
+	// telegram 使用 chat_id
+	var telegramBody map[string]string
+	if bodies := stub.bodies("/botTOKEN/sendMessage"); len(bodies) != 1 {
+		t.Fatalf("telegram 应该收到 1 条消息, 实际: %d", len(bodies))
+	} else if err := json.Unmarshal([]byte(bodies[0]), &telegramBody); err != nil || telegramBody["chat_id"] != "42" {
+		t.Errorf("telegram 消息不匹配: %s", bodies[0])
+	}
+
+	// bark 使用 device_key
+	var barkBody map[string]string
+	if bodies := stub.bodies("/push"); len(bodies) != 1 {
+		t.Fatalf("bark 应该收到 1 条消息, 实际: %d", len(bodies))
+	} else if err := json.Unmarshal([]byte(bodies[0]), &barkBody); err != nil || barkBody["device_key"] != "DEVICE" {
+		t.Errorf("bark 消息不匹配: %s", bodies[0])
+	}
+
+	// serverchan 使用表单
+	if bodies := stub.bodies("/SENDKEY.send"); len(bodies) != 1 {
+		t.Fatalf("serverchan 应该收到 1 条消息, 实际: %d", len(bodies))
+	} else if form, err := url.ParseQuery(bodies[0]); err != nil || form.Get("title") != "任务失败" {
+		t.Errorf("serverchan 消息不匹配: %s", bodies[0])
+	}
+}
+
+func TestDispatchEventsDedupeAndRateLimit(t *testing.T) {
+	stub := newStubServer(t)
+
+	n, err := New(config.NotifyConfig{
+		Events: []string{string(EventTaskFailed), string(EventCookieInvalid)},
+		Channels: []config.NotifyChannelConfig{
+			{Type: "webhook", URL: stub.URL + "/webhook", DedupeWindow: 10, RateLimit: 2},
+		},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New 失败: %v", err)
+	}
+
+	now := time.Now()
+
+	// 未订阅的事件不发送
+	n.Dispatch(Message{Event: EventFileWatcherError, Title: "复制失败", Time: now})
+
+	// 相同事件和标题在去重窗口内只发送一次
+	n.Dispatch(Message{Event: EventTaskFailed, Title: "任务失败", Time: now})
+	n.Dispatch(Message{Event: EventTaskFailed, Title: "任务失败", Time: now.Add(time.Minute)})
+
+	// 超过每小时限额后不再发送
+	n.Dispatch(Message{Event: EventCookieInvalid, Title: "Cookie 失效", Time: now.Add(2 * time.Minute)})
+	n.Dispatch(Message{Event: EventTaskFailed, Title: "另一个任务失败", Time: now.Add(3 * time.Minute)})
+
+	if count := len(stub.bodies("/webhook")); count != 2 {
+		t.Fatalf("应该发送 2 条消息, 实际: %d", count)
+	}
+
+	// 去重窗口和限流窗口过后可以再次发送
+	n.Dispatch(Message{Event: EventTaskFailed, Title: "任务失败", Time: now.Add(2 * time.Hour)})
+
+	if count := len(stub.bodies("/webhook")); count != 3 {
+		t.Fatalf("窗口过后应该发送第 3 条消息, 实际: %d", count)
+	}
+}
+
+func TestDispatchError(t *testing.T) {
+	stub := newStubServer(t)
+
+	n, err := New(config.NotifyConfig{
+		Channels: []config.NotifyChannelConfig{
+			{Name: "broken", Type: "webhook", URL: stub.URL + "/not-found"},
+		},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New 失败: %v", err)
+	}
+
+	if err := n.Dispatch(Message{Event: EventTaskFailed, Title: "任务失败"}); err == nil {
+		t.Error("webhook 返回 404 时应该返回错误")
+	}
+}
+
+func TestDispatchFailureKeepsSlot(t *testing.T) {
+	stub := newStubServer(t)
+
+	n, err := New(config.NotifyConfig{
+		Channels: []config.NotifyChannelConfig{
+			{Type: "webhook", URL: stub.URL + "/not-found", DedupeWindow: 10, RateLimit: 1},
+		},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New 失败: %v", err)
+	}
+
+	// 发送失败不占用去重和限流名额，相同的通知会再次发送
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := n.Dispatch(Message{Event: EventTaskFailed, Title: "任务失败", Time: now.Add(time.Duration(i) * time.Minute)}); err == nil {
+			t.Fatal("webhook 返回 404 时应该返回错误")
+		}
+	}
+	if count := len(stub.bodies("/not-found")); count != 3 {
+		t.Errorf("发送失败后应该继续尝试, 实际请求: %d 次", count)
+	}
+}
+
+func TestNewRejectsUnknownEvents(t *testing.T) {
+	_, err := New(config.NotifyConfig{
+		Channels: []config.NotifyChannelConfig{
+			{Type: "webhook", URL: "http://localhost/webhook", Events: []string{string(EventTaskFailed), "task_faild"}},
+		},
+	}, newTestLogger())
+	if err == nil || !strings.Contains(err.Error(), "task_faild") {
+		t.Errorf("channels[].events 中不支持的事件应该返回错误, 实际: %v", err)
+	}
+
+	_, err = New(config.NotifyConfig{Events: []string{"unknown"}}, newTestLogger())
+	if err == nil {
+		t.Error("notify.events 中不支持的事件应该返回错误")
+	}
+}
+
+// serveSMTP 在 listener 上处理一次 SMTP 会话，不支持 STARTTLS 和认证，返回收到的邮件
+func serveSMTP(listener net.Listener) <-chan string {
+	mail := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(mail)
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+		reply("220 localhost ESMTP")
+
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(mail)
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				mail <- data.String()
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return mail
+}
+
+func TestSMTPChannel(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer listener.Close()
+	mail := serveSMTP(listener)
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	n, err := New(config.NotifyConfig{
+		Channels: []config.NotifyChannelConfig{
+			{Type: "smtp", SMTPHost: "127.0.0.1", SMTPPort: port, From: "cinexus@example.com", To: []string{"admin@example.com"}},
+		},
+	}, newTestLogger())
+	if err != nil {
+		t.Fatalf("New 失败: %v", err)
+	}
+
+	if err := n.Dispatch(Message{Event: EventCookieInvalid, Title: "Cookie 失效", Content: "请重新登录"}); err != nil {
+		t.Fatalf("Dispatch 失败: %v", err)
+	}
+
+	select {
+	case data := <-mail:
+		subject := "Subject: =?UTF-8?B?" + base64.StdEncoding.EncodeToString([]byte("Cookie 失效")) + "?="
+		if !strings.Contains(data, subject) || !strings.Contains(data, "To: admin@example.com") {
+			t.Errorf("邮件头不匹配: %s", data)
+		}
+		if !strings.Contains(data, base64.StdEncoding.EncodeToString([]byte("请重新登录"))) {
+			t.Errorf("邮件内容不匹配: %s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP 服务器没有收到邮件")
+	}
+}
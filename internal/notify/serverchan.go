@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cinexus/internal/config"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// serverChanChannel Server酱推送渠道
+type serverChanChannel struct {
+	client  *resty.Client
+	apiURL  string
+	sendKey string
+}
+
+func newServerChanChannel(cfg config.NotifyChannelConfig) *serverChanChannel {
+	apiURL := cfg.URL
+	if apiURL == "" {
+		apiURL = "https://sctapi.ftqq.com"
+	}
+
+	return &serverChanChannel{
+		client:  resty.New(),
+		apiURL:  strings.TrimRight(apiURL, "/"),
+		sendKey: cfg.SendKey,
+	}
+}
+
+// Send 发送消息
+func (c *serverChanChannel) Send(ctx context.Context, msg Message) error {
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetFormData(map[string]string{
+			"title": msg.Title,
+			"desp":  msg.Content,
+		}).
+		SetResult(&result).
+		SetError(&result).
+		Post(fmt.Sprintf("%s/%s.send", c.apiURL, c.sendKey))
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.IsError() || result.Code != 0 {
+		return fmt.Errorf("发送失败，状态码: %d, 错误: %s", resp.StatusCode(), result.Message)
+	}
+
+	return nil
+}
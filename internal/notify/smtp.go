@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinexus/internal/config"
+)
+
+// smtpChannel 邮件渠道
+type smtpChannel struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func newSMTPChannel(cfg config.NotifyChannelConfig) *smtpChannel {
+	port := cfg.SMTPPort
+	if port == 0 {
+		port = 465
+	}
+
+	return &smtpChannel{
+		host:     cfg.SMTPHost,
+		port:     port,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		from:     cfg.From,
+		to:       cfg.To,
+	}
+}
+
+// Send 发送消息
+func (c *smtpChannel) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(c.host, strconv.Itoa(c.port))
+
+	dialer := &net.Dialer{Timeout: sendTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+
+	// 465 端口使用隐式 TLS
+	if c.port == 465 {
+		conn = tls.Client(conn, &tls.Config{ServerName: c.host})
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("创建 SMTP 客户端失败: %w", err)
+	}
+	defer client.Close()
+
+	if c.port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: c.host}); err != nil {
+				return fmt.Errorf("STARTTLS 失败: %w", err)
+			}
+		}
+	}
+
+	if c.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.username, c.password, c.host)); err != nil {
+			return fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+
+	if err := client.Mail(c.from); err != nil {
+		return fmt.Errorf("设置发件人失败: %w", err)
+	}
+	for _, to := range c.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("设置收件人 %s 失败: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	if _, err := w.Write(c.buildMail(msg)); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildMail 构建邮件内容
+func (c *smtpChannel) buildMail(msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + c.from + "\r\n")
+	b.WriteString("To: " + strings.Join(c.to, ", ") + "\r\n")
+	b.WriteString("Subject: =?UTF-8?B?" + base64.StdEncoding.EncodeToString([]byte(msg.Title)) + "?=\r\n")
+	b.WriteString("Date: " + msg.Time.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(base64.StdEncoding.EncodeToString([]byte(msg.Content)))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"cinexus/internal/config"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// telegramChannel Telegram 机器人渠道
+type telegramChannel struct {
+	client   *resty.Client
+	apiURL   string
+	botToken string
+	chatID   string
+}
+
+func newTelegramChannel(cfg config.NotifyChannelConfig) *telegramChannel {
+	apiURL := cfg.URL
+	if apiURL == "" {
+		apiURL = "https://api.telegram.org"
+	}
+
+	return &telegramChannel{
+		client:   resty.New(),
+		apiURL:   strings.TrimRight(apiURL, "/"),
+		botToken: cfg.BotToken,
+		chatID:   cfg.ChatID,
+	}
+}
+
+// Send 发送消息
+func (c *telegramChannel) Send(ctx context.Context, msg Message) error {
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetBody(map[string]string{
+			"chat_id": c.chatID,
+			"text":    fmt.Sprintf("%s\n\n%s", msg.Title, msg.Content),
+		}).
+		SetResult(&result).
+		SetError(&result).
+		Post(fmt.Sprintf("%s/bot%s/sendMessage", c.apiURL, c.botToken))
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.IsError() || !result.OK {
+		return fmt.Errorf("发送失败，状态码: %d, 错误: %s", resp.StatusCode(), result.Description)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"cinexus/internal/config"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// webhookChannel 通用 webhook 渠道，以 JSON POST 发送消息
+type webhookChannel struct {
+	client *resty.Client
+	url    string
+}
+
+func newWebhookChannel(cfg config.NotifyChannelConfig) *webhookChannel {
+	return &webhookChannel{
+		client: resty.New(),
+		url:    cfg.URL,
+	}
+}
+
+// Send 发送消息
+func (c *webhookChannel) Send(ctx context.Context, msg Message) error {
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(msg).
+		Post(c.url)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+
+	if resp.IsError() {
+		return fmt.Errorf("请求失败，状态码: %d, 响应: %s", resp.StatusCode(), resp.String())
+	}
+
+	return nil
+}
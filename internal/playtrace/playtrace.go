@@ -0,0 +1,182 @@
+package playtrace
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Step 解析过程中的一个步骤及其耗时
+type Step struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Trace 单次播放解析的记录
+type Trace struct {
+	ID         uint64        `json:"id"`
+	ItemID     string        `json:"item_id"`
+	Path       string        `json:"path,omitempty"`
+	UserAgent  string        `json:"user_agent,omitempty"`
+	Method     string        `json:"method"`
+	URL        string        `json:"url,omitempty"`
+	Skipped    bool          `json:"skipped"`             // 交给 Emby 处理
+	Fallbacks  []string      `json:"fallbacks,omitempty"` // 降级原因
+	Errors     []string      `json:"errors,omitempty"`
+	Steps      []Step        `json:"steps"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at,omitempty"`
+	Duration   time.Duration `json:"duration"`
+
+	recorder *Recorder
+}
+
+// Recorder 记录进行中和最近完成的播放解析
+type Recorder struct {
+	mu     sync.Mutex
+	nextID uint64
+	size   int
+	active map[uint64]*Trace
+	recent []Trace // 按完成时间从旧到新
+}
+
+// defaultSize 默认保留的最近解析记录数
+const defaultSize = 200
+
+var defaultRecorder = New(defaultSize)
+
+// Default 获取全局记录器
+func Default() *Recorder {
+	return defaultRecorder
+}
+
+// New 创建记录器，size 为保留的最近解析记录数
+func New(size int) *Recorder {
+	if size <= 0 {
+		size = defaultSize
+	}
+
+	return &Recorder{
+		size:   size,
+		active: make(map[uint64]*Trace),
+	}
+}
+
+// Start 开始记录一次播放解析
+func (r *Recorder) Start(itemID, method, userAgent string) *Trace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	t := &Trace{
+		ID:        r.nextID,
+		ItemID:    itemID,
+		Method:    method,
+		UserAgent: userAgent,
+		StartedAt: time.Now(),
+		recorder:  r,
+	}
+	r.active[t.ID] = t
+	return t
+}
+
+// SetPath 记录 Emby 播放路径
+func (t *Trace) SetPath(path string) {
+	if t == nil {
+		return
+	}
+
+	t.recorder.mu.Lock()
+	defer t.recorder.mu.Unlock()
+	t.Path = path
+}
+
+// Step 记录一个步骤的耗时
+func (t *Trace) Step(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+
+	t.recorder.mu.Lock()
+	defer t.recorder.mu.Unlock()
+	t.Steps = append(t.Steps, Step{Name: name, Duration: d})
+}
+
+// Fallback 记录一次降级
+func (t *Trace) Fallback(reason string) {
+	if t == nil {
+		return
+	}
+
+	t.recorder.mu.Lock()
+	defer t.recorder.mu.Unlock()
+	t.Fallbacks = append(t.Fallbacks, reason)
+}
+
+// Error 记录一个错误
+func (t *Trace) Error(err error) {
+	if t == nil || err == nil {
+		return
+	}
+
+	t.recorder.mu.Lock()
+	defer t.recorder.mu.Unlock()
+	t.Errors = append(t.Errors, err.Error())
+}
+
+// Finish 结束记录，url 为解析得到的直链，skipped 表示交给 Emby 处理
+func (t *Trace) Finish(url string, skipped bool) {
+	if t == nil {
+		return
+	}
+
+	r := t.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.active[t.ID]; !ok {
+		return
+	}
+	delete(r.active, t.ID)
+
+	t.URL = url
+	t.Skipped = skipped
+	t.FinishedAt = time.Now()
+	t.Duration = t.FinishedAt.Sub(t.StartedAt)
+
+	r.recent = append(r.recent, t.copy())
+	if len(r.recent) > r.size {
+		r.recent = r.recent[len(r.recent)-r.size:]
+	}
+}
+
+// Snapshot 获取进行中和最近完成的解析记录，均按从新到旧排列
+func (r *Recorder) Snapshot() (active []Trace, recent []Trace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	active = make([]Trace, 0, len(r.active))
+	for _, t := range r.active {
+		c := t.copy()
+		c.Duration = time.Since(t.StartedAt)
+		active = append(active, c)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].ID > active[j].ID })
+
+	recent = make([]Trace, 0, len(r.recent))
+	for i := len(r.recent) - 1; i >= 0; i-- {
+		recent = append(recent, r.recent[i].copy())
+	}
+
+	return active, recent
+}
+
+// copy 复制记录，调用方需持有锁
+func (t *Trace) copy() Trace {
+	c := *t
+	c.Steps = append([]Step(nil), t.Steps...)
+	c.Fallbacks = append([]string(nil), t.Fallbacks...)
+	c.Errors = append([]string(nil), t.Errors...)
+	c.recorder = nil
+	return c
+}
@@ -0,0 +1,68 @@
+package playtrace
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRecorderLifecycle(t *testing.T) {
+	r := New(2)
+
+	first := r.Start("1", "ck", "Infuse")
+	first.SetPath("/media/a.mkv")
+	first.Step("步骤1", time.Millisecond)
+	first.Error(errors.New("boom"))
+	first.Fallback("降级到 AList 302 方案")
+
+	active, recent := r.Snapshot()
+	if len(active) != 1 || len(recent) != 0 {
+		t.Fatalf("expected 1 active and 0 recent, got %d and %d", len(active), len(recent))
+	}
+
+	first.Finish("https://cdn/a", false)
+	// 重复结束不会重复记录
+	first.Finish("https://cdn/a", false)
+
+	active, recent = r.Snapshot()
+	if len(active) != 0 || len(recent) != 1 {
+		t.Fatalf("expected 0 active and 1 recent, got %d and %d", len(active), len(recent))
+	}
+
+	got := recent[0]
+	if got.Path != "/media/a.mkv" || got.URL != "https://cdn/a" || got.Skipped {
+		t.Fatalf("unexpected trace: %+v", got)
+	}
+	if len(got.Steps) != 1 || len(got.Errors) != 1 || len(got.Fallbacks) != 1 {
+		t.Fatalf("unexpected steps, errors or fallbacks: %+v", got)
+	}
+
+	// 快照是副本，之后的修改不影响已取得的结果
+	got.Steps[0].Name = "changed"
+	if _, again := r.Snapshot(); again[0].Steps[0].Name != "步骤1" {
+		t.Fatal("snapshot shares state with recorder")
+	}
+}
+
+func TestRecorderKeepsNewest(t *testing.T) {
+	r := New(2)
+
+	for _, id := range []string{"1", "2", "3"} {
+		r.Start(id, "alist", "").Finish("", true)
+	}
+
+	_, recent := r.Snapshot()
+	if len(recent) != 2 || recent[0].ItemID != "3" || recent[1].ItemID != "2" {
+		t.Fatalf("expected items 3 and 2, got %+v", recent)
+	}
+}
+
+func TestNilTrace(t *testing.T) {
+	var trace *Trace
+
+	trace.SetPath("/media/a.mkv")
+	trace.Step("步骤1", time.Millisecond)
+	trace.Fallback("降级")
+	trace.Error(errors.New("boom"))
+	trace.Finish("", true)
+}
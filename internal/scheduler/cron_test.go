@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleNext(t *testing.T) {
+	// 2024-01-10 是周三
+	base := time.Date(2024, 1, 10, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 10, 10, 31, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, 1, 11, 3, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{"0 4 * * 0", time.Date(2024, 1, 14, 4, 0, 0, 0, time.UTC)},
+		{"0 4 * * 7", time.Date(2024, 1, 14, 4, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2024, 1, 10, 13, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}}, // 2 月没有 31 号
+		{"@hourly", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 30m", base.Add(30 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("%q 解析失败: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q 的下一次执行时间错误, 期望: %v, 实际: %v", tt.expr, tt.want, got)
+		}
+	}
+}
+
+func TestParseScheduleDayOr(t *testing.T) {
+	// 日和周都有限制时满足其一即可：15 号或周一
+	s, err := ParseSchedule("0 0 15 * 1")
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+
+	got := s.Next(time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC))
+	want := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC) // 1 月 15 日既是 15 号也是周一
+	if !got.Equal(want) {
+		t.Errorf("期望: %v, 实际: %v", want, got)
+	}
+
+	got = s.Next(want)
+	want = time.Date(2024, 1, 22, 0, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("期望: %v, 实际: %v", want, got)
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every 10s",
+		"@every abc",
+	} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("%q 应该解析失败", expr)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+)
+
+// ErrJobNotFound 定时任务不存在
+var ErrJobNotFound = errors.New("定时任务不存在")
+
+// JobFunc 定时任务的执行函数，返回执行结果的摘要
+// 耗时较长的工作应该拆分为队列任务，避免长时间占用队列的执行槽位
+type JobFunc func(ctx context.Context) (string, error)
+
+// 定时任务最近一次执行的状态
+const (
+	JobStatusQueued  = "queued"
+	JobStatusRunning = "running"
+	JobStatusSuccess = "success"
+	JobStatusFailed  = "failed"
+)
+
+// JobStatus 定时任务的执行计划和最近一次执行的结果
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	NextRunAt      time.Time  `json:"next_run_at"`
+	LastQueuedAt   *time.Time `json:"last_queued_at,omitempty"`
+	LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt *time.Time `json:"last_finished_at,omitempty"`
+	LastStatus     string     `json:"last_status,omitempty"`
+	LastResult     string     `json:"last_result,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastDuration   string     `json:"last_duration,omitempty"`
+}
+
+// jobPayload 定时任务在队列中的参数
+type jobPayload struct {
+	Job string `json:"job"`
+}
+
+// job 已注册的定时任务
+type job struct {
+	schedule Schedule
+	run      JobFunc
+	status   JobStatus
+}
+
+// Scheduler 按 cron 表达式把定时任务加入持久化任务队列，由队列执行
+type Scheduler struct {
+	queue  *storage.PersistentTaskQueue
+	log    *logger.Logger
+	mu     sync.Mutex
+	jobs   map[string]*job
+	names  []string // 注册顺序
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// New 创建定时任务调度器
+func New(queue *storage.PersistentTaskQueue, log *logger.Logger) *Scheduler {
+	return &Scheduler{
+		queue:  queue,
+		log:    log,
+		jobs:   make(map[string]*job),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Add 注册定时任务，需要在 Start 之前调用
+func (s *Scheduler) Add(name, expr string, run JobFunc) error {
+	schedule, err := ParseSchedule(expr)
+	if err != nil {
+		return fmt.Errorf("定时任务 %s 的表达式 %q 无效: %w", name, expr, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("定时任务 %s 已存在", name)
+	}
+
+	j := &job{
+		schedule: schedule,
+		run:      run,
+		status: JobStatus{
+			Name:      name,
+			Schedule:  expr,
+			NextRunAt: schedule.Next(time.Now()),
+		},
+	}
+	s.restoreStatus(j)
+
+	s.jobs[name] = j
+	s.names = append(s.names, name)
+	return nil
+}
+
+// restoreStatus 从队列中最近一次的任务恢复重启前的执行状态
+func (s *Scheduler) restoreStatus(j *job) {
+	task, err := s.queue.LatestTask(storage.TaskTypeScheduledJob, j.status.Name)
+	if err != nil || task == nil {
+		return
+	}
+
+	queuedAt := task.CreatedAt
+	j.status.LastQueuedAt = &queuedAt
+	j.status.LastStartedAt = task.StartedAt
+	j.status.LastFinishedAt = task.CompletedAt
+	j.status.LastError = task.ErrorMsg
+
+	switch task.Status {
+	case storage.TaskStatusPending, storage.TaskStatusProcessing:
+		j.status.LastStatus = JobStatusQueued
+	case storage.TaskStatusCompleted:
+		j.status.LastStatus = JobStatusSuccess
+	default:
+		j.status.LastStatus = JobStatusFailed
+	}
+}
+
+// Start 启动调度器
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+	s.log.Infof("⏰ 定时任务调度器已启动，共 %d 个定时任务", len(s.names))
+}
+
+// Stop 停止调度器，已加入队列的任务由队列继续执行
+func (s *Scheduler) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+	s.log.Info("🛑 定时任务调度器已停止")
+}
+
+// run 每 15 秒检查一次是否有到期的定时任务
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case now := <-ticker.C:
+			for _, name := range s.dueJobs(now) {
+				if err := s.Trigger(name); err != nil {
+					s.log.Errorf("定时任务 %s 加入队列失败: %v", name, err)
+				}
+			}
+		}
+	}
+}
+
+// dueJobs 返回到期的定时任务，并计算它们的下一次执行时间
+func (s *Scheduler) dueJobs(now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []string
+	for _, name := range s.names {
+		j := s.jobs[name]
+		if j.status.NextRunAt.IsZero() || now.Before(j.status.NextRunAt) {
+			continue
+		}
+		due = append(due, name)
+		j.status.NextRunAt = j.schedule.Next(now)
+	}
+	return due
+}
+
+// Trigger 立即把定时任务加入队列，上一次的任务还未执行时跳过
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	if err := s.queue.AddTaskWithPayload(storage.TaskTypeScheduledJob, name, jobPayload{Job: name}); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	j.status.LastQueuedAt = &now
+	if j.status.LastStatus != JobStatusRunning {
+		j.status.LastStatus = JobStatusQueued
+	}
+	s.mu.Unlock()
+
+	s.log.Infof("⏰ 定时任务 %s 已加入队列", name)
+	return nil
+}
+
+// Status 返回所有定时任务的状态，按注册顺序排列
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.names))
+	for _, name := range s.names {
+		statuses = append(statuses, s.jobs[name].status)
+	}
+	return statuses
+}
+
+// TaskHandler 任务队列中 scheduled-job 任务的处理函数
+// 定时任务会按计划再次执行，失败后不重试
+func (s *Scheduler) TaskHandler() storage.TaskHandler {
+	return storage.TaskHandler{
+		Handle:      s.handle,
+		MaxAttempts: 1,
+		Timeout:     time.Hour,
+	}
+}
+
+// handle 执行队列中的定时任务并记录结果
+func (s *Scheduler) handle(ctx context.Context, task *storage.MediaTask) error {
+	var payload jobPayload
+	if err := task.DecodePayload(&payload); err != nil {
+		return storage.NoRetry(fmt.Errorf("解析任务参数失败: %w", err))
+	}
+
+	s.mu.Lock()
+	j, ok := s.jobs[payload.Job]
+	if ok {
+		startedAt := time.Now()
+		j.status.LastStartedAt = &startedAt
+		j.status.LastStatus = JobStatusRunning
+	}
+	s.mu.Unlock()
+	if !ok {
+		return storage.NoRetry(fmt.Errorf("%w: %s", ErrJobNotFound, payload.Job))
+	}
+
+	start := time.Now()
+	result, err := j.run(ctx)
+	duration := time.Since(start)
+
+	finishedAt := time.Now()
+	s.mu.Lock()
+	j.status.LastFinishedAt = &finishedAt
+	j.status.LastDuration = duration.Round(time.Millisecond).String()
+	j.status.LastResult = result
+	if err != nil {
+		j.status.LastStatus = JobStatusFailed
+		j.status.LastError = err.Error()
+	} else {
+		j.status.LastStatus = JobStatusSuccess
+		j.status.LastError = ""
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	s.log.Infof("✅ 定时任务 %s 执行完成: %s, 耗时: %v", payload.Job, result, duration)
+	return nil
+}
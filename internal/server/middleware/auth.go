@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinexus/internal/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderAPIKey 管理 API 密钥请求头
+const HeaderAPIKey = "X-Cinexus-Key"
+
+// HeaderSignature webhook 签名请求头，值为 sha256=<请求体的 HMAC-SHA256 十六进制>
+const HeaderSignature = "X-Cinexus-Signature"
+
+// AdminAuth 返回校验管理 API 的中间件，接受静态密钥或 Emby 管理员的 access token
+// apiKey 为空且 embyValidator 为 nil 时拒绝所有请求
+func AdminAuth(apiKey string, embyValidator *EmbyAdminValidator, log *logger.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if apiKey == "" && embyValidator == nil {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "管理 API 未启用，请配置 admin.api_key 或开启 admin.allow_emby_admin"})
+			}
+
+			key := requestAPIKey(c)
+			if apiKey != "" && secureEqual(key, apiKey) {
+				return next(c)
+			}
+
+			if embyValidator != nil {
+				// 管理面板只有一个输入框，X-Cinexus-Key 中也可以填写 Emby token
+				token := requestEmbyToken(c)
+				if token == "" {
+					token = key
+				}
+
+				isAdmin, err := embyValidator.IsAdmin(token)
+				if err != nil {
+					log.Warnf("校验 Emby 管理员 token 失败: %v", err)
+					return c.JSON(http.StatusBadGateway, map[string]string{"error": "校验 Emby token 失败"})
+				}
+				if isAdmin {
+					return next(c)
+				}
+			}
+
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "未授权"})
+		}
+	}
+}
+
+// WebhookAuth 返回校验 webhook 共享密钥的中间件，接受 ?token= 或 X-Cinexus-Signature 签名，secret 为空时不校验
+func WebhookAuth(secret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if secret == "" {
+				return next(c)
+			}
+
+			if token := c.QueryParam("token"); token != "" && secureEqual(token, secret) {
+				return next(c)
+			}
+
+			if signature := c.Request().Header.Get(HeaderSignature); signature != "" {
+				body, err := io.ReadAll(c.Request().Body)
+				if err != nil {
+					return c.JSON(http.StatusBadRequest, map[string]string{"error": "读取请求体失败"})
+				}
+				// 还原请求体，供后续处理器读取
+				c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+				if validSignature(secret, body, signature) {
+					return next(c)
+				}
+			}
+
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "未授权"})
+		}
+	}
+}
+
+// SignPath 生成直链路径的 HMAC-SHA256 签名，expires 为过期时间的 Unix 时间戳，0 为永不过期
+func SignPath(secret, path string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyPathSignature 校验链接参数中的 e 和 sign，返回过期时间和签名是否正确，不检查是否已过期
+func VerifyPathSignature(secret, path string, query url.Values) (int64, bool) {
+	expires, err := strconv.ParseInt(query.Get("e"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return expires, secureEqual(query.Get("sign"), SignPath(secret, path, expires))
+}
+
+// SignedURL 返回校验直链签名的中间件，链接需要带 ?e=<过期时间>&sign=<签名>，secret 为空时拒绝所有请求
+// 签名覆盖解码后的请求路径和过期时间，修改其中任意一个都会校验失败
+func SignedURL(secret string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if secret == "" {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "直链接口未启用，请配置 link.secret"})
+			}
+
+			expires, ok := VerifyPathSignature(secret, c.Request().URL.Path, c.QueryParams())
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "签名无效"})
+			}
+			if expires != 0 && time.Now().Unix() > expires {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "链接已过期"})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// validSignature 校验请求体的 HMAC-SHA256 签名，签名可以带 sha256= 前缀
+func validSignature(secret string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// requestAPIKey 从请求头中获取密钥
+func requestAPIKey(c echo.Context) string {
+	if key := c.Request().Header.Get(HeaderAPIKey); key != "" {
+		return key
+	}
+
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return ""
+}
+
+// secureEqual 常量时间比较，避免时序攻击
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newTestLogger() *logger.Logger {
+	return logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+}
+
+// newEmbyStub 模拟 Emby 的 /Users/Me，admin-token 为管理员，user-token 为普通用户
+func newEmbyStub(t *testing.T, calls *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		if r.URL.Path != "/emby/Users/Me" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Header.Get("X-Emby-Token") {
+		case "admin-token":
+			w.Write([]byte(`{"Name":"admin","Policy":{"IsAdministrator":true}}`))
+		case "user-token":
+			w.Write([]byte(`{"Name":"user","Policy":{"IsAdministrator":false}}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// serve 通过中间件执行请求，返回状态码和响应体
+func serve(mw echo.MiddlewareFunc, req *http.Request) (int, string) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	handler := mw(func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		return c.String(http.StatusOK, "ok:"+string(body))
+	})
+	if err := handler(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+
+	return rec.Code, rec.Body.String()
+}
+
+func TestAdminAuth(t *testing.T) {
+	var calls int32
+	emby := newEmbyStub(t, &calls)
+	mw := AdminAuth("secret", NewEmbyAdminValidator(emby.URL), newTestLogger())
+
+	cases := []struct {
+		name   string
+		header map[string]string
+		query  string
+		code   int
+	}{
+		{"api key header", map[string]string{HeaderAPIKey: "secret"}, "", http.StatusOK},
+		{"bearer api key", map[string]string{echo.HeaderAuthorization: "Bearer secret"}, "", http.StatusOK},
+		{"emby token header", map[string]string{"X-Emby-Token": "admin-token"}, "", http.StatusOK},
+		{"emby authorization", map[string]string{"X-Emby-Authorization": `MediaBrowser Client="web", Token="admin-token"`}, "", http.StatusOK},
+		{"emby token in api key header", map[string]string{HeaderAPIKey: "admin-token"}, "", http.StatusOK},
+		{"emby token query", nil, "?api_key=admin-token", http.StatusOK},
+		{"non admin", map[string]string{"X-Emby-Token": "user-token"}, "", http.StatusUnauthorized},
+		{"invalid token", map[string]string{"X-Emby-Token": "bad"}, "", http.StatusUnauthorized},
+		{"missing", nil, "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/cinexus-api/admin/queue"+tc.query, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			if code, body := serve(mw, req); code != tc.code {
+				t.Fatalf("expected %d, got %d: %s", tc.code, code, body)
+			}
+		})
+	}
+
+	// 校验结果会被缓存
+	before := atomic.LoadInt32(&calls)
+	req := httptest.NewRequest(http.MethodGet, "/cinexus-api/admin/queue", nil)
+	req.Header.Set("X-Emby-Token", "admin-token")
+	serve(mw, req)
+	if after := atomic.LoadInt32(&calls); after != before {
+		t.Fatalf("expected cached result, Emby was called %d more times", after-before)
+	}
+}
+
+func TestAdminAuthDisabled(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/cinexus-api/admin/queue", nil)
+	req.Header.Set(HeaderAPIKey, "")
+
+	if code, _ := serve(AdminAuth("", nil, newTestLogger()), req); code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", code)
+	}
+}
+
+func TestWebhookAuth(t *testing.T) {
+	const secret = "hook-secret"
+	body := `{"Event":"library.new"}`
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	cases := []struct {
+		name      string
+		secret    string
+		query     string
+		signature string
+		code      int
+	}{
+		{"no secret configured", "", "", "", http.StatusOK},
+		{"query token", secret, "?token=" + secret, "", http.StatusOK},
+		{"wrong query token", secret, "?token=nope", "", http.StatusUnauthorized},
+		{"signature", secret, "", signature, http.StatusOK},
+		{"bare signature", secret, "", strings.TrimPrefix(signature, "sha256="), http.StatusOK},
+		{"wrong signature", secret, "", "sha256=00", http.StatusUnauthorized},
+		{"missing", secret, "", "", http.StatusUnauthorized},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/cinexus-api/webhook/emby"+tc.query, strings.NewReader(body))
+			if tc.signature != "" {
+				req.Header.Set(HeaderSignature, tc.signature)
+			}
+
+			code, resp := serve(WebhookAuth(tc.secret), req)
+			if code != tc.code {
+				t.Fatalf("expected %d, got %d: %s", tc.code, code, resp)
+			}
+			// 校验签名后请求体仍然可以被读取
+			if code == http.StatusOK && resp != "ok:"+body {
+				t.Fatalf("request body not preserved: %s", resp)
+			}
+		})
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	path := "/cinexus-api/115/pick/abc"
+	expires := time.Now().Add(time.Hour).Unix()
+	signed := func(expires int64, sign string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s?e=%d&sign=%s", path, expires, sign), nil)
+	}
+
+	if code, _ := serve(SignedURL(""), signed(expires, SignPath("", path, expires))); code != http.StatusForbidden {
+		t.Errorf("未配置密钥时期望 403, 实际: %d", code)
+	}
+
+	mw := SignedURL("secret")
+	if code, _ := serve(mw, signed(expires, SignPath("secret", path, expires))); code != http.StatusOK {
+		t.Errorf("签名正确时期望 200, 实际: %d", code)
+	}
+	if code, _ := serve(mw, signed(0, SignPath("secret", path, 0))); code != http.StatusOK {
+		t.Errorf("永不过期的签名期望 200, 实际: %d", code)
+	}
+	// 修改过期时间后签名无效
+	if code, _ := serve(mw, signed(expires+1, SignPath("secret", path, expires))); code != http.StatusUnauthorized {
+		t.Errorf("修改过期时间后期望 401, 实际: %d", code)
+	}
+	if code, _ := serve(mw, httptest.NewRequest(http.MethodGet, path, nil)); code != http.StatusUnauthorized {
+		t.Errorf("没有签名时期望 401, 实际: %d", code)
+	}
+
+	expired := time.Now().Add(-time.Minute).Unix()
+	if code, _ := serve(mw, signed(expired, SignPath("secret", path, expired))); code != http.StatusForbidden {
+		t.Errorf("过期后期望 403, 实际: %d", code)
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+// embyAuthTokenPattern 匹配 X-Emby-Authorization 中的 Token="..."
+var embyAuthTokenPattern = regexp.MustCompile(`(?i)Token="([^"]+)"`)
+
+// EmbyAdminValidator 通过上游 Emby 的 /Users/Me 校验 access token 是否属于管理员，并缓存校验结果
+type EmbyAdminValidator struct {
+	client *resty.Client
+	cache  *cache.Cache
+}
+
+// embyAdminCacheTime 校验通过的 token 缓存时间，失败的结果只缓存 1 分钟，避免反复请求 Emby
+const (
+	embyAdminCacheTime    = 5 * time.Minute
+	embyNonAdminCacheTime = 1 * time.Minute
+)
+
+// NewEmbyAdminValidator 创建 Emby 管理员 token 校验器，embyURL 为上游 Emby 地址
+func NewEmbyAdminValidator(embyURL string) *EmbyAdminValidator {
+	return &EmbyAdminValidator{
+		client: resty.New().
+			SetBaseURL(strings.TrimSuffix(embyURL, "/")).
+			SetHeader("Accept", "application/json").
+			SetTimeout(10 * time.Second),
+		cache: cache.New(embyAdminCacheTime, 10*time.Minute),
+	}
+}
+
+// embyUser /Users/Me 返回的用户信息
+type embyUser struct {
+	Name   string `json:"Name"`
+	Policy struct {
+		IsAdministrator bool `json:"IsAdministrator"`
+		IsDisabled      bool `json:"IsDisabled"`
+	} `json:"Policy"`
+}
+
+// IsAdmin 判断 token 是否属于未禁用的 Emby 管理员
+func (v *EmbyAdminValidator) IsAdmin(token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	if cached, found := v.cache.Get(token); found {
+		return cached.(bool), nil
+	}
+
+	var user embyUser
+	resp, err := v.client.R().
+		SetHeader("X-Emby-Token", token).
+		SetResult(&user).
+		Get("/emby/Users/Me")
+	if err != nil {
+		return false, fmt.Errorf("请求 Emby 校验 token 失败: %w", err)
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusBadRequest:
+		v.cache.Set(token, false, embyNonAdminCacheTime)
+		return false, nil
+	default:
+		return false, fmt.Errorf("Emby 校验 token 失败，状态码: %d", resp.StatusCode())
+	}
+
+	isAdmin := user.Policy.IsAdministrator && !user.Policy.IsDisabled
+	if isAdmin {
+		v.cache.Set(token, true, embyAdminCacheTime)
+	} else {
+		v.cache.Set(token, false, embyNonAdminCacheTime)
+	}
+
+	return isAdmin, nil
+}
+
+// requestEmbyToken 按 Emby 客户端的习惯从请求头或查询参数中获取 access token
+func requestEmbyToken(c echo.Context) string {
+	req := c.Request()
+
+	for _, header := range []string{"X-Emby-Token", "X-MediaBrowser-Token"} {
+		if token := req.Header.Get(header); token != "" {
+			return token
+		}
+	}
+
+	for _, header := range []string{"X-Emby-Authorization", echo.HeaderAuthorization} {
+		if matches := embyAuthTokenPattern.FindStringSubmatch(req.Header.Get(header)); len(matches) == 2 {
+			return matches[1]
+		}
+	}
+
+	for _, param := range []string{"X-Emby-Token", "api_key"} {
+		if token := c.QueryParam(param); token != "" {
+			return token
+		}
+	}
+
+	return ""
+}
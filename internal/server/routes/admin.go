@@ -0,0 +1,453 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/filewatcher"
+	"cinexus/internal/helper"
+	"cinexus/internal/helper/emby"
+	"cinexus/internal/logger"
+	"cinexus/internal/playtrace"
+	"cinexus/internal/scheduler"
+	"cinexus/internal/storage"
+	"cinexus/internal/tokenrefresher"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+// Components 管理 API 需要访问的运行时组件，未启用的组件为 nil
+type Components struct {
+	TokenRefresher *tokenrefresher.TokenRefresher
+	FileWatcher    *filewatcher.FileWatcherManager
+	Scheduler      *scheduler.Scheduler
+}
+
+// setupAdmin 配置管理 API 路由
+func setupAdmin(admin *echo.Group, cfg *config.Config, log *logger.Logger, linkCache *cache.Cache, components Components) {
+	// 任务队列
+	admin.GET("/queue", HandleQueueList)
+	admin.GET("/queue/:id", HandleQueueGet)
+	admin.POST("/queue/:id/retry", func(c echo.Context) error {
+		return HandleQueueRetry(c, log)
+	})
+	admin.POST("/queue/:id/cancel", func(c echo.Context) error {
+		return HandleQueueCancel(c, log)
+	})
+	admin.DELETE("/queue", func(c echo.Context) error {
+		return HandleQueuePurge(c, log)
+	})
+
+	// 定时任务
+	admin.GET("/jobs", func(c echo.Context) error {
+		return HandleJobsList(c, components.Scheduler)
+	})
+	admin.POST("/jobs/:name/run", func(c echo.Context) error {
+		return HandleJobRun(c, components.Scheduler, log)
+	})
+
+	// pickcode 缓存
+	admin.GET("/cache/pickcode", HandlePickcodeStats)
+	admin.GET("/cache/pickcode/lookup", HandlePickcodeLookup)
+	admin.GET("/cache/pickcode/duplicates", HandlePickcodeDuplicates)
+	admin.DELETE("/cache/pickcode", func(c echo.Context) error {
+		return HandlePickcodeDelete(c, log)
+	})
+
+	// 直链缓存
+	admin.GET("/cache/link", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]any{"count": linkCache.ItemCount()})
+	})
+	admin.DELETE("/cache/link", func(c echo.Context) error {
+		count := linkCache.ItemCount()
+		linkCache.Flush()
+		log.Infof("🧹 已清空直链缓存，共 %d 条", count)
+		return c.JSON(http.StatusOK, map[string]any{"message": "ok", "deleted": count})
+	})
+
+	// 直链接口签名
+	admin.GET("/link/sign", func(c echo.Context) error {
+		return HandleLinkSign(c, cfg)
+	})
+
+	// 115open token
+	admin.GET("/token", func(c echo.Context) error {
+		return HandleTokenStatus(c, components.TokenRefresher)
+	})
+	admin.POST("/token/refresh", func(c echo.Context) error {
+		return HandleTokenRefresh(c, components.TokenRefresher, log)
+	})
+
+	// 115 Cookie
+	cookie115 := admin.Group("/115/cookie")
+	cookie115.GET("", func(c echo.Context) error {
+		return HandleCookieStatus(c, cfg)
+	})
+	cookie115.POST("/check", func(c echo.Context) error {
+		return HandleCookieCheck(c, cfg, log)
+	})
+	cookie115.POST("/qrcode", func(c echo.Context) error {
+		return HandleCookieQRCodeStart(c, cfg, log)
+	})
+	cookie115.GET("/qrcode/:uid", func(c echo.Context) error {
+		return HandleCookieQRCodeStatus(c, log)
+	})
+
+	// 文件监控
+	admin.GET("/filewatcher", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]any{
+			"enabled":  components.FileWatcher != nil,
+			"watchers": components.FileWatcher.GetStatus(),
+		})
+	})
+
+	// 播放解析记录和正在播放的会话
+	admin.GET("/plays", HandlePlays)
+	admin.GET("/sessions", func(c echo.Context) error {
+		return HandleSessions(c, cfg)
+	})
+	admin.GET("/playback", HandlePlaybackRecords)
+
+	// 试运行解析
+	admin.GET("/resolve/:itemId", func(c echo.Context) error {
+		return HandleResolveDryRun(c, cfg, log)
+	})
+}
+
+// queueOrUnavailable 获取任务队列，未初始化时返回 nil
+func queueOrUnavailable(c echo.Context) (*storage.PersistentTaskQueue, error) {
+	taskQueue := storage.GetTaskQueue()
+	if taskQueue == nil {
+		return nil, c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "任务队列未初始化"})
+	}
+	return taskQueue, nil
+}
+
+// parseTaskID 解析路径中的任务 ID
+func parseTaskID(c echo.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// HandleQueueList 列出任务队列
+func HandleQueueList(c echo.Context) error {
+	taskQueue, err := queueOrUnavailable(c)
+	if taskQueue == nil {
+		return err
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.QueryParam("offset"))
+
+	tasks, total, err := taskQueue.ListTasks(storage.TaskStatus(c.QueryParam("status")), limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	status, err := taskQueue.GetQueueStatus()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"status":    status,
+		"in_flight": taskQueue.InFlight(),
+		"total":     total,
+		"tasks":     tasks,
+	})
+}
+
+// HandleQueueGet 获取单个任务
+func HandleQueueGet(c echo.Context) error {
+	taskQueue, err := queueOrUnavailable(c)
+	if taskQueue == nil {
+		return err
+	}
+
+	id, ok := parseTaskID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "无效的任务 ID"})
+	}
+
+	task, err := taskQueue.GetTask(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "任务不存在"})
+	}
+
+	return c.JSON(http.StatusOK, task)
+}
+
+// HandleQueueRetry 重试失败或已取消的任务
+func HandleQueueRetry(c echo.Context, log *logger.Logger) error {
+	taskQueue, err := queueOrUnavailable(c)
+	if taskQueue == nil {
+		return err
+	}
+
+	id, ok := parseTaskID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "无效的任务 ID"})
+	}
+
+	if err := taskQueue.RetryTask(id); err != nil {
+		log.Warnf("重试任务失败: %v", err)
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "ok"})
+}
+
+// HandleQueueCancel 取消待处理的任务
+func HandleQueueCancel(c echo.Context, log *logger.Logger) error {
+	taskQueue, err := queueOrUnavailable(c)
+	if taskQueue == nil {
+		return err
+	}
+
+	id, ok := parseTaskID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "无效的任务 ID"})
+	}
+
+	if err := taskQueue.CancelTask(id); err != nil {
+		log.Warnf("取消任务失败: %v", err)
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "ok"})
+}
+
+// HandleQueuePurge 按状态和时间清理任务，例如 ?status=completed&older_than=7d
+func HandleQueuePurge(c echo.Context, log *logger.Logger) error {
+	taskQueue, err := queueOrUnavailable(c)
+	if taskQueue == nil {
+		return err
+	}
+
+	status := storage.TaskStatus(c.QueryParam("status"))
+	if status == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "必须指定 status"})
+	}
+
+	olderThan, err := helper.ParseDuration(c.QueryParam("older_than"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	deleted, err := taskQueue.PurgeTasks(status, olderThan)
+	if err != nil {
+		log.Warnf("清理任务失败: %v", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"message": "ok", "deleted": deleted})
+}
+
+// HandlePickcodeStats 获取 pickcode 缓存统计
+func HandlePickcodeStats(c echo.Context) error {
+	count, err := storage.GetPickcodeCacheStats()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"count": count})
+}
+
+// pickcodeLookupResult pickcode 缓存查询结果，保留 path 字段兼容旧的返回格式
+type pickcodeLookupResult struct {
+	Path string `json:"path"`
+	storage.PickcodeCache
+}
+
+// HandlePickcodeLookup 查询 pickcode 缓存，?path= 按路径，?pickcode= 按 pickcode，?sha1= 按 SHA1 返回所有内容相同的文件
+func HandlePickcodeLookup(c echo.Context) error {
+	path := c.QueryParam("path")
+	pickcode := c.QueryParam("pickcode")
+	sha1 := c.QueryParam("sha1")
+
+	var cache *storage.PickcodeCache
+	var found bool
+	switch {
+	case path != "":
+		cache, found = storage.GetPickcodeCache(path)
+	case pickcode != "":
+		cache, found = storage.GetPickcodeCacheByPickcode(pickcode)
+	case sha1 != "":
+		caches, err := storage.FindPickcodeCachesBySHA1(sha1)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		if len(caches) == 0 {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "缓存中不存在该 SHA1 的文件"})
+		}
+		return c.JSON(http.StatusOK, map[string]any{"sha1": strings.ToUpper(sha1), "items": caches})
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "必须指定 path、pickcode 或 sha1"})
+	}
+
+	if !found {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "缓存中不存在该文件"})
+	}
+	return c.JSON(http.StatusOK, pickcodeLookupResult{Path: cache.FilePath, PickcodeCache: *cache})
+}
+
+// HandlePickcodeDuplicates 列出 SHA1 相同的缓存文件，即在 115 中重复上传的文件
+func HandlePickcodeDuplicates(c echo.Context) error {
+	duplicates, err := storage.FindDuplicatePickcodeCaches()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"count": len(duplicates), "items": duplicates})
+}
+
+// HandlePickcodeDelete 删除 pickcode 缓存，?path= 删除单个文件，?prefix= 删除目录，?all=true 清空
+func HandlePickcodeDelete(c echo.Context, log *logger.Logger) error {
+	path := c.QueryParam("path")
+	prefix := c.QueryParam("prefix")
+
+	switch {
+	case path != "":
+		if err := storage.DeletePickcodeFromCache(path); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		log.Infof("🧹 已删除 pickcode 缓存: %s", path)
+		return c.JSON(http.StatusOK, map[string]string{"message": "ok"})
+	case prefix != "":
+		deleted, err := storage.DeletePickcodeByPrefix(prefix)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		log.Infof("🧹 已删除目录 %s 下的 %d 条 pickcode 缓存", prefix, deleted)
+		return c.JSON(http.StatusOK, map[string]any{"message": "ok", "deleted": deleted})
+	case c.QueryParam("all") == "true":
+		if err := storage.ClearPickcodeCache(); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		log.Info("🧹 已清空 pickcode 缓存")
+		return c.JSON(http.StatusOK, map[string]string{"message": "ok"})
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "必须指定 path、prefix 或 all=true"})
+	}
+}
+
+// HandleTokenStatus 获取 115open token 状态
+func HandleTokenStatus(c echo.Context, refresher *tokenrefresher.TokenRefresher) error {
+	refreshToken, accessToken, updatedAt, err := storage.GetTokens()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	result := map[string]any{
+		"has_refresh_token": refreshToken != "",
+		"has_access_token":  accessToken != "",
+		"updated_at":        updatedAt,
+	}
+
+	if refresher != nil {
+		lastRefreshAt, lastErr := refresher.Status()
+		result["refreshing"] = refresher.IsRefreshing()
+		result["last_refresh_at"] = lastRefreshAt
+		if lastErr != nil {
+			result["last_error"] = lastErr.Error()
+		}
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// HandleTokenRefresh 手动刷新 115open token
+func HandleTokenRefresh(c echo.Context, refresher *tokenrefresher.TokenRefresher, log *logger.Logger) error {
+	if refresher == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "token 刷新器未启动"})
+	}
+
+	log.Info("🔄 通过管理 API 手动刷新 token")
+	if err := refresher.RefreshNow(); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "ok"})
+}
+
+// HandleResolveDryRun 对 Emby 项目试运行解析链，返回解析得到的直链但不缓存、不重定向
+// 可以通过 ?ua= 指定解析时使用的 User-Agent
+func HandleResolveDryRun(c echo.Context, cfg *config.Config, log *logger.Logger) error {
+	itemID := c.Param("itemId")
+	if ua := c.QueryParam("ua"); ua != "" {
+		c.Request().Header.Set("User-Agent", ua)
+	}
+
+	start := time.Now()
+	itemInfoUri := cfg.Proxy.URL + "/Items?Ids=" + url.QueryEscape(itemID) + "&Fields=Path,MediaSources&Limit=1&api_key=" + cfg.Proxy.APIKey
+	embyRes, err := helper.GetEmbyItems(itemInfoUri, itemID, "", "", cfg.Proxy.APIKey)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	// 与播放使用相同的流程，.strm 媒体按链接解析
+	embyPlayPath, redirectURL, skip := resolveItemPath(c, embyRes.Path, cfg, log)
+	localPath, isLocal := localFileFrom(c)
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"item_id":                itemID,
+		"path":                   embyPlayPath,
+		"local_file":             localPath,
+		"protocol":               embyRes.Protocol,
+		"need_add_media_streams": embyRes.NeedAddMediaStreams,
+		"method":                 cfg.Proxy.Method,
+		"url":                    redirectURL,
+		"proxied_by_emby":        skip && !isLocal,
+		"duration":               time.Since(start).String(),
+	})
+}
+
+// HandlePlays 获取进行中和最近完成的播放解析记录，可以通过 ?limit= 限制最近记录条数
+func HandlePlays(c echo.Context) error {
+	active, recent := playtrace.Default().Snapshot()
+
+	if limit, err := strconv.Atoi(c.QueryParam("limit")); err == nil && limit >= 0 && limit < len(recent) {
+		recent = recent[:limit]
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"active": active,
+		"recent": recent,
+	})
+}
+
+// HandlePlaybackRecords 列出通过 webhook 记录的播放记录，可以通过 ?user_id=&item_id= 过滤
+func HandlePlaybackRecords(c echo.Context) error {
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.QueryParam("offset"))
+
+	records, total, err := storage.ListPlaybackRecords(c.QueryParam("user_id"), c.QueryParam("item_id"), limit, offset)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"total": total, "records": records})
+}
+
+// HandleSessions 获取 Emby 中正在播放的会话
+func HandleSessions(c echo.Context, cfg *config.Config) error {
+	sessions, err := emby.New(cfg).GetSessions(true)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"sessions": sessions})
+}
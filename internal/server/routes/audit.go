@@ -0,0 +1,398 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/helper"
+	"cinexus/internal/helper/alist"
+	"cinexus/internal/helper/emby"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AuditIssue 媒体库审计发现的问题
+type AuditIssue string
+
+const (
+	AuditIssueMissingMediaInfo AuditIssue = "missing-media-info" // 缺少媒体信息
+	AuditIssueNoPath           AuditIssue = "no-path"            // 项目没有文件路径
+	AuditIssueUnmapped         AuditIssue = "unmapped"           // 路径不在 proxy.paths 的映射中，播放时交给 Emby 处理
+	AuditIssueNotFound         AuditIssue = "not-found"          // 115 或 AList 中找不到文件
+	AuditIssueCheckFailed      AuditIssue = "check-failed"       // 检查网盘文件时出错
+	AuditIssueDuplicate        AuditIssue = "duplicate"          // 多个项目指向同一个文件
+)
+
+// AuditIssues 所有审计问题，按报告中的顺序排列
+var AuditIssues = []AuditIssue{
+	AuditIssueMissingMediaInfo, AuditIssueNoPath, AuditIssueUnmapped,
+	AuditIssueNotFound, AuditIssueCheckFailed, AuditIssueDuplicate,
+}
+
+// AuditItem 单个项目的审计结果，Issues 为空表示没有问题
+type AuditItem struct {
+	ItemID    string       `json:"item_id"`
+	Name      string       `json:"name"`
+	Type      string       `json:"type"`
+	Library   string       `json:"library"`
+	Path      string       `json:"path"`
+	CloudPath string       `json:"cloud_path,omitempty"`
+	Issues    []AuditIssue `json:"issues"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// HasIssue 判断项目是否有指定的问题
+func (i *AuditItem) HasIssue(issue AuditIssue) bool {
+	for _, it := range i.Issues {
+		if it == issue {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditOptions 媒体库审计选项
+type AuditOptions struct {
+	LibraryID     string        // 只审计指定的媒体库，为空时审计 proxy.admin_user_id 可见的所有媒体库
+	Types         string        // 项目类型，逗号分隔
+	PageSize      int           // 每页从 Emby 获取的项目数
+	CheckCloud    bool          // 检查文件是否存在于 115 或 AList
+	CloudInterval time.Duration // 两次列出 115 目录的间隔，避免被风控
+
+	// Progress 每处理完一页调用一次，可以为 nil
+	Progress func(library string, scanned, total int)
+}
+
+// AuditReport 媒体库审计报告
+type AuditReport struct {
+	Libraries int                `json:"libraries"`
+	Scanned   int                `json:"scanned"`
+	Counts    map[AuditIssue]int `json:"counts"`
+	Items     []AuditItem        `json:"items"`
+}
+
+// auditSkipCollections 不需要审计的媒体库类型，其中的项目都属于其他媒体库
+var auditSkipCollections = map[string]bool{
+	"boxsets":   true,
+	"playlists": true,
+}
+
+// AuditLibrary 分页遍历媒体库中的项目，检查媒体信息、路径映射、网盘文件和重复项目
+func AuditLibrary(cfg *config.Config, log *logger.Logger, opts AuditOptions) (*AuditReport, error) {
+	if cfg.Proxy.AdminUserID == "" {
+		return nil, fmt.Errorf("proxy.admin_user_id 未配置，无法获取媒体库")
+	}
+
+	client := emby.New(cfg)
+	libraries, err := auditLibraries(client, cfg.Proxy.AdminUserID, opts.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AuditReport{Libraries: len(libraries), Counts: make(map[AuditIssue]int)}
+	checker := &cloudChecker{cfg: cfg, log: log, interval: opts.CloudInterval, dirs: make(map[string]listedDir)}
+	seen := make(map[string]bool)
+	byPath := make(map[string][]int)
+
+	params := map[string]string{
+		"IsFolder": "false",
+		"Fields":   "Path,MediaSources",
+	}
+	if opts.Types != "" {
+		params["IncludeItemTypes"] = opts.Types
+	}
+
+	for _, library := range libraries {
+		scanned := 0
+		for start := 0; ; start += opts.PageSize {
+			items, total, err := client.GetFolderItemsPage(library.id, params, start, opts.PageSize)
+			if err != nil {
+				return nil, fmt.Errorf("获取媒体库 %s 的项目失败: %w", library.name, err)
+			}
+
+			for _, item := range items {
+				scanned++
+				if item.IsFolder || seen[item.Id] {
+					continue
+				}
+				seen[item.Id] = true
+
+				result := auditItem(cfg, checker, item, opts.CheckCloud)
+				result.Library = library.name
+				report.Items = append(report.Items, result)
+				if result.Path != "" {
+					byPath[result.Path] = append(byPath[result.Path], len(report.Items)-1)
+				}
+			}
+
+			if opts.Progress != nil {
+				opts.Progress(library.name, scanned, total)
+			}
+			if len(items) < opts.PageSize || scanned >= total {
+				break
+			}
+		}
+	}
+
+	// 多个项目指向同一个文件
+	for _, indexes := range byPath {
+		if len(indexes) < 2 {
+			continue
+		}
+		for _, i := range indexes {
+			report.Items[i].Issues = append(report.Items[i].Issues, AuditIssueDuplicate)
+		}
+	}
+
+	report.Scanned = len(report.Items)
+	for _, item := range report.Items {
+		for _, issue := range item.Issues {
+			report.Counts[issue]++
+		}
+	}
+
+	return report, nil
+}
+
+// auditLibrary 需要审计的媒体库
+type auditLibrary struct {
+	id   string
+	name string
+}
+
+// auditLibraries 获取需要审计的媒体库，libraryID 不为空时只返回该媒体库
+func auditLibraries(client *emby.Client, userID, libraryID string) ([]auditLibrary, error) {
+	views, err := client.GetUserViews(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取媒体库失败: %w", err)
+	}
+
+	var libraries []auditLibrary
+	items, _ := views["Items"].([]any)
+	for _, it := range items {
+		view, _ := it.(map[string]any)
+		id, _ := view["Id"].(string)
+		name, _ := view["Name"].(string)
+		collectionType, _ := view["CollectionType"].(string)
+
+		if libraryID != "" {
+			if id == libraryID {
+				return []auditLibrary{{id: id, name: name}}, nil
+			}
+			continue
+		}
+		if id == "" || auditSkipCollections[collectionType] {
+			continue
+		}
+		libraries = append(libraries, auditLibrary{id: id, name: name})
+	}
+
+	// 媒体库不在用户视图中时仍然按 ID 审计，例如文件夹
+	if libraryID != "" {
+		return []auditLibrary{{id: libraryID, name: libraryID}}, nil
+	}
+
+	return libraries, nil
+}
+
+// auditItem 检查单个项目
+func auditItem(cfg *config.Config, checker *cloudChecker, item emby.FolderItem, checkCloud bool) AuditItem {
+	result := AuditItem{
+		ItemID: item.Id,
+		Name:   item.Name,
+		Type:   item.Type,
+		Path:   item.Path,
+		Issues: []AuditIssue{},
+	}
+
+	if len(item.MediaSources) == 0 || helper.NeedMediaStreams(item.MediaSources[0]) {
+		result.Issues = append(result.Issues, AuditIssueMissingMediaInfo)
+	}
+
+	if item.Path == "" {
+		result.Issues = append(result.Issues, AuditIssueNoPath)
+		return result
+	}
+
+	isAlistURL := cfg.Alist.URL != "" && strings.HasPrefix(item.Path, cfg.Alist.URL)
+	if _, ok := MatchPathConfig(cfg, helper.EnsureLeadingSlash(item.Path)); !ok && !isAlistURL {
+		result.Issues = append(result.Issues, AuditIssueUnmapped)
+		return result
+	}
+
+	if !checkCloud {
+		return result
+	}
+
+	cloudPath, err := checker.check(item.Path)
+	result.CloudPath = cloudPath
+	switch {
+	case errors.Is(err, errCloudCheckUnsupported):
+	case errors.Is(err, errCloudFileNotFound):
+		result.Issues = append(result.Issues, AuditIssueNotFound)
+	case err != nil:
+		result.Issues = append(result.Issues, AuditIssueCheckFailed)
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+var (
+	errCloudCheckUnsupported = errors.New("当前方案无法检查网盘文件")
+	errCloudFileNotFound     = errors.New("网盘中找不到文件")
+)
+
+// cloudChecker 检查 Emby 路径对应的文件是否存在于 115 或 AList
+// ck 方案列出文件所在的目录，同一目录只列出一次，并缓存其中所有文件的 pickcode
+type cloudChecker struct {
+	cfg      *config.Config
+	log      *logger.Logger
+	interval time.Duration
+
+	lister     dirLister
+	lastListAt time.Time
+	dirs       map[string]listedDir // 已列出的目录
+}
+
+// check 返回文件在网盘中的路径，文件不存在时返回 errCloudFileNotFound
+func (c *cloudChecker) check(embyPath string) (string, error) {
+	if c.cfg.Alist.URL != "" && strings.HasPrefix(embyPath, c.cfg.Alist.URL) {
+		alistPath := strings.TrimPrefix(strings.TrimPrefix(embyPath, c.cfg.Alist.URL), "/d")
+		return alistPath, c.checkAlist(alistPath)
+	}
+
+	embyPath = helper.EnsureLeadingSlash(embyPath)
+	matchPathConfig, _ := MatchPathConfig(c.cfg, embyPath)
+	if matchPathConfig.Resolver == config.PathResolverLocal {
+		localPath, err := LocalFilePath(c.cfg, embyPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", errCloudFileNotFound
+		}
+		return localPath, err
+	}
+
+	switch c.cfg.Proxy.Method {
+	case "ck", "ck+115open":
+		cloudPath, _ := CloudPath(c.cfg, embyPath)
+		return cloudPath, c.check115(cloudPath)
+	default:
+		if c.cfg.Alist.URL == "" {
+			return "", errCloudCheckUnsupported
+		}
+		alistPath := strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1)
+		return alistPath, c.checkAlist(alistPath)
+	}
+}
+
+// checkAlist 通过 AList 的 /api/fs/get 检查文件
+func (c *cloudChecker) checkAlist(alistPath string) error {
+	_, err := alist.FsGet(c.cfg.Alist.URL, c.cfg.Alist.APIKey, alistPath)
+	if errors.Is(err, alist.ErrNotFound) {
+		return errCloudFileNotFound
+	}
+	return err
+}
+
+// check115 通过 115 目录列表检查文件，同一目录只列出一次
+// pickcode 缓存只用来找到所在目录的 CID，文件可能已被删除，不能证明仍然存在
+func (c *cloudChecker) check115(cloudPath string) error {
+	dirPath := filepath.Dir(cloudPath)
+	fileName := filepath.Base(cloudPath)
+
+	dir, ok := c.dirs[dirPath]
+	if !ok {
+		cid := ""
+		if cache, found := storage.GetPickcodeCache(cloudPath); found {
+			cid = cache.ParentCID
+		}
+		var err error
+		if dir, err = c.list115Dir(dirPath, cid); err != nil {
+			return err
+		}
+	}
+
+	// 目录被移动或删除后缓存的目录 CID 会失效，通过路径重新列出一次
+	if !dir.names[fileName] && !dir.byPath {
+		var err error
+		if dir, err = c.list115Dir(dirPath, ""); err != nil {
+			return err
+		}
+	}
+
+	if !dir.names[fileName] {
+		return errCloudFileNotFound
+	}
+	return nil
+}
+
+// listedDir 已列出的 115 目录
+type listedDir struct {
+	names  map[string]bool // 目录中的文件名
+	byPath bool            // 是否通过路径找到的目录，否则使用的是缓存的目录 CID
+}
+
+// list115Dir 列出 115 目录并缓存其中所有文件的 pickcode，cid 为空时通过路径查找目录，目录不存在时返回空集合
+func (c *cloudChecker) list115Dir(dirPath, cid string) (listedDir, error) {
+	if c.lister == nil {
+		lister, err := newDirLister(c.cfg)
+		if err != nil {
+			return listedDir{}, err
+		}
+		c.lister = lister
+	}
+
+	if wait := c.interval - time.Since(c.lastListAt); wait > 0 {
+		time.Sleep(wait)
+	}
+	defer func() { c.lastListAt = time.Now() }()
+
+	dir := listedDir{names: make(map[string]bool), byPath: cid == ""}
+	if cid == "" {
+		var err error
+		cid, err = c.lister.DirID(dirPath)
+		if errors.Is(err, errCloudDirNotFound) {
+			c.dirs[dirPath] = dir
+			return dir, nil
+		}
+		if err != nil {
+			return listedDir{}, fmt.Errorf("获取目录 %s 的 CID 错误: %w", dirPath, err)
+		}
+	}
+
+	entries, err := c.lister.List(context.Background(), cid)
+	if err != nil {
+		return listedDir{}, fmt.Errorf("列出目录 %s 错误: %w", dirPath, err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir {
+			dir.names[entry.Name] = true
+		}
+	}
+	c.dirs[dirPath] = dir
+
+	if c.cfg.Proxy.CachePickcode {
+		if _, err := cacheDirPickcodes(dirPath, cid, entries); err != nil {
+			c.log.Warnf("批量缓存 pickcode 失败: %s, 错误: %v", dirPath, err)
+		}
+	}
+
+	return dir, nil
+}
+
+// SortAuditItems 按媒体库和路径排序
+func SortAuditItems(items []AuditItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Library != items[j].Library {
+			return items[i].Library < items[j].Library
+		}
+		return items[i].Path < items[j].Path
+	})
+}
@@ -0,0 +1,110 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cinexus/internal/config"
+	"cinexus/internal/helper/emby"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+)
+
+func TestAuditItem(t *testing.T) {
+	// 模拟 AList 的 /api/fs/get，gone 目录中的文件不存在
+	alistServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Path string `json:"path"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if strings.HasPrefix(body.Path, "/115/gone/") {
+			w.Write([]byte(`{"code":500,"message":"failed get storage: object not found"}`))
+			return
+		}
+		w.Write([]byte(`{"code":200,"data":{"name":"a.mkv"}}`))
+	}))
+	defer alistServer.Close()
+
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{
+			Method: "alist",
+			Paths:  []config.Path{{Old: "/media", New: "/115", Real: "/115"}},
+		},
+		Alist: config.AlistConfig{URL: alistServer.URL},
+	}
+	checker := &cloudChecker{cfg: cfg}
+	complete := []map[string]any{{"MediaStreams": []any{map[string]any{}}, "Bitrate": 1}}
+
+	tests := []struct {
+		name string
+		item emby.FolderItem
+		want []AuditIssue
+	}{
+		{"正常", emby.FolderItem{Path: "/media/a.mkv", MediaSources: complete}, []AuditIssue{}},
+		{"缺少媒体信息", emby.FolderItem{Path: "/media/a.mkv", MediaSources: []map[string]any{{}}}, []AuditIssue{AuditIssueMissingMediaInfo}},
+		{"没有路径", emby.FolderItem{MediaSources: complete}, []AuditIssue{AuditIssueNoPath}},
+		{"不在路径映射中", emby.FolderItem{Path: "/other/a.mkv", MediaSources: complete}, []AuditIssue{AuditIssueUnmapped}},
+		{"网盘中不存在", emby.FolderItem{Path: "/media/gone/a.mkv", MediaSources: complete}, []AuditIssue{AuditIssueNotFound}},
+		{"AList 链接", emby.FolderItem{Path: alistServer.URL + "/d/115/gone/a.mkv", MediaSources: complete}, []AuditIssue{AuditIssueNotFound}},
+	}
+
+	for _, tt := range tests {
+		got := auditItem(cfg, checker, tt.item, true)
+		if !reflect.DeepEqual(got.Issues, tt.want) {
+			t.Errorf("%s: 期望问题 %v, 实际: %v (%s)", tt.name, tt.want, got.Issues, got.Error)
+		}
+	}
+}
+
+func TestCheck115(t *testing.T) {
+	storage.DataDir = t.TempDir()
+	if err := storage.InitDB(); err != nil {
+		t.Fatalf("InitDB 失败: %v", err)
+	}
+	if err := storage.ClearPickcodeCache(); err != nil {
+		t.Fatalf("清空 pickcode 缓存失败: %v", err)
+	}
+
+	// 缓存中 gone.mkv 已从 115 删除，moved.mkv 所在目录的 CID 已失效
+	if _, err := storage.SavePickcodeEntries([]storage.PickcodeCacheEntry{
+		{FilePath: "/115/剧集/gone.mkv", Pickcode: "pgone", ParentCID: "1"},
+		{FilePath: "/115/剧集/moved.mkv", Pickcode: "pmoved", ParentCID: "9"},
+	}); err != nil {
+		t.Fatalf("保存 pickcode 失败: %v", err)
+	}
+
+	lister := &fakeLister{dirs: map[string][]cloudEntry{
+		"1": {{Name: "e1.mkv", Pickcode: "pe1"}, {Name: "moved.mkv", Pickcode: "pmoved2"}},
+	}}
+	checker := &cloudChecker{
+		cfg:    &config.Config{Proxy: config.ProxyConfig{Method: "ck", CachePickcode: true}},
+		log:    logger.New(config.LogConfig{Level: "error"}),
+		lister: lister,
+		dirs:   make(map[string]listedDir),
+	}
+
+	if err := checker.check115("/115/剧集/moved.mkv"); err != nil {
+		t.Errorf("目录 CID 失效时应通过路径重新查找, 实际: %v", err)
+	}
+	if err := checker.check115("/115/剧集/gone.mkv"); err != errCloudFileNotFound {
+		t.Errorf("缓存命中但 115 中已删除的文件应报告不存在, 实际: %v", err)
+	}
+	if err := checker.check115("/115/剧集/e1.mkv"); err != nil {
+		t.Errorf("目录中的文件应存在, 实际: %v", err)
+	}
+	if err := checker.check115("/115/电影/a.mkv"); err != errCloudFileNotFound {
+		t.Errorf("目录不存在时应报告文件不存在, 实际: %v", err)
+	}
+
+	// 缓存的 CID 列出一次，失效后通过路径列出一次，之后同一目录不再列出
+	if !reflect.DeepEqual(lister.listed, []string{"9", "1"}) {
+		t.Errorf("目录列出次数错误: %v", lister.listed)
+	}
+	if cache, found := storage.GetPickcodeCache("/115/剧集/moved.mkv"); !found || cache.Pickcode != "pmoved2" || cache.ParentCID != "1" {
+		t.Errorf("重新列出目录后应更新缓存: %+v %v", cache, found)
+	}
+}
@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/helper/pan115"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	driver115 "github.com/SheltonZhu/115driver/pkg/driver"
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+// cookieLoginSession 网页扫码登录会话
+type cookieLoginSession struct {
+	Session *driver115.QRCodeSession
+	App     driver115.LoginApp
+}
+
+// cookieLoginSessions 保存进行中的扫码登录会话，二维码 5 分钟后失效
+var cookieLoginSessions = cache.New(5*time.Minute, 1*time.Minute)
+
+// HandleCookieQRCodeStart 开始 115 Cookie 扫码登录，返回二维码
+func HandleCookieQRCodeStart(c echo.Context, cfg *config.Config, log *logger.Logger) error {
+	appName := c.QueryParam("app")
+	if appName == "" {
+		appName = cfg.Driver115.App
+	}
+
+	app, err := pan115.ParseLoginApp(appName)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": err.Error()})
+	}
+
+	session, err := pan115.StartQRCodeLogin()
+	if err != nil {
+		log.Errorf("开始 115 Cookie 扫码登录失败: %v", err)
+		return c.JSON(502, map[string]string{"error": err.Error()})
+	}
+
+	image, err := session.QRCode()
+	if err != nil {
+		log.Errorf("生成二维码失败: %v", err)
+		return c.JSON(500, map[string]string{"error": "生成二维码失败"})
+	}
+
+	cookieLoginSessions.SetDefault(session.UID, &cookieLoginSession{Session: session, App: app})
+
+	return c.JSON(200, map[string]string{
+		"uid":    session.UID,
+		"app":    string(app),
+		"qrcode": session.QrcodeContent,
+		"image":  "data:image/png;base64," + base64.StdEncoding.EncodeToString(image),
+	})
+}
+
+// HandleCookieQRCodeStatus 查询扫码状态，确认登录后保存 Cookie
+func HandleCookieQRCodeStatus(c echo.Context, log *logger.Logger) error {
+	uid := c.Param("uid")
+
+	value, found := cookieLoginSessions.Get(uid)
+	if !found {
+		return c.JSON(404, map[string]string{"error": "登录会话不存在或已过期"})
+	}
+	loginSession := value.(*cookieLoginSession)
+
+	status, err := pan115.QRCodeStatus(loginSession.Session)
+	if err != nil {
+		log.Errorf("查询 115 扫码状态失败: %v", err)
+		return c.JSON(502, map[string]string{"error": err.Error()})
+	}
+
+	result := "waiting"
+	switch {
+	case status.IsScanned():
+		result = "scanned"
+	case status.IsExpired():
+		result = "expired"
+		cookieLoginSessions.Delete(uid)
+	case status.IsCanceled():
+		result = "canceled"
+		cookieLoginSessions.Delete(uid)
+	case status.IsAllowed():
+		cookieLoginSessions.Delete(uid)
+		if _, err := pan115.FinishQRCodeLogin(loginSession.Session, loginSession.App); err != nil {
+			log.Errorf("115 Cookie 扫码登录失败: %v", err)
+			return c.JSON(502, map[string]string{"error": err.Error()})
+		}
+		log.Infof("🍪 115 Cookie 扫码登录成功，客户端类型: %s", loginSession.App)
+		result = "success"
+	}
+
+	return c.JSON(200, map[string]string{
+		"status":  result,
+		"message": status.Msg,
+	})
+}
+
+// HandleCookieStatus 返回当前 115 Cookie 的状态
+func HandleCookieStatus(c echo.Context, cfg *config.Config) error {
+	cookie, err := storage.ReadCookie()
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	source := "storage"
+	if cookie.Cookie == "" {
+		source = "config"
+		if cfg.Driver115.Cookie == "" {
+			source = ""
+		}
+	}
+
+	return c.JSON(200, map[string]any{
+		"source":          source,
+		"app":             cookie.App,
+		"valid":           cookie.Valid,
+		"updated_at":      cookie.UpdatedAt,
+		"last_checked_at": cookie.LastCheckedAt,
+		"check_error":     cookie.CheckError,
+	})
+}
+
+// HandleCookieCheck 立即校验当前 115 Cookie
+func HandleCookieCheck(c echo.Context, cfg *config.Config, log *logger.Logger) error {
+	err := pan115.CheckStoredCookie(cfg.Driver115.Cookie)
+	if errors.Is(err, pan115.ErrNoCookie) {
+		return c.JSON(404, map[string]string{"error": err.Error()})
+	}
+
+	if err != nil {
+		log.Warnf("115 Cookie 校验失败: %v", err)
+		return c.JSON(200, map[string]any{"valid": false, "error": err.Error()})
+	}
+
+	return c.JSON(200, map[string]any{"valid": true})
+}
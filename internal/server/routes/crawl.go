@@ -0,0 +1,374 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	driver115 "github.com/SheltonZhu/115driver/pkg/driver"
+	sdk115 "github.com/xhofe/115-sdk-go"
+)
+
+// errCloudDirNotFound 115 中不存在要遍历的目录
+var errCloudDirNotFound = errors.New("115 中不存在该目录")
+
+// cloudEntry 115 目录中的一个文件或子目录
+type cloudEntry struct {
+	Name     string
+	ID       string
+	Pickcode string
+	Size     int64
+	SHA1     string
+	IsDir    bool
+}
+
+// cacheEntry 转换为 pickcode 缓存记录
+func (e cloudEntry) cacheEntry(filePath, parentCID string) storage.PickcodeCacheEntry {
+	return storage.PickcodeCacheEntry{
+		FilePath:  filePath,
+		Pickcode:  e.Pickcode,
+		FileID:    e.ID,
+		Size:      e.Size,
+		SHA1:      e.SHA1,
+		ParentCID: parentCID,
+	}
+}
+
+// dirLister 列出 115 目录，ck 方案使用 Cookie，115open 方案使用开放平台 API
+type dirLister interface {
+	DirID(dir string) (string, error)
+	List(ctx context.Context, cid string) ([]cloudEntry, error)
+}
+
+// cookieDirLister 通过 Cookie 列出目录
+type cookieDirLister struct {
+	client *driver115.Pan115Client
+}
+
+func (l *cookieDirLister) DirID(dir string) (string, error) {
+	if dir == "/" {
+		return "0", nil
+	}
+
+	dirRes, err := l.client.DirName2CID(dir)
+	if err != nil {
+		return "", err
+	}
+	// 目录不存在时 115 返回根目录的 CID
+	if string(dirRes.CategoryID) == "0" {
+		return "", errCloudDirNotFound
+	}
+	return string(dirRes.CategoryID), nil
+}
+
+func (l *cookieDirLister) List(ctx context.Context, cid string) ([]cloudEntry, error) {
+	files, err := listDirFiles(l.client, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]cloudEntry, 0, len(files))
+	for _, file := range files {
+		entries = append(entries, cloudEntry{
+			Name:     file.Name,
+			ID:       file.FileID,
+			Pickcode: file.PickCode,
+			Size:     file.Size,
+			SHA1:     file.Sha1,
+			IsDir:    file.IsDirectory,
+		})
+	}
+	return entries, nil
+}
+
+func (l *cookieDirLister) DownloadURL(ctx context.Context, pickcode, userAgent string) (string, error) {
+	info, err := l.client.DownloadWithUA(pickcode, userAgent)
+	if err != nil {
+		return "", err
+	}
+	return info.Url.Url, nil
+}
+
+// dirPageSize 每次列出目录的数量，115 最多返回 1150 个
+const dirPageSize = driver115.MaxDirPageLimit
+
+// listDirFiles 通过 Cookie 分页列出目录中的所有文件和子目录
+// 按实际返回的数量移动 offset，115 返回的数量少于请求的数量时说明已经是最后一页
+func listDirFiles(client *driver115.Pan115Client, cid string) ([]driver115.File, error) {
+	var files []driver115.File
+	for offset := int64(0); ; {
+		page, err := client.ListPage(cid, offset, dirPageSize)
+		if err != nil {
+			return nil, err
+		}
+		if page == nil || len(*page) == 0 {
+			return files, nil
+		}
+
+		files = append(files, *page...)
+		offset += int64(len(*page))
+		if len(*page) < dirPageSize {
+			return files, nil
+		}
+	}
+}
+
+// openDirLister 通过 115 开放平台 API 列出目录
+type openDirLister struct {
+	client *sdk115.Client
+}
+
+func (l *openDirLister) DirID(dir string) (string, error) {
+	if dir == "/" {
+		return "0", nil
+	}
+
+	resp, err := l.Info(context.Background(), dir)
+	if err != nil || resp.FileID == "" {
+		return "", errCloudDirNotFound
+	}
+	return resp.FileID, nil
+}
+
+// Info 按路径获取文件或目录的信息，不需要列出所在目录
+func (l *openDirLister) Info(ctx context.Context, filePath string) (*sdk115.GetFolderInfoResp, error) {
+	var resp sdk115.GetFolderInfoResp
+	_, err := l.client.AuthRequest(ctx, sdk115.ApiFsGetFolderInfo, http.MethodPost, &resp, sdk115.ReqWithForm(map[string]string{
+		"path": filePath,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (l *openDirLister) List(ctx context.Context, cid string) ([]cloudEntry, error) {
+	var entries []cloudEntry
+	for offset := int64(0); ; {
+		resp, err := l.client.GetFiles(ctx, &sdk115.GetFilesReq{CID: cid, Limit: 1150, Offset: offset, ShowDir: true, ASC: true, O: "file_name"})
+		if err != nil {
+			return nil, err
+		}
+		if !resp.State {
+			return nil, fmt.Errorf("115open 列出目录失败: %s", resp.Message)
+		}
+
+		for _, file := range resp.Data {
+			entries = append(entries, cloudEntry{Name: file.Fn, ID: file.Fid, Pickcode: file.Pc, Size: file.FS, SHA1: file.Sha1, IsDir: file.Fc == "0"})
+		}
+
+		offset += int64(len(resp.Data))
+		if len(resp.Data) == 0 || offset >= resp.Count {
+			return entries, nil
+		}
+	}
+}
+
+func (l *openDirLister) DownloadURL(ctx context.Context, pickcode, userAgent string) (string, error) {
+	resp, err := l.client.DownURL(ctx, pickcode, userAgent)
+	if err != nil {
+		return "", err
+	}
+	for _, u := range resp {
+		return u.URL.URL, nil
+	}
+	return "", fmt.Errorf("115open 未返回下载地址")
+}
+
+// CrawlEnabled 判断当前方案是否可以遍历 115 目录，alist 方案不使用 pickcode
+func CrawlEnabled(cfg *config.Config) bool {
+	switch cfg.Proxy.Method {
+	case "ck", "ck+115open", "115open":
+		return true
+	}
+	return false
+}
+
+// newDirLister 按 proxy.method 创建目录列表方式
+func newDirLister(cfg *config.Config) (dirLister, error) {
+	switch cfg.Proxy.Method {
+	case "ck", "ck+115open":
+		client, err := newCookieClient(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("从 Cookie 获取 115 凭证错误: %w", err)
+		}
+		return client, nil
+	case "115open":
+		return newOpenDirLister()
+	default:
+		return nil, fmt.Errorf("%s 方案不使用 pickcode，只支持 ck、ck+115open 和 115open 方案", cfg.Proxy.Method)
+	}
+}
+
+// newOpenDirLister 使用保存的 115open 凭证创建开放平台 API 的目录列表方式
+func newOpenDirLister() (*openDirLister, error) {
+	token115, err := storage.ReadTokens()
+	if err != nil {
+		return nil, fmt.Errorf("读取 115 凭证错误: %w", err)
+	}
+	if token115.RefreshToken == "" {
+		return nil, fmt.Errorf("没有保存 115open 凭证")
+	}
+
+	client := sdk115.New(sdk115.WithRefreshToken(token115.RefreshToken),
+		sdk115.WithAccessToken(token115.AccessToken),
+		sdk115.WithOnRefreshToken(func(s1, s2 string) {
+			storage.UpdateTokens(s2, s1)
+		}))
+	return &openDirLister{client: client}, nil
+}
+
+// CrawlRoots 返回要遍历的 115 目录，dir 为空时返回 proxy.paths 中所有的 real 目录
+// Emby 中的路径按 paths[].real 转换，与播放时查找缓存的路径一致，其他路径视为 115 中的路径
+func CrawlRoots(cfg *config.Config, dir string) ([]string, error) {
+	if dir != "" {
+		if cloudPath, ok := CloudPath(cfg, dir); ok {
+			dir = cloudPath
+		}
+		return []string{path.Clean("/" + dir)}, nil
+	}
+
+	var roots []string
+	seen := make(map[string]bool)
+	for _, p := range cfg.Proxy.Paths {
+		if p.Real == "" || p.Resolver == config.PathResolverLocal {
+			continue
+		}
+		root := path.Clean("/" + p.Real)
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("proxy.paths 中没有配置 real 目录，请使用 --path 指定")
+	}
+	return roots, nil
+}
+
+// underRealPath 判断 115 路径是否在某个 paths[].real 目录下，不在时播放不会查找这些缓存
+func underRealPath(cfg *config.Config, cloudPath string) bool {
+	for _, p := range cfg.Proxy.Paths {
+		if p.Real == "" || p.Resolver == config.PathResolverLocal {
+			continue
+		}
+		realPath := path.Clean("/" + p.Real)
+		if realPath == "/" || cloudPath == realPath || strings.HasPrefix(cloudPath, realPath+"/") || strings.HasPrefix(realPath, cloudPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CrawlOptions 遍历 115 目录树的参数
+type CrawlOptions struct {
+	Interval time.Duration                      // 两次列出目录的间隔，避免被风控
+	Restart  bool                               // 忽略检查点，从根目录重新开始
+	Progress func(crawl *storage.PickcodeCrawl) // 每列出一个目录后调用
+}
+
+// CrawlPickcodeTree 遍历 115 目录树，把所有文件的 pickcode 写入缓存
+// 每列出一个目录就在同一个事务中保存 pickcode 和检查点，中断或失败后再次执行会从未列出的目录继续
+func CrawlPickcodeTree(ctx context.Context, cfg *config.Config, log *logger.Logger, root string, opts CrawlOptions) (*storage.PickcodeCrawl, error) {
+	lister, err := newDirLister(cfg)
+	if err != nil {
+		return nil, storage.NoRetry(err)
+	}
+	return crawlTree(ctx, cfg, log, lister, root, opts)
+}
+
+// crawlTree 使用 lister 遍历目录树
+func crawlTree(ctx context.Context, cfg *config.Config, log *logger.Logger, lister dirLister, root string, opts CrawlOptions) (*storage.PickcodeCrawl, error) {
+	if !cfg.Proxy.CachePickcode {
+		log.Warnf("未开启 proxy.cache_pickcode，播放时不会使用遍历得到的 pickcode 缓存")
+	}
+	if !underRealPath(cfg, root) {
+		log.Warnf("%s 不在 proxy.paths 的 real 目录中，播放时不会使用这些缓存", root)
+	}
+
+	crawl, err := storage.GetPickcodeCrawl(root)
+	if err != nil {
+		return nil, fmt.Errorf("读取遍历检查点失败: %w", err)
+	}
+
+	if crawl == nil || opts.Restart || crawl.Status == storage.CrawlStatusCompleted {
+		cid, err := lister.DirID(root)
+		if err != nil {
+			if errors.Is(err, errCloudDirNotFound) {
+				return nil, storage.NoRetry(fmt.Errorf("115 中不存在目录 %s", root))
+			}
+			return nil, fmt.Errorf("获取目录 %s 的 CID 错误: %w", root, err)
+		}
+
+		crawl, err = storage.StartPickcodeCrawl(root, storage.CrawlDir{Path: root, CID: cid})
+		if err != nil {
+			return nil, fmt.Errorf("保存遍历检查点失败: %w", err)
+		}
+		log.Infof("🕸️ 开始遍历 115 目录: %s", root)
+	} else {
+		log.Infof("🕸️ 从检查点继续遍历 115 目录: %s, 已列出 %d 个目录, 待列出 %d 个目录",
+			root, crawl.Dirs, crawl.PendingDirs)
+	}
+
+	pending, err := crawl.PendingList()
+	if err != nil {
+		return crawl, err
+	}
+
+	start := time.Now()
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return crawl, err
+		}
+
+		dir := pending[len(pending)-1]
+		entries, err := lister.List(ctx, dir.CID)
+		if err != nil {
+			return crawl, fmt.Errorf("列出目录 %s 错误: %w", dir.Path, err)
+		}
+		pending = pending[:len(pending)-1]
+
+		var files []storage.PickcodeCacheEntry
+		var subdirs []storage.CrawlDir
+		for _, entry := range entries {
+			fullPath := path.Join(dir.Path, entry.Name)
+			if entry.IsDir {
+				subdirs = append(subdirs, storage.CrawlDir{Path: fullPath, CID: entry.ID})
+			} else if entry.Pickcode != "" {
+				files = append(files, entry.cacheEntry(fullPath, dir.CID))
+			}
+		}
+
+		// 子目录按名称倒序入栈，遍历时按名称顺序列出
+		sort.Slice(subdirs, func(i, j int) bool { return subdirs[i].Path > subdirs[j].Path })
+		pending = append(pending, subdirs...)
+
+		if err := storage.SavePickcodeCrawlProgress(crawl, pending, files); err != nil {
+			return crawl, fmt.Errorf("保存 pickcode 缓存失败: %w", err)
+		}
+		log.Debugf("🕸️ 已列出目录: %s, 文件: %d, 子目录: %d", dir.Path, len(files), len(subdirs))
+		if opts.Progress != nil {
+			opts.Progress(crawl)
+		}
+
+		if len(pending) > 0 && opts.Interval > 0 {
+			select {
+			case <-ctx.Done():
+				return crawl, ctx.Err()
+			case <-time.After(opts.Interval):
+			}
+		}
+	}
+
+	log.Infof("🕸️ 115 目录遍历完成: %s, 共 %d 个目录, %d 个文件, 本次耗时: %v",
+		root, crawl.Dirs, crawl.Files, time.Since(start).Round(time.Second))
+	return crawl, nil
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+)
+
+// fakeLister 按 CID 返回目录内容，failOn 中的目录第一次列出时返回错误
+type fakeLister struct {
+	dirs   map[string][]cloudEntry
+	failOn map[string]bool
+	listed []string
+}
+
+func (l *fakeLister) DirID(dir string) (string, error) {
+	if dir == "/115/剧集" {
+		return "1", nil
+	}
+	return "", errCloudDirNotFound
+}
+
+func (l *fakeLister) List(ctx context.Context, cid string) ([]cloudEntry, error) {
+	if l.failOn[cid] {
+		delete(l.failOn, cid)
+		return nil, errors.New("请求过于频繁")
+	}
+	l.listed = append(l.listed, cid)
+	return l.dirs[cid], nil
+}
+
+func TestCrawlTreeResume(t *testing.T) {
+	storage.DataDir = t.TempDir()
+	if err := storage.InitDB(); err != nil {
+		t.Fatalf("InitDB 失败: %v", err)
+	}
+
+	cfg := &config.Config{Proxy: config.ProxyConfig{
+		Method:        "ck",
+		CachePickcode: true,
+		Paths:         []config.Path{{Old: "/media", New: "/115", Real: "/115"}},
+	}}
+	log := logger.New(config.LogConfig{Level: "error"})
+
+	lister := &fakeLister{
+		dirs: map[string][]cloudEntry{
+			"1": {
+				{Name: "B", ID: "3", IsDir: true},
+				{Name: "A", ID: "2", IsDir: true},
+			},
+			"2": {{Name: "a1.mkv", ID: "21", Pickcode: "pa1", Size: 100, SHA1: "abc"}},
+			"3": {
+				{Name: "b1.mkv", Pickcode: "pb1"},
+				{Name: "S01", ID: "4", IsDir: true},
+			},
+			"4": {{Name: "e1.mkv", Pickcode: "pe1"}},
+		},
+		failOn: map[string]bool{"3": true},
+	}
+
+	// Emby 路径按 real 转换
+	roots, err := CrawlRoots(cfg, "/media/剧集/")
+	if err != nil || len(roots) != 1 || roots[0] != "/115/剧集" {
+		t.Fatalf("CrawlRoots 错误: %v %v", roots, err)
+	}
+
+	crawl, err := crawlTree(context.Background(), cfg, log, lister, roots[0], CrawlOptions{})
+	if err == nil {
+		t.Fatal("列出目录失败时应返回错误")
+	}
+	if crawl.Status != storage.CrawlStatusRunning || crawl.Dirs != 2 || crawl.PendingDirs != 1 {
+		t.Fatalf("检查点错误: %+v", crawl)
+	}
+
+	// 从检查点继续，不会重新列出已完成的目录
+	crawl, err = crawlTree(context.Background(), cfg, log, lister, roots[0], CrawlOptions{})
+	if err != nil {
+		t.Fatalf("继续遍历失败: %v", err)
+	}
+	if crawl.Status != storage.CrawlStatusCompleted || crawl.Dirs != 4 || crawl.Files != 3 {
+		t.Errorf("遍历结果错误: %+v", crawl)
+	}
+	if want := []string{"1", "2", "3", "4"}; len(lister.listed) != len(want) {
+		t.Errorf("期望列出目录 %v, 实际: %v", want, lister.listed)
+	}
+
+	for path, want := range map[string]string{
+		"/115/剧集/A/a1.mkv":     "pa1",
+		"/115/剧集/B/b1.mkv":     "pb1",
+		"/115/剧集/B/S01/e1.mkv": "pe1",
+	} {
+		if pickcode, _ := storage.GetPickcodeFromCache(path); pickcode != want {
+			t.Errorf("%s 的 pickcode 期望 %s, 实际: %s", path, want, pickcode)
+		}
+	}
+
+	// 文件信息和所在目录的 CID 一起缓存
+	if cache, _ := storage.GetPickcodeCache("/115/剧集/A/a1.mkv"); cache == nil || cache.FileID != "21" || cache.SHA1 != "ABC" || cache.ParentCID != "2" {
+		t.Errorf("缓存的文件信息错误: %+v", cache)
+	}
+
+	if _, err := crawlTree(context.Background(), cfg, log, lister, "/115/不存在", CrawlOptions{}); err == nil {
+		t.Error("目录不存在时应返回错误")
+	}
+}
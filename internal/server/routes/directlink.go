@@ -0,0 +1,210 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/helper"
+	"cinexus/internal/logger"
+	"cinexus/internal/playtrace"
+	"cinexus/internal/server/middleware"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+// 直链接口的路径前缀
+const (
+	pickLinkPrefix = "/cinexus-api/115/pick/"
+	pathLinkPrefix = "/cinexus-api/d"
+)
+
+// pickcodePattern 115 pickcode 只包含字母和数字
+var pickcodePattern = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+
+// PickcodeLinkPath 返回按 pickcode 获取直链的路径
+func PickcodeLinkPath(pickcode string) string {
+	return pickLinkPrefix + pickcode
+}
+
+// EmbyPathLinkPath 返回按 Emby 中的路径获取直链的路径，路径按 proxy.paths 映射
+func EmbyPathLinkPath(embyPath string) string {
+	return pathLinkPrefix + helper.EnsureLeadingSlash(embyPath)
+}
+
+// SignLink 为直链路径生成带签名的链接，ttl 为 0 时永不过期，返回链接和过期时间
+func SignLink(secret, linkPath string, ttl time.Duration) (string, *time.Time) {
+	var expires int64
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := time.Now().Add(ttl)
+		expires, expiresAt = t.Unix(), &t
+	}
+
+	u := url.URL{Path: linkPath, RawQuery: url.Values{
+		"e":    {strconv.FormatInt(expires, 10)},
+		"sign": {middleware.SignPath(secret, linkPath, expires)},
+	}.Encode()}
+	return u.String(), expiresAt
+}
+
+// setupDirectLink 注册直链接口，不经过 Emby，按 pickcode 或 Emby 中的路径解析下载地址后 302
+// 与播放使用相同的解析流程和直链缓存，链接需要通过 link.secret 签名
+func setupDirectLink(api *echo.Group, cfg *config.Config, log *logger.Logger, linkCache *cache.Cache) {
+	signed := middleware.SignedURL(cfg.Link.Secret)
+
+	api.GET("/115/pick/:pickcode", func(c echo.Context) error {
+		pickcode := c.Param("pickcode")
+		if !pickcodePattern.MatchString(pickcode) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "pickcode 格式错误"})
+		}
+
+		return serveDirectLink(c, cfg, log, linkCache, "pickcode:"+pickcode, func() (string, int, error) {
+			link, err := resolvePickcodeLink(c, pickcode, cfg, log)
+			if err != nil {
+				return "", http.StatusBadGateway, err
+			}
+			return link, http.StatusOK, nil
+		})
+	}, signed)
+
+	api.GET("/d/*", func(c echo.Context) error {
+		embyPath := helper.EnsureLeadingSlash(strings.TrimPrefix(c.Request().URL.Path, pathLinkPrefix))
+		matchPathConfig, ok := MatchPathConfig(cfg, embyPath)
+		if !ok {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "路径不在 proxy.paths 中"})
+		}
+		// 本机文件直接提供，不经过直链缓存
+		if matchPathConfig.Resolver == config.PathResolverLocal {
+			localPath, err := LocalFilePath(cfg, embyPath)
+			if err != nil {
+				log.Warnf("【直链】获取本机文件路径失败: %s, 错误: %v", embyPath, err)
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "文件不存在"})
+			}
+			return serveLocalFile(c, localPath, log)
+		}
+		c.Set(playPathContextKey, embyPath)
+
+		return serveDirectLink(c, cfg, log, linkCache, embyPath, func() (string, int, error) {
+			traceFrom(c).SetPath(embyPath)
+			link, skip := ResolvePlayPath(c, embyPath, cfg, log)
+			if skip {
+				return "", http.StatusBadGateway, fmt.Errorf("获取 %s 的直链失败", embyPath)
+			}
+			return link, http.StatusOK, nil
+		})
+	}, signed)
+}
+
+// serveDirectLink 优先使用直链缓存，未缓存时调用 resolve 解析下载地址并记录解析过程
+func serveDirectLink(c echo.Context, cfg *config.Config, log *logger.Logger, linkCache *cache.Cache, traceID string, resolve func() (string, int, error)) error {
+	cacheKey := helper.Md5CacheKey(fmt.Sprintf("%s-%s", c.Request().URL.Path, c.Request().UserAgent()))
+	if link, found := linkCache.Get(cacheKey); found {
+		return c.Redirect(http.StatusFound, link.(cachedLink).URL)
+	}
+
+	start := time.Now()
+	trace := playtrace.Default().Start(traceID, cfg.Proxy.Method, c.Request().UserAgent())
+	c.Set(traceContextKey, trace)
+
+	link, status, err := resolve()
+	trace.Finish(link, err != nil)
+	if err != nil {
+		log.Warnf("【直链】解析失败: %s, 错误: %v", traceID, err)
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	log.Infof("【直链】解析完成: %s, 耗时: %v", traceID, time.Since(start))
+	linkCache.Set(cacheKey, newCachedLink(c, link), cache.DefaultExpiration)
+	return c.Redirect(http.StatusFound, link)
+}
+
+// resolvePickcodeLink 按 pickcode 获取下载地址，ck 方案先使用 Cookie，失败时降级到 115open
+func resolvePickcodeLink(c echo.Context, pickcode string, cfg *config.Config, log *logger.Logger) (string, error) {
+	var cookie fileDownloader
+	switch cfg.Proxy.Method {
+	case "ck":
+		client, err := newCookieClient(cfg)
+		if err != nil {
+			return "", fmt.Errorf("从 Cookie 获取 115 凭证错误: %w", err)
+		}
+		cookie = client
+	case "ck+115open", "115open":
+	default:
+		return "", fmt.Errorf("%s 方案不支持按 pickcode 获取直链", cfg.Proxy.Method)
+	}
+
+	return downloadURLByPickcode(c, cookie, pickcode, log, cfg)
+}
+
+// resolveStrmLink 解析 .strm 中本服务生成的直链，直接使用相同的解析方案，不需要再经过一次 302
+// 签名不正确的链接不是本服务生成的，返回 false；Emby 已校验用户，不检查链接是否过期
+func resolveStrmLink(c echo.Context, rawURL string, cfg *config.Config, log *logger.Logger) (string, bool, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || cfg.Link.Secret == "" {
+		return "", false, false
+	}
+	if _, ok := middleware.VerifyPathSignature(cfg.Link.Secret, u.Path, u.Query()); !ok {
+		return "", false, false
+	}
+
+	switch {
+	case strings.HasPrefix(u.Path, pickLinkPrefix):
+		pickcode := strings.TrimPrefix(u.Path, pickLinkPrefix)
+		link, err := resolvePickcodeLink(c, pickcode, cfg, log)
+		if err != nil {
+			log.Errorf("按 pickcode 获取直链失败，交给 Emby 处理: %v", err)
+			traceFrom(c).Error(err)
+			traceFrom(c).Fallback("按 pickcode 获取直链失败，交给 Emby 处理")
+			return "", true, true
+		}
+		return link, false, true
+	case strings.HasPrefix(u.Path, pathLinkPrefix+"/"):
+		embyPath := strings.TrimPrefix(u.Path, pathLinkPrefix)
+		traceFrom(c).SetPath(embyPath)
+		c.Set(playPathContextKey, embyPath)
+		link, skip := ResolvePlayPath(c, embyPath, cfg, log)
+		return link, skip, true
+	}
+	return "", false, false
+}
+
+// HandleLinkSign 生成带签名的直链，?pickcode= 或 ?path=（Emby 中的路径），?expire= 为有效期（小时），默认使用 link.expire
+func HandleLinkSign(c echo.Context, cfg *config.Config) error {
+	if cfg.Link.Secret == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "直链接口未启用，请配置 link.secret"})
+	}
+
+	expire := cfg.Link.Expire
+	if value := c.QueryParam("expire"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "expire 必须是非负整数"})
+		}
+		expire = hours
+	}
+
+	var linkPath string
+	switch pickcode, embyPath := c.QueryParam("pickcode"), c.QueryParam("path"); {
+	case pickcode != "":
+		if !pickcodePattern.MatchString(pickcode) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "pickcode 格式错误"})
+		}
+		linkPath = PickcodeLinkPath(pickcode)
+	case embyPath != "":
+		if _, ok := MatchPathConfig(cfg, helper.EnsureLeadingSlash(embyPath)); !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "路径不在 proxy.paths 中"})
+		}
+		linkPath = EmbyPathLinkPath(embyPath)
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "必须指定 pickcode 或 path"})
+	}
+
+	link, expiresAt := SignLink(cfg.Link.Secret, linkPath, time.Duration(expire)*time.Hour)
+	return c.JSON(http.StatusOK, map[string]any{"url": link, "expires_at": expiresAt})
+}
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+func TestDirectLinkByPath(t *testing.T) {
+	// 模拟 AList 的 /d 接口，302 到下载地址
+	var calls int32
+	alistServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path != "/d/115/电影/a.mkv" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, "https://cdn.example.com/a.mkv", http.StatusFound)
+	}))
+	defer alistServer.Close()
+
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{Method: "alist", Paths: []config.Path{{Old: "/media", New: "/115", Real: "/115"}}},
+		Alist: config.AlistConfig{URL: alistServer.URL},
+		Link:  config.LinkConfig{Secret: "secret"},
+	}
+	log := logger.New(config.LogConfig{Level: "error"})
+
+	e := echo.New()
+	setupDirectLink(e.Group("/cinexus-api"), cfg, log, cache.New(time.Minute, time.Minute))
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	link, expiresAt := SignLink(cfg.Link.Secret, EmbyPathLinkPath("/media/电影/a.mkv"), time.Hour)
+	if expiresAt == nil {
+		t.Fatal("设置了有效期时应返回过期时间")
+	}
+	for i := 0; i < 2; i++ {
+		rec := get(link)
+		if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://cdn.example.com/a.mkv" {
+			t.Fatalf("期望 302 到下载地址, 实际: %d %s %s", rec.Code, rec.Header().Get("Location"), rec.Body.String())
+		}
+	}
+	// 第二次请求使用直链缓存
+	if calls != 1 {
+		t.Errorf("期望请求 AList 1 次, 实际: %d", calls)
+	}
+
+	if rec := get(link + "0"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("签名错误时期望 401, 实际: %d", rec.Code)
+	}
+
+	// 签名覆盖路径，换成其他文件后校验失败
+	u, _ := url.Parse(link)
+	if rec := get(EmbyPathLinkPath("/media/电影/b.mkv") + "?" + u.RawQuery); rec.Code != http.StatusUnauthorized {
+		t.Errorf("修改路径后期望 401, 实际: %d", rec.Code)
+	}
+
+	// .strm 中本服务生成的直链直接解析，不需要再经过一次 302
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/Videos/1/stream", nil), httptest.NewRecorder())
+	if resolved, skip, ok := resolveStrmLink(c, "http://proxy:8080"+link, cfg, log); !ok || skip || resolved != "https://cdn.example.com/a.mkv" {
+		t.Errorf("解析 .strm 直链错误: %s %v %v", resolved, skip, ok)
+	}
+	if _, _, ok := resolveStrmLink(c, "http://proxy:8080"+EmbyPathLinkPath("/media/电影/a.mkv")+"?e=0&sign=x", cfg, log); ok {
+		t.Error("签名错误的链接不应被当成本服务的直链")
+	}
+
+	unmapped, _ := SignLink(cfg.Link.Secret, EmbyPathLinkPath("/other/a.mkv"), 0)
+	if rec := get(unmapped); rec.Code != http.StatusNotFound {
+		t.Errorf("路径不在 proxy.paths 中时期望 404, 实际: %d", rec.Code)
+	}
+}
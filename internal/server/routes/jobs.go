@@ -0,0 +1,246 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/helper"
+	"cinexus/internal/helper/emby"
+	"cinexus/internal/logger"
+	"cinexus/internal/scheduler"
+	"cinexus/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// missingMediaInfoPageSize 查找缺少媒体信息的项目时每页请求的数量
+const missingMediaInfoPageSize = 200
+
+// EnqueueMissingMediaInfo 分页遍历媒体库中的电影和剧集，把缺少媒体信息的项目以低优先级加入队列
+func EnqueueMissingMediaInfo(ctx context.Context, cfg *config.Config) (string, error) {
+	taskQueue := storage.GetTaskQueue()
+	if taskQueue == nil {
+		return "", fmt.Errorf("任务队列未初始化")
+	}
+
+	client := emby.New(cfg)
+	scanned, missing, added := 0, 0, 0
+
+	for start := 0; ; start += missingMediaInfoPageSize {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		res, err := client.GetItems("", map[string]string{
+			"Recursive":        "true",
+			"IncludeItemTypes": "Movie,Episode",
+			"Fields":           "MediaSources,Path",
+			"SortBy":           "SortName",
+			"StartIndex":       strconv.Itoa(start),
+			"Limit":            strconv.Itoa(missingMediaInfoPageSize),
+		})
+		if err != nil {
+			return "", fmt.Errorf("获取媒体列表失败: %w", err)
+		}
+
+		items, _ := res["Items"].([]any)
+		var itemIDs []string
+		for _, it := range items {
+			item, _ := it.(map[string]any)
+			itemID, _ := item["Id"].(string)
+			if itemID == "" {
+				continue
+			}
+			scanned++
+
+			mediaSources, _ := item["MediaSources"].([]any)
+			if len(mediaSources) == 0 {
+				continue
+			}
+			mediaSource, _ := mediaSources[0].(map[string]any)
+			if helper.NeedMediaStreams(mediaSource) {
+				itemIDs = append(itemIDs, itemID)
+			}
+		}
+
+		if len(itemIDs) > 0 {
+			missing += len(itemIDs)
+			n, _, err := taskQueue.AddTypedTasksWithPriority(storage.TaskTypePlaybackInfo, itemIDs, storage.TaskPriorityLow)
+			if err != nil {
+				return "", fmt.Errorf("添加任务失败: %w", err)
+			}
+			added += n
+		}
+
+		if len(items) < missingMediaInfoPageSize {
+			break
+		}
+	}
+
+	return fmt.Sprintf("扫描 %d 个项目，缺少媒体信息 %d 个，新加入队列 %d 个", scanned, missing, added), nil
+}
+
+// enqueuePageSize 一次加入队列的任务数，大量任务分页加入
+const enqueuePageSize = 200
+
+// EnqueueInPages 把大量项目分页加入队列，返回新增和跳过的数量，出错时已加入的任务会保留
+func EnqueueInPages(ctx context.Context, taskQueue *storage.PersistentTaskQueue, taskType storage.TaskType, itemIDs []string, priority storage.TaskPriority) (added int, skipped int, err error) {
+	for start := 0; start < len(itemIDs); start += enqueuePageSize {
+		if err := ctx.Err(); err != nil {
+			return added, skipped, err
+		}
+
+		end := min(start+enqueuePageSize, len(itemIDs))
+		pageAdded, pageSkipped, err := taskQueue.AddTypedTasksWithPriority(taskType, itemIDs[start:end], priority)
+		if err != nil {
+			return added, skipped, err
+		}
+		added += pageAdded
+		skipped += pageSkipped
+	}
+	return added, skipped, nil
+}
+
+// EnqueuePickcodeValidation 按目录把 pickcode 缓存的校验任务以低优先级加入队列，每个目录只需要列出一次
+func EnqueuePickcodeValidation(ctx context.Context) (string, error) {
+	taskQueue := storage.GetTaskQueue()
+	if taskQueue == nil {
+		return "", fmt.Errorf("任务队列未初始化")
+	}
+
+	dirs, err := storage.ListPickcodeDirs()
+	if err != nil {
+		return "", fmt.Errorf("获取 pickcode 缓存目录失败: %w", err)
+	}
+
+	added, skipped, err := EnqueueInPages(ctx, taskQueue, storage.TaskTypeValidatePickcode, dirs, storage.TaskPriorityLow)
+	if err != nil {
+		return "", fmt.Errorf("添加任务失败: %w", err)
+	}
+
+	return fmt.Sprintf("共 %d 个目录，新加入队列 %d 个，已在队列中 %d 个", len(dirs), added, skipped), nil
+}
+
+// pickcode 抽样校验的参数
+const (
+	pickcodeVerifySample = 200                // 每次抽取的缓存数
+	pickcodeVerifyAge    = 7 * 24 * time.Hour // 超过该时间没有确认过的缓存才会被抽取
+)
+
+// EnqueuePickcodeVerification 抽取最久没有确认过的 pickcode 缓存，把它们所在的目录以低优先级加入校验队列
+// 与按周校验所有目录的 pickcode-validate 相比，每次只列出少量目录，可以更频繁地执行
+func EnqueuePickcodeVerification(ctx context.Context) (string, error) {
+	taskQueue := storage.GetTaskQueue()
+	if taskQueue == nil {
+		return "", fmt.Errorf("任务队列未初始化")
+	}
+
+	dirs, err := storage.ListUnverifiedPickcodeDirs(pickcodeVerifyAge, pickcodeVerifySample)
+	if err != nil {
+		return "", fmt.Errorf("抽取 pickcode 缓存失败: %w", err)
+	}
+	if len(dirs) == 0 {
+		return "没有需要校验的 pickcode 缓存", nil
+	}
+
+	added, skipped, err := taskQueue.AddTypedTasksWithPriority(storage.TaskTypeValidatePickcode, dirs, storage.TaskPriorityLow)
+	if err != nil {
+		return "", fmt.Errorf("添加任务失败: %w", err)
+	}
+
+	return fmt.Sprintf("抽取 %d 个目录，新加入队列 %d 个，已在队列中 %d 个", len(dirs), added, skipped), nil
+}
+
+// ValidatePickcodeDir 列出 115 目录校验该目录的 pickcode 缓存，删除已不存在的文件、更新已变化的 pickcode
+// 目录中仍然存在且 pickcode 没有变化的缓存会记录确认时间
+func ValidatePickcodeDir(ctx context.Context, dir string, cfg *config.Config, log *logger.Logger) error {
+	caches, err := storage.ListPickcodesInDir(dir)
+	if err != nil {
+		return fmt.Errorf("获取目录 %s 的 pickcode 缓存失败: %w", dir, err)
+	}
+	if len(caches) == 0 {
+		return nil
+	}
+
+	lister, err := newDirLister(cfg)
+	if err != nil {
+		return storage.NoRetry(err)
+	}
+
+	current := make(map[string]cloudEntry)
+	cid, err := lister.DirID(dir)
+	switch {
+	case errors.Is(err, errCloudDirNotFound):
+		// 目录已不存在，删除其中所有文件的缓存
+	case err != nil:
+		return fmt.Errorf("获取目录 %s 的 CID 错误: %w", dir, err)
+	default:
+		entries, err := lister.List(ctx, cid)
+		if err != nil {
+			return fmt.Errorf("列出目录 %s 错误: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir {
+				current[entry.Name] = entry
+			}
+		}
+	}
+
+	deleted, updated := 0, 0
+	var existing []storage.PickcodeCacheEntry
+	for _, cache := range caches {
+		entry, exists := current[path.Base(cache.FilePath)]
+		if !exists {
+			if err := storage.DeletePickcodeFromCache(cache.FilePath); err != nil {
+				return fmt.Errorf("删除 pickcode 缓存失败: %w", err)
+			}
+			deleted++
+			continue
+		}
+		if entry.Pickcode != cache.Pickcode {
+			updated++
+		}
+		// 仍然存在的文件按目录列表更新，同时补全旧缓存中没有的文件 ID、大小、SHA1 和目录 CID
+		existing = append(existing, entry.cacheEntry(cache.FilePath, cid))
+	}
+
+	if _, err := storage.SavePickcodeEntries(existing); err != nil {
+		return fmt.Errorf("更新 pickcode 缓存失败: %w", err)
+	}
+
+	if deleted > 0 || updated > 0 {
+		log.Infof("🧹 pickcode 缓存校验完成: %s, 共 %d 个, 删除: %d, 更新: %d", dir, len(caches), deleted, updated)
+	}
+	return nil
+}
+
+// HandleJobsList 列出定时任务及最近一次执行的状态
+func HandleJobsList(c echo.Context, jobs *scheduler.Scheduler) error {
+	if jobs == nil {
+		return c.JSON(http.StatusOK, map[string]any{"enabled": false, "jobs": []scheduler.JobStatus{}})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"enabled": true, "jobs": jobs.Status()})
+}
+
+// HandleJobRun 立即把定时任务加入队列
+func HandleJobRun(c echo.Context, jobs *scheduler.Scheduler, log *logger.Logger) error {
+	if jobs == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "定时任务未启用"})
+	}
+
+	if err := jobs.Trigger(c.Param("name")); err != nil {
+		if errors.Is(err, scheduler.ErrJobNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+		}
+		log.Warnf("手动执行定时任务失败: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{"message": "ok", "queued_at": time.Now()})
+}
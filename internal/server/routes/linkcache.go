@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+// cachedLink 直链缓存条目，记录来源项目和路径，便于在媒体删除或更新时失效
+type cachedLink struct {
+	URL    string
+	ItemID string
+	Path   string
+}
+
+// 播放项目 ID 和 Emby 播放路径在 echo.Context 中的键
+const (
+	playItemContextKey = "cinexus.playitem"
+	playPathContextKey = "cinexus.playpath"
+)
+
+// newCachedLink 根据当前播放请求创建直链缓存条目
+func newCachedLink(c echo.Context, url string) cachedLink {
+	itemID, _ := c.Get(playItemContextKey).(string)
+	path, _ := c.Get(playPathContextKey).(string)
+	return cachedLink{URL: url, ItemID: itemID, Path: path}
+}
+
+// purgeLinkCache 删除指定项目或路径下的直链缓存，itemID、path 为空时忽略对应条件，返回删除的数量
+func purgeLinkCache(linkCache *cache.Cache, itemID, path string) int {
+	prefix := strings.TrimRight(path, "/") + "/"
+
+	deleted := 0
+	for key, item := range linkCache.Items() {
+		link, ok := item.Object.(cachedLink)
+		if !ok {
+			continue
+		}
+
+		match := itemID != "" && link.ItemID == itemID
+		if path != "" && (link.Path == path || strings.HasPrefix(link.Path, prefix)) {
+			match = true
+		}
+
+		if match {
+			linkCache.Delete(key)
+			deleted++
+		}
+	}
+
+	return deleted
+}
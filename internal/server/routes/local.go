@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// localFileContextKey 播放路径映射到本机文件时，本机路径在 echo.Context 中的键
+const localFileContextKey = "cinexus.localfile"
+
+var errLocalOutsideRoot = errors.New("本机路径不在 proxy.local_root 中")
+
+// LocalFilePath 按 resolver 为 local 的路径映射把 Emby 路径转换为本机路径
+// 结果和其中的符号链接都必须在 proxy.local_root 中，避免通过 .. 或符号链接访问其他文件
+func LocalFilePath(cfg *config.Config, embyPath string) (string, error) {
+	matchPathConfig, ok := MatchPathConfig(cfg, embyPath)
+	if !ok || matchPathConfig.Resolver != config.PathResolverLocal {
+		return "", fmt.Errorf("路径没有映射到本机: %s", embyPath)
+	}
+	if cfg.Proxy.LocalRoot == "" {
+		return "", errLocalOutsideRoot
+	}
+
+	localPath := filepath.Clean(filepath.FromSlash(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1)))
+	if !withinRoot(cfg.Proxy.LocalRoot, localPath) {
+		return "", errLocalOutsideRoot
+	}
+
+	root, err := filepath.EvalSymlinks(cfg.Proxy.LocalRoot)
+	if err != nil {
+		return "", fmt.Errorf("解析 proxy.local_root 错误: %w", err)
+	}
+	realPath, err := filepath.EvalSymlinks(localPath)
+	if err != nil {
+		return "", err
+	}
+	if !withinRoot(root, realPath) {
+		return "", errLocalOutsideRoot
+	}
+	return realPath, nil
+}
+
+// withinRoot 判断 path 是否是 root 或在 root 中
+func withinRoot(root, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// localFileFrom 获取当前请求要直接提供的本机文件
+func localFileFrom(c echo.Context) (string, bool) {
+	localPath, ok := c.Get(localFileContextKey).(string)
+	return localPath, ok && localPath != ""
+}
+
+// serveLocalFile 直接提供本机文件，支持 Range、ETag 和 Last-Modified，MIME 类型按扩展名判断
+func serveLocalFile(c echo.Context, localPath string, log *logger.Logger) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		log.Warnf("打开本机文件失败: %s, 错误: %v", localPath, err)
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "文件不存在"})
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "文件不存在"})
+	}
+
+	log.Infof("【EMBY PROXY】直接提供本机文件: %s, Range: %s", localPath, c.Request().Header.Get("Range"))
+	c.Response().Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(sendfileResponse{c.Response()}, c.Request(), info.Name(), info.ModTime(), file)
+	return nil
+}
+
+// sendfileResponse 让 http.ServeContent 的复制经过底层 ResponseWriter 的 ReadFrom，使 *os.File 可以使用 sendfile
+type sendfileResponse struct {
+	*echo.Response
+}
+
+func (r sendfileResponse) ReadFrom(src io.Reader) (int64, error) {
+	if !r.Committed {
+		r.WriteHeader(http.StatusOK)
+	}
+	if rf, ok := r.Writer.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(src)
+		r.Size += n
+		return n, err
+	}
+	return io.Copy(struct{ io.Writer }{r.Response}, src)
+}
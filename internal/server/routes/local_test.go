@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+)
+
+func TestServeLocalFile(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "media")
+	os.MkdirAll(filepath.Join(root, "电影"), 0755)
+	os.WriteFile(filepath.Join(root, "电影", "a.mp4"), []byte("0123456789"), 0644)
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+	// 指向根目录外的符号链接
+	os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "电影", "link.mp4"))
+
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{
+			Paths:     []config.Path{{Old: "/data", New: root, Resolver: config.PathResolverLocal}},
+			LocalRoot: root,
+		},
+		Link: config.LinkConfig{Secret: "secret"},
+	}
+	log := logger.New(config.LogConfig{Level: "error"})
+
+	if err := cfg.Proxy.Paths[0].Validate(cfg.Proxy.LocalRoot); err != nil {
+		t.Fatalf("路径映射校验失败: %v", err)
+	}
+	if err := (config.Path{Old: "/data", New: dir, Resolver: config.PathResolverLocal}).Validate(root); err == nil {
+		t.Error("local_root 之外的 new 应校验失败")
+	}
+
+	if _, err := LocalFilePath(cfg, "/data/../secret.txt"); err == nil {
+		t.Error("通过 .. 访问根目录外的文件应失败")
+	}
+	if _, err := LocalFilePath(cfg, "/data/电影/link.mp4"); err == nil {
+		t.Error("通过符号链接访问根目录外的文件应失败")
+	}
+
+	e := echo.New()
+	setupDirectLink(e.Group("/cinexus-api"), cfg, log, cache.New(time.Minute, time.Minute))
+	link, _ := SignLink(cfg.Link.Secret, EmbyPathLinkPath("/data/电影/a.mp4"), 0)
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, link, nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" || rec.Header().Get("Content-Type") != "video/mp4" {
+		t.Fatalf("期望返回完整文件, 实际: %d %s %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Header().Get("Last-Modified") == "" {
+		t.Error("应返回 ETag 和 Last-Modified")
+	}
+
+	if rec := get("Range", "bytes=2-5"); rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+		t.Errorf("Range 请求错误: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := get("If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("ETag 未变化时期望 304, 实际: %d", rec.Code)
+	}
+
+	link, _ = SignLink(cfg.Link.Secret, EmbyPathLinkPath("/data/电影/link.mp4"), 0)
+	if rec := get("", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("根目录外的文件期望 404, 实际: %d", rec.Code)
+	}
+}
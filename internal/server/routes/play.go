@@ -2,20 +2,25 @@ package routes
 
 import (
 	"cinexus/internal/config"
+	"cinexus/internal/cookiechecker"
 	"cinexus/internal/helper"
 	"cinexus/internal/helper/alist"
+	"cinexus/internal/helper/pan115"
 	"cinexus/internal/logger"
+	"cinexus/internal/notify"
+	"cinexus/internal/playtrace"
 	"cinexus/internal/storage"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
-	driver115 "github.com/SheltonZhu/115driver/pkg/driver"
 	"github.com/labstack/echo/v4"
 	sdk115 "github.com/xhofe/115-sdk-go"
 )
@@ -46,30 +51,80 @@ func ProxyPlay(c echo.Context, proxy *httputil.ReverseProxy, cfg *config.Config,
 		log.Infof("【EMBY PROXY】ProxyPlay 执行时间: %v", duration)
 	}()
 
-	return proxyPlayInternal(c, cfg, log)
+	// 记录解析过程，供管理面板查看
+	trace := playtrace.Default().Start(matches[1], cfg.Proxy.Method, c.Request().UserAgent())
+	c.Set(traceContextKey, trace)
+	c.Set(playItemContextKey, matches[1])
+
+	url, skip := proxyPlayInternal(c, cfg, log)
+	if localPath, ok := localFileFrom(c); ok {
+		trace.Finish(localPath, false)
+	} else {
+		trace.Finish(url, skip)
+	}
+	return url, skip
+}
+
+// traceContextKey 播放解析记录在 echo.Context 中的键
+const traceContextKey = "cinexus.playtrace"
+
+// traceFrom 获取当前请求的播放解析记录，未记录时返回 nil
+func traceFrom(c echo.Context) *playtrace.Trace {
+	trace, _ := c.Get(traceContextKey).(*playtrace.Trace)
+	return trace
+}
+
+// recordStep 输出步骤耗时调试日志，并记录到播放解析记录
+func recordStep(c echo.Context, log *logger.Logger, step string, start time.Time) {
+	duration := time.Since(start)
+	log.Debugf("【EMBY PROXY】%s耗时: %v", step, duration)
+	traceFrom(c).Step(step, duration)
 }
 
 func proxyPlayInternal(c echo.Context, cfg *config.Config, log *logger.Logger) (string, bool) {
 	stepStart := time.Now()
 
 	itemInfoUri, itemId, etag, mediaSourceId, apiKey := helper.GetItemPathInfo(c, cfg)
-	log.Debugf("【EMBY PROXY】步骤1 - 解析请求参数耗时: %v", time.Since(stepStart))
+	recordStep(c, log, "步骤1 - 解析请求参数", stepStart)
 
 	stepStart = time.Now()
 	embyRes, err := helper.GetEmbyItems(itemInfoUri, itemId, etag, mediaSourceId, apiKey)
 	if err != nil {
 		log.Errorf("获取 EmbyItems 错误: %v", err)
+		traceFrom(c).Error(err)
 		return "", true
 	}
-	log.Debugf("【EMBY PROXY】步骤2 - 获取EmbyItems耗时: %v", time.Since(stepStart))
+	recordStep(c, log, "步骤2 - 获取EmbyItems", stepStart)
+
+	_, url, skip := resolveItemPath(c, embyRes.Path, cfg, log)
+	return url, skip
+}
+
+// resolveItemPath 解析 Emby 项目的路径，返回实际使用的路径、直链以及是否跳过，播放和管理 API 的试解析共用
+func resolveItemPath(c echo.Context, itemPath string, cfg *config.Config, log *logger.Logger) (string, string, bool) {
+	// .strm 媒体的路径是链接，不能按本地路径处理
+	if isHTTPURL(itemPath) {
+		traceFrom(c).SetPath(itemPath)
+		log.Infof("【EMBY PROXY】Emby 原地址为链接: %s", itemPath)
+		url, skip := resolveURLPath(c, itemPath, cfg, log)
+		return itemPath, url, skip
+	}
 
 	// EMBY 的播放地址, 兼容 Windows 的 Emby 路径
-	embyPlayPath := helper.EnsureLeadingSlash(embyRes.Path)
+	embyPlayPath := helper.EnsureLeadingSlash(itemPath)
+	traceFrom(c).SetPath(embyPlayPath)
+	c.Set(playPathContextKey, embyPlayPath)
 
 	// log.Infof("【EMBY PROXY】Request URI: %s", currentURI)
 	log.Infof("【EMBY PROXY】Emby 原地址: %s", embyPlayPath)
 
-	stepStart = time.Now()
+	url, skip := ResolvePlayPath(c, embyPlayPath, cfg, log)
+	return embyPlayPath, url, skip
+}
+
+// ResolvePlayPath 通过路径映射和配置的 302 方式解析 Emby 播放路径，返回直链以及是否跳过（交给 Emby 处理）
+func ResolvePlayPath(c echo.Context, embyPlayPath string, cfg *config.Config, log *logger.Logger) (string, bool) {
+	stepStart := time.Now()
 	originalHeaders := make(map[string]string)
 	for key, value := range c.Request().Header {
 		if len(value) > 0 {
@@ -79,28 +134,33 @@ func proxyPlayInternal(c echo.Context, cfg *config.Config, log *logger.Logger) (
 
 	// 判断 embyPlayPath 是否是 alist url，如果是进行代理
 	if strings.HasPrefix(embyPlayPath, cfg.Alist.URL) {
-		log.Debugf("【EMBY PROXY】步骤3 - 检测为Alist路径，准备处理耗时: %v", time.Since(stepStart))
+		recordStep(c, log, "步骤3 - 检测为Alist路径，准备处理", stepStart)
 		return GetAlistRedirectURL(embyPlayPath, log, cfg, originalHeaders)
 	}
 
 	// 匹配 embyPlayPath 是否在 cfg.Proxy.Paths 中，如果存在，则替换为 cfg.Proxy.Paths 中的 new
 	// 不存在 old 开头的说明不需要代理
-	needProxy := false
-	matchPathConfig := config.Path{}
-	for _, path := range cfg.Proxy.Paths {
-		if strings.HasPrefix(embyPlayPath, path.Old) {
-			matchPathConfig = path
-			needProxy = true
-			break
-		}
-	}
-
+	matchPathConfig, needProxy := MatchPathConfig(cfg, embyPlayPath)
 	if !needProxy {
-		log.Debugf("【EMBY PROXY】步骤3 - 路径匹配检查，无需代理耗时: %v", time.Since(stepStart))
+		recordStep(c, log, "步骤3 - 路径匹配检查，无需代理", stepStart)
 		return "", true
 	}
 
-	log.Debugf("【EMBY PROXY】步骤3 - 路径匹配检查耗时: %v", time.Since(stepStart))
+	recordStep(c, log, "步骤3 - 路径匹配检查", stepStart)
+
+	// 本机文件由本服务直接提供，不需要 302
+	if matchPathConfig.Resolver == config.PathResolverLocal {
+		localPath, err := LocalFilePath(cfg, embyPlayPath)
+		if err != nil {
+			log.Warnf("获取本机文件路径失败，交给 Emby 处理: %v", err)
+			traceFrom(c).Error(err)
+			traceFrom(c).Fallback("获取本机文件路径失败，交给 Emby 处理")
+			return "", true
+		}
+		c.Set(localFileContextKey, localPath)
+		recordStep(c, log, "步骤4 - 映射到本机文件", stepStart)
+		return "", true
+	}
 
 	if cfg.Proxy.Method == "alist" {
 		embyPlayPath = strings.Replace(embyPlayPath, matchPathConfig.Old, matchPathConfig.New, 1)
@@ -117,9 +177,48 @@ func proxyPlayInternal(c echo.Context, cfg *config.Config, log *logger.Logger) (
 	}
 
 	log.Warnln("不支持的代理方法")
+	traceFrom(c).Fallback("不支持的代理方法，交给 Emby 处理")
 	return "", true
 }
 
+// isHTTPURL 判断 Emby 中的路径是否是链接，.strm 媒体的路径是其中的链接
+func isHTTPURL(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// MatchPathConfig 查找 Emby 路径对应的路径映射，不存在时说明不需要代理
+func MatchPathConfig(cfg *config.Config, embyPath string) (config.Path, bool) {
+	for _, path := range cfg.Proxy.Paths {
+		if strings.HasPrefix(embyPath, path.Old) {
+			return path, true
+		}
+	}
+	return config.Path{}, false
+}
+
+// CloudPath 按路径映射把 Emby 路径转换为 115 网盘中的真实路径，与播放时的规则一致，本机文件返回 false
+func CloudPath(cfg *config.Config, embyPath string) (string, bool) {
+	matchPathConfig, ok := MatchPathConfig(cfg, embyPath)
+	if !ok || matchPathConfig.Resolver == config.PathResolverLocal {
+		return "", false
+	}
+	return strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.Real, 1), true
+}
+
+// cacheDirPickcodes 把目录下所有文件的 pickcode、文件 ID、大小、SHA1 和目录 CID 保存到缓存，返回保存的数量
+// 目录列表是最新的，已缓存的文件也会被覆盖
+func cacheDirPickcodes(dirPath, dirID string, entries []cloudEntry) (int64, error) {
+	caches := make([]storage.PickcodeCacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+		caches = append(caches, entry.cacheEntry(filepath.Join(dirPath, entry.Name), dirID))
+	}
+	return storage.SavePickcodeEntries(caches)
+}
+
 // 通过 Alist 链接直接获取 302 重定向地址
 func GetAlistRedirectURL(alistPath string, log *logger.Logger, cfg *config.Config, originalHeaders map[string]string) (string, bool) {
 	stepStart := time.Now()
@@ -149,23 +248,27 @@ func GetAlistRedirectURL(alistPath string, log *logger.Logger, cfg *config.Confi
 func CKAnd115Open(c echo.Context, embyPath string, log *logger.Logger, cfg *config.Config, originalHeaders map[string]string, matchPathConfig config.Path) (string, bool) {
 	stepStart := time.Now()
 
-	cr := &driver115.Credential{}
 	embyPlayPath := embyPath
 
-	err := cr.FromCookie(cfg.Driver115.Cookie)
+	// 优先使用扫码登录保存的 Cookie，其次使用配置文件中的 Cookie
+	client, err := newCookieClient(cfg)
 	if err != nil {
 		log.Errorf("从 Cookie 获取 115 凭证错误: %v", err)
-		// TODO 发起通知
+		traceFrom(c).Error(err)
+		traceFrom(c).Fallback("115 Cookie 无效，降级到 AList 302 方案")
+		notify.Send(notify.EventCookieInvalid, "115 Cookie 无效", fmt.Sprintf("从 Cookie 获取 115 凭证错误，播放已降级到 AList 302 方案: %v", err))
 		// 降级到 AList 302 方案
 		embyPlayPath = strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1)
 
 		return GetAlistRedirectURL(embyPlayPath, log, cfg, originalHeaders)
 	}
-	log.Debugf("【EMBY PROXY】步骤4 - 创建115凭证耗时: %v", time.Since(stepStart))
+	recordStep(c, log, "步骤4/5 - 创建115凭证并初始化客户端", stepStart)
 
-	stepStart = time.Now()
-	client := driver115.Defalut().ImportCredential(cr)
-	log.Debugf("【EMBY PROXY】步骤5 - 初始化115客户端耗时: %v", time.Since(stepStart))
+	// 最近一次校验已失效时提前告警，避免所有播放静默降级，同一次校验结果只告警一次
+	if checkedAt, ok := cookiechecker.Default().TakeInvalidWarning(); ok {
+		log.Warnf("115 Cookie 在 %s 校验失效，请执行 cinexus login 115-cookie 重新登录",
+			checkedAt.Format("2006-01-02 15:04:05"))
+	}
 
 	// 替换 embyPath 中的 old 为 real 字符串
 	embyRealCloudPlayPath := strings.Replace(embyPlayPath, matchPathConfig.Old, matchPathConfig.Real, 1)
@@ -175,136 +278,283 @@ func CKAnd115Open(c echo.Context, embyPath string, log *logger.Logger, cfg *conf
 
 	// 优先从数据库里获取 pickcode
 	stepStart = time.Now()
-	pickcode := ""
+	pickcode, sha1 := "", ""
+	fromCache := false
 	if cfg.Proxy.CachePickcode {
-		if cachedPickcode, found := storage.GetPickcodeFromCache(embyRealCloudPlayPath); found {
-			pickcode = cachedPickcode
-			log.Debugf("【EMBY PROXY】步骤6a - 从缓存获取pickcode成功耗时: %v", time.Since(stepStart))
+		if cache, found := storage.GetPickcodeCache(embyRealCloudPlayPath); found {
+			pickcode, sha1 = cache.Pickcode, cache.SHA1
+			fromCache = true
+			recordStep(c, log, "步骤6a - 从缓存获取pickcode成功", stepStart)
 			log.Infof("【EMBY PROXY】从缓存命中 pickcode: %s -> %s", fileName, pickcode)
 		} else {
-			log.Debugf("【EMBY PROXY】步骤6a - 缓存中未找到pickcode耗时: %v", time.Since(stepStart))
+			recordStep(c, log, "步骤6a - 缓存中未找到pickcode", stepStart)
 		}
 	}
 
 	// 如果缓存中没有找到，从115API获取
 	if pickcode == "" {
-		stepStart = time.Now()
-		dirRes, err := client.DirName2CID(dirPath)
+		pickcode, err = lookupDirPickcode(c, client, embyRealCloudPlayPath, "", log, cfg)
 		if err != nil {
-			log.Errorf("获取目录 CID 错误: %v", err)
-			return "", true
+			log.Errorf("查找 pickcode 失败，降级到 AList 302 方案: %v", err)
+			traceFrom(c).Error(err)
+			traceFrom(c).Fallback("115 查找文件失败，降级到 AList 302 方案")
+			notify.Send(notify.EventResolverFailed, "115 查找文件失败", fmt.Sprintf("目录: %s, 已降级到 AList 302 方案, 错误: %v", dirPath, err))
+			return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
 		}
-		log.Debugf("【EMBY PROXY】步骤6b - 获取目录CID耗时: %v", time.Since(stepStart))
+	}
 
-		dirID := string(dirRes.CategoryID)
+	if pickcode == "" {
+		log.Printf("找不到文件 %s 降级到 AList 302 方案", fileName)
+		traceFrom(c).Fallback("115 中找不到文件，降级到 AList 302 方案")
+		return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
+	}
 
-		stepStart = time.Now()
-		files, _ := client.ListWithLimit(dirID, 1150)
-		log.Debugf("【EMBY PROXY】步骤7 - 列出目录文件耗时: %v", time.Since(stepStart))
+	downloadURL, err := downloadURLByPickcode(c, client, pickcode, log, cfg)
+	if err != nil && fromCache {
+		// 文件被重命名、移动或重新上传后缓存的 pickcode 会失效，删除缓存后重新从 115 查找一次
+		log.Warnf("缓存的 pickcode 获取下载地址失败，重新从 115 查找: %s -> %s, 错误: %v", fileName, pickcode, err)
+		traceFrom(c).Error(err)
+		if delErr := storage.DeletePickcodeFromCache(embyRealCloudPlayPath); delErr != nil {
+			log.Warnf("删除失效的 pickcode 缓存失败: %v", delErr)
+		}
 
-		// 如果启用了缓存，异步缓存所有文件的pickcode
-		if cfg.Proxy.CachePickcode && files != nil {
+		// 文件被重命名时按 SHA1 找到新的文件
+		freshPickcode, lookupErr := lookupDirPickcode(c, client, embyRealCloudPlayPath, sha1, log, cfg)
+		switch {
+		case lookupErr != nil:
+			log.Warnf("重新查找 pickcode 失败: %v", lookupErr)
+		case freshPickcode == "":
+			log.Warnf("115 中已找不到文件: %s", embyRealCloudPlayPath)
+		case freshPickcode == pickcode:
+			log.Infof("pickcode 没有变化，不再重试: %s", fileName)
+		default:
+			log.Infof("🩹 pickcode 已更新: %s, %s -> %s", fileName, pickcode, freshPickcode)
+			traceFrom(c).Fallback("缓存的 pickcode 已失效，使用重新查找的 pickcode 重试")
+			downloadURL, err = downloadURLByPickcode(c, client, freshPickcode, log, cfg)
+		}
+	} else if err == nil && fromCache {
+		go func() {
+			if err := storage.MarkPickcodesVerified([]string{embyRealCloudPlayPath}); err != nil {
+				log.Warnf("更新 pickcode 确认时间失败: %v", err)
+			}
+		}()
+	}
+
+	if err != nil {
+		log.Errorf("%v，降级到 AList 302 方案", err)
+		traceFrom(c).Error(err)
+		traceFrom(c).Fallback("115Open 获取下载地址失败，降级到 AList 302 方案")
+		notify.Send(notify.EventResolverFailed, "115Open 获取下载地址失败", fmt.Sprintf("文件: %s, 已降级到 AList 302 方案, 错误: %v", embyPath, err))
+		return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
+	}
+
+	return downloadURL, false
+}
+
+// lookupDirPickcode 查找文件的 pickcode，找不到文件时返回空字符串
+// 保存了 115open 凭证时先按路径直接获取文件信息，找不到时再列出文件所在的目录，sha1 不为空时同名文件不存在会按 SHA1 查找重命名后的文件。
+// 开启 pickcode 缓存时同时缓存目录中所有文件的 pickcode，并优先使用同目录文件缓存的目录 CID，不需要再通过路径查找目录
+func lookupDirPickcode(c echo.Context, lister dirLister, cloudPath, sha1 string, log *logger.Logger, cfg *config.Config) (string, error) {
+	fileName := filepath.Base(cloudPath)
+	dirPath := filepath.Dir(cloudPath)
+
+	if entry, found := lookupOpenFile(c, cloudPath, log); found {
+		if cfg.Proxy.CachePickcode {
 			go func() {
-				cacheStart := time.Now()
-				cachedCount := 0
-				skippedCount := 0
-
-				for _, file := range *files {
-					// 构建文件的完整路径
-					fullFilePath := filepath.Join(dirPath, file.Name)
-
-					// 检查是否已经缓存，如果已存在就跳过
-					if _, found := storage.GetPickcodeFromCache(fullFilePath); found {
-						skippedCount++
-						continue
-					}
-
-					// 保存到缓存
-					if err := storage.SavePickcodeToCache(fullFilePath, file.PickCode); err != nil {
-						log.Warnf("批量缓存失败 %s: %v", file.Name, err)
-					} else {
-						cachedCount++
-					}
+				if _, err := storage.SavePickcodeEntries([]storage.PickcodeCacheEntry{entry}); err != nil {
+					log.Warnf("保存 pickcode 到缓存失败: %v", err)
 				}
-
-				log.Infof("【EMBY PROXY】批量缓存完成 - 新缓存: %d, 跳过: %d, 耗时: %v",
-					cachedCount, skippedCount, time.Since(cacheStart))
 			}()
 		}
+		return entry.Pickcode, nil
+	}
+
+	dirID, cachedDirID := "", false
+	if cfg.Proxy.CachePickcode {
+		dirID, cachedDirID = storage.GetCachedDirCID(dirPath)
+	}
+
+	for {
+		stepStart := time.Now()
+		if !cachedDirID {
+			var err error
+			dirID, err = lister.DirID(dirPath)
+			if errors.Is(err, errCloudDirNotFound) {
+				log.Warnf("115 中不存在目录: %s", dirPath)
+				return "", nil
+			}
+			if err != nil {
+				return "", fmt.Errorf("获取目录 %s 的 CID 错误: %w", dirPath, err)
+			}
+			recordStep(c, log, "步骤6b - 获取目录CID", stepStart)
+		} else {
+			recordStep(c, log, "步骤6b - 从缓存获取目录CID", stepStart)
+		}
 
 		stepStart = time.Now()
-		for _, file := range *files {
-			if file.Name == fileName {
-				pickcode = file.PickCode
-				break
-			}
+		entries, err := lister.List(c.Request().Context(), dirID)
+		recordStep(c, log, "步骤7 - 列出目录文件", stepStart)
+
+		var found *cloudEntry
+		if err == nil {
+			found = findDirFile(entries, fileName, sha1)
+		}
+
+		// 目录被移动或删除后缓存的目录 CID 会失效，通过路径重新查找一次
+		if found == nil && cachedDirID {
+			log.Infof("缓存的目录 CID 中找不到文件，通过路径重新查找目录: %s", dirPath)
+			cachedDirID = false
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("列出目录 %s 错误: %w", dirPath, err)
 		}
-		log.Debugf("【EMBY PROXY】步骤8 - 查找文件pickcode耗时: %v", time.Since(stepStart))
 
-		// 如果找到了pickcode且启用了缓存，保存到数据库
-		if pickcode != "" && cfg.Proxy.CachePickcode {
+		// 如果启用了缓存，异步缓存所有文件的pickcode
+		if cfg.Proxy.CachePickcode {
+			go func(dirID string) {
+				cacheStart := time.Now()
+				saved, err := cacheDirPickcodes(dirPath, dirID, entries)
+				if err != nil {
+					log.Warnf("批量缓存 pickcode 失败: %s, 错误: %v", dirPath, err)
+					return
+				}
+				log.Infof("【EMBY PROXY】批量缓存完成 - 目录: %s, 文件: %d, 耗时: %v",
+					dirPath, saved, time.Since(cacheStart))
+			}(dirID)
+		}
+
+		if found == nil {
+			return "", nil
+		}
+		if found.Name != fileName {
+			log.Infof("🩹 按 SHA1 找到重命名后的文件: %s -> %s", fileName, found.Name)
+		}
+
+		// 如果启用了缓存，按 Emby 中的路径保存到数据库
+		if cfg.Proxy.CachePickcode {
 			stepStart = time.Now()
-			if err := storage.SavePickcodeToCache(embyRealCloudPlayPath, pickcode); err != nil {
+			if _, err := storage.SavePickcodeEntries([]storage.PickcodeCacheEntry{found.cacheEntry(cloudPath, dirID)}); err != nil {
 				log.Warnf("保存 pickcode 到缓存失败: %v", err)
 			} else {
-				log.Debugf("【EMBY PROXY】保存pickcode到缓存成功: %s -> %s", fileName, pickcode)
+				log.Debugf("【EMBY PROXY】保存pickcode到缓存成功: %s -> %s", fileName, found.Pickcode)
 			}
-			log.Debugf("【EMBY PROXY】步骤9a - 保存pickcode到缓存耗时: %v", time.Since(stepStart))
+			recordStep(c, log, "步骤9a - 保存pickcode到缓存", stepStart)
 		}
+
+		return found.Pickcode, nil
 	}
+}
 
-	if pickcode == "" {
-		log.Printf("找不到文件 %s 降级到 AList 302 方案", fileName)
-		return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
+// lookupOpenFile 通过 115 开放平台按路径获取文件信息，没有保存 115open 凭证或找不到文件时返回 false
+// 只需要一次请求，不受目录中文件数量的影响
+func lookupOpenFile(c echo.Context, cloudPath string, log *logger.Logger) (storage.PickcodeCacheEntry, bool) {
+	lister, err := newOpenDirLister()
+	if err != nil {
+		return storage.PickcodeCacheEntry{}, false
 	}
 
-	if cfg.Proxy.Method == "ck" {
-		stepStart = time.Now()
-		downloadInfo, err := client.DownloadWithUA(pickcode, c.Request().UserAgent())
-		log.Debugf("【EMBY PROXY】步骤10 - CK方案获取下载地址耗时: %v", time.Since(stepStart))
+	stepStart := time.Now()
+	resp, err := lister.Info(c.Request().Context(), cloudPath)
+	recordStep(c, log, "步骤6b - 115Open按路径获取文件信息", stepStart)
+	if err != nil {
+		log.Debugf("115Open 按路径获取文件信息失败，改为列出目录: %s, 错误: %v", cloudPath, err)
+		return storage.PickcodeCacheEntry{}, false
+	}
+	// file_category 为 0 时是目录
+	if resp.PickCode == "" || resp.FileCategory == "0" {
+		return storage.PickcodeCacheEntry{}, false
+	}
+
+	log.Infof("【EMBY PROXY】115Open 按路径获取 pickcode: %s -> %s", filepath.Base(cloudPath), resp.PickCode)
+	return folderInfoCacheEntry(cloudPath, resp), true
+}
+
+// folderInfoCacheEntry 把 115 开放平台返回的文件信息转换为 pickcode 缓存记录
+func folderInfoCacheEntry(filePath string, resp *sdk115.GetFolderInfoResp) storage.PickcodeCacheEntry {
+	entry := storage.PickcodeCacheEntry{
+		FilePath: filePath,
+		Pickcode: resp.PickCode,
+		FileID:   resp.FileID,
+		SHA1:     resp.Sha1,
+	}
+	// paths 的最后一项是文件所在的目录
+	if len(resp.Paths) > 0 {
+		entry.ParentCID = strconv.FormatInt(resp.Paths[len(resp.Paths)-1].FileID, 10)
+	}
+	return entry
+}
+
+// findDirFile 在目录列表中按文件名查找文件，找不到且 sha1 不为空时按 SHA1 查找
+func findDirFile(entries []cloudEntry, fileName, sha1 string) *cloudEntry {
+	for i := range entries {
+		if !entries[i].IsDir && entries[i].Name == fileName {
+			return &entries[i]
+		}
+	}
+	if sha1 == "" {
+		return nil
+	}
+	for i := range entries {
+		if !entries[i].IsDir && strings.EqualFold(entries[i].SHA1, sha1) {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+// cookieClient Cookie 方案列出目录和获取下载地址的客户端
+type cookieClient interface {
+	dirLister
+	fileDownloader
+}
+
+// newCookieClient 使用扫码登录保存的 Cookie 或配置文件中的 Cookie 创建客户端，测试时可以替换
+var newCookieClient = func(cfg *config.Config) (cookieClient, error) {
+	client, err := pan115.NewClient(storage.GetCookie(cfg.Driver115.Cookie))
+	if err != nil {
+		return nil, err
+	}
+	return &cookieDirLister{client: client}, nil
+}
+
+// newOpenDownloader 使用保存的 115open 凭证获取下载地址，测试时可以替换
+var newOpenDownloader = func() (fileDownloader, error) {
+	return newOpenDirLister()
+}
+
+// downloadURLByPickcode 通过 pickcode 获取下载地址，ck 方案先使用 Cookie，失败后降级到 115Open
+func downloadURLByPickcode(c echo.Context, cookie fileDownloader, pickcode string, log *logger.Logger, cfg *config.Config) (string, error) {
+	if cfg.Proxy.Method == "ck" && cookie != nil {
+		stepStart := time.Now()
+		link, err := cookie.DownloadURL(c.Request().Context(), pickcode, c.Request().UserAgent())
+		recordStep(c, log, "步骤10 - CK方案获取下载地址", stepStart)
 		if err == nil {
-			log.Infof("CK 方案成功，使用 CDN 地址：%s", downloadInfo.Url.Url)
-			return downloadInfo.Url.Url, false
+			log.Infof("CK 方案成功，使用 CDN 地址：%s", link)
+			return link, nil
 		}
 
 		log.Printf("CK 方案失败，获取 CDN 地址失败：%e", err)
 		log.Infof("CK 方案失败，降级到 115Open 方案")
+		traceFrom(c).Error(err)
+		traceFrom(c).Fallback("CK 方案获取下载地址失败，降级到 115Open 方案")
 	}
 
-	token115, err := storage.ReadTokens()
+	open, err := newOpenDownloader()
 	if err != nil {
-		log.Errorf("读取 115 凭证错误: %v", err)
+		return "", fmt.Errorf("115Open 方案失败: %w", err)
 	}
 
-	sdk115Client := sdk115.New(sdk115.WithRefreshToken(token115.RefreshToken),
-		sdk115.WithAccessToken(token115.AccessToken),
-		sdk115.WithOnRefreshToken(func(s1, s2 string) {
-			storage.UpdateTokens(s2, s1)
-		}))
-
 	// 使用 OpenApi 去获取下载地址
-	stepStart = time.Now()
-	downloadUrlResp, err := sdk115Client.DownURL(context.Background(), pickcode, c.Request().UserAgent())
-	log.Debugf("【EMBY PROXY】步骤11 - 115Open方案获取下载地址耗时: %v", time.Since(stepStart))
+	stepStart := time.Now()
+	link, err := open.DownloadURL(c.Request().Context(), pickcode, c.Request().UserAgent())
+	recordStep(c, log, "步骤11 - 115Open方案获取下载地址", stepStart)
 	if err != nil {
-		log.Errorf("115Open 方案失败，降级到 AList 302 方案，获取下载地址失败: %v", err)
-		return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
-	}
-
-	var firstKey string
-	for key := range downloadUrlResp {
-		firstKey = key
-		break
+		return "", fmt.Errorf("115Open 方案失败，获取下载地址失败: %w", err)
 	}
 
-	u, ok := downloadUrlResp[firstKey]
-	if !ok {
-		log.Infof("115Open 方案失败，降级到 AList 302 方案")
-		return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
-	}
-
-	log.Infof("115Open 方案成功，使用 CDN 地址：%s", u.URL.URL)
-	return u.URL.URL, false
+	log.Infof("115Open 方案成功，使用 CDN 地址：%s", link)
+	return link, nil
 }
 
 // 通过 115open API 的方案
@@ -332,12 +582,14 @@ func Get115OpenRedirectURL(c echo.Context, embyPath string, log *logger.Logger,
 
 	if resp.PickCode == "" {
 		log.Errorf("[Get115OpenRedirectURL] 获取 115 文件 PickCode 失败: %v", err)
+		traceFrom(c).Fallback("115Open 获取 PickCode 失败，降级到 AList 302 方案")
+		notify.Send(notify.EventResolverFailed, "115Open 获取 PickCode 失败", fmt.Sprintf("文件: %s, 已降级到 AList 302 方案", embyRealCloudPlayPath))
 		return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
 	}
 
 	go func() {
-		err = storage.SavePickcodeToCache(embyRealCloudPlayPath, resp.PickCode)
-		if err != nil {
+		entry := folderInfoCacheEntry(embyRealCloudPlayPath, &resp)
+		if _, err := storage.SavePickcodeEntries([]storage.PickcodeCacheEntry{entry}); err != nil {
 			log.Warnf("保存 pickcode 到缓存失败: %v", err)
 		}
 	}()
@@ -345,6 +597,9 @@ func Get115OpenRedirectURL(c echo.Context, embyPath string, log *logger.Logger,
 	downloadUrlResp, err := sdk115Client.DownURL(context.Background(), resp.PickCode, c.Request().UserAgent())
 	if err != nil {
 		log.Errorf("115Open 方案失败，降级到 AList 302 方案，获取下载地址失败: %v", err)
+		traceFrom(c).Error(err)
+		traceFrom(c).Fallback("115Open 获取下载地址失败，降级到 AList 302 方案")
+		notify.Send(notify.EventResolverFailed, "115Open 获取下载地址失败", fmt.Sprintf("文件: %s, 已降级到 AList 302 方案, 错误: %v", embyPath, err))
 		return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
 	}
 
@@ -357,6 +612,7 @@ func Get115OpenRedirectURL(c echo.Context, embyPath string, log *logger.Logger,
 	u, ok := downloadUrlResp[firstKey]
 	if !ok {
 		log.Infof("115Open 方案失败，降级到 AList 302 方案")
+		traceFrom(c).Fallback("115Open 未返回下载地址，降级到 AList 302 方案")
 		return GetAlistRedirectURL(strings.Replace(embyPath, matchPathConfig.Old, matchPathConfig.New, 1), log, cfg, originalHeaders)
 	}
 
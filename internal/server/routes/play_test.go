@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestFindDirFile(t *testing.T) {
+	entries := []cloudEntry{
+		{Name: "a.mkv", IsDir: true, Pickcode: "dir"},
+		{Name: "a.mkv", Pickcode: "pa", SHA1: "AAA"},
+		{Name: "b.mkv", Pickcode: "pb", SHA1: "BBB"},
+	}
+
+	// 同名的目录不会被当成文件
+	if entry := findDirFile(entries, "a.mkv", ""); entry == nil || entry.Pickcode != "pa" {
+		t.Errorf("按文件名查找错误: %+v", entry)
+	}
+	// 文件被重命名后按 SHA1 查找
+	if entry := findDirFile(entries, "old.mkv", "bbb"); entry == nil || entry.Pickcode != "pb" {
+		t.Errorf("按 SHA1 查找错误: %+v", entry)
+	}
+	if entry := findDirFile(entries, "old.mkv", ""); entry != nil {
+		t.Errorf("没有 SHA1 时不应找到文件: %+v", entry)
+	}
+}
+
+// stubCookieClient 按 pickcode 返回下载地址的 Cookie 客户端，没有登记的 pickcode 获取失败
+type stubCookieClient struct {
+	*fakeLister
+	links     map[string]string
+	downloads []string
+}
+
+func (s *stubCookieClient) DownloadURL(ctx context.Context, pickcode, userAgent string) (string, error) {
+	s.downloads = append(s.downloads, pickcode)
+	if link, ok := s.links[pickcode]; ok {
+		return link, nil
+	}
+	return "", errors.New("文件不存在或已删除")
+}
+
+type failingDownloader struct{}
+
+func (failingDownloader) DownloadURL(ctx context.Context, pickcode, userAgent string) (string, error) {
+	return "", errors.New("没有保存 115open 凭证")
+}
+
+func TestCKAnd115OpenStalePickcode(t *testing.T) {
+	var alistCalls int32
+	alistServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&alistCalls, 1)
+		http.Redirect(w, r, "https://alist.example.com/e1.mkv", http.StatusFound)
+	}))
+	defer alistServer.Close()
+
+	storage.DataDir = t.TempDir()
+	if err := storage.InitDB(); err != nil {
+		t.Fatalf("InitDB 失败: %v", err)
+	}
+
+	pathConfig := config.Path{Old: "/media", New: "/115", Real: "/115"}
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{Method: "ck", CachePickcode: true, Paths: []config.Path{pathConfig}},
+		Alist: config.AlistConfig{URL: alistServer.URL},
+	}
+	log := logger.New(config.LogConfig{Level: "error"})
+
+	origCookie, origOpen := newCookieClient, newOpenDownloader
+	defer func() { newCookieClient, newOpenDownloader = origCookie, origOpen }()
+	newOpenDownloader = func() (fileDownloader, error) { return failingDownloader{}, nil }
+
+	cases := []struct {
+		name      string
+		entries   []cloudEntry
+		wantLink  string
+		wantCache string // 重新查找后缓存的 pickcode，为空时缓存应被删除
+		wantAList int32
+	}{
+		{
+			name:      "按文件名找到重新上传的文件",
+			entries:   []cloudEntry{{Name: "e1.mkv", Pickcode: "new", SHA1: "S2"}, {Name: "e2.mkv", Pickcode: "pe2"}},
+			wantLink:  "https://cdn.example.com/new",
+			wantCache: "new",
+		},
+		{
+			name:      "按 SHA1 找到重命名后的文件",
+			entries:   []cloudEntry{{Name: "e1.renamed.mkv", Pickcode: "new", SHA1: "s1"}, {Name: "e2.mkv", Pickcode: "pe2"}},
+			wantLink:  "https://cdn.example.com/new",
+			wantCache: "new",
+		},
+		{
+			name:      "文件已删除时降级到 AList",
+			entries:   []cloudEntry{{Name: "e2.mkv", Pickcode: "pe2"}},
+			wantLink:  "https://alist.example.com/e1.mkv",
+			wantAList: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// 数据库只会初始化一次，清空其他用例缓存的同目录文件
+			if err := storage.ClearPickcodeCache(); err != nil {
+				t.Fatalf("清空 pickcode 缓存失败: %v", err)
+			}
+			atomic.StoreInt32(&alistCalls, 0)
+
+			// 缓存中是文件重新上传或重命名前的 pickcode
+			if _, err := storage.SavePickcodeEntries([]storage.PickcodeCacheEntry{{FilePath: "/115/剧集/e1.mkv", Pickcode: "old", SHA1: "S1"}}); err != nil {
+				t.Fatalf("保存 pickcode 失败: %v", err)
+			}
+
+			client := &stubCookieClient{
+				fakeLister: &fakeLister{dirs: map[string][]cloudEntry{"1": tc.entries}},
+				links:      map[string]string{"new": "https://cdn.example.com/new"},
+			}
+			newCookieClient = func(cfg *config.Config) (cookieClient, error) { return client, nil }
+
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/Videos/1/stream", nil), httptest.NewRecorder())
+			link, skip := CKAnd115Open(c, "/media/剧集/e1.mkv", log, cfg, map[string]string{}, pathConfig)
+			if skip || link != tc.wantLink {
+				t.Fatalf("期望地址 %s, 实际: %s %v", tc.wantLink, link, skip)
+			}
+
+			// 失效的 pickcode 只请求一次，目录只重新列出一次
+			if len(client.downloads) == 0 || client.downloads[0] != "old" || countOf(client.downloads, "old") != 1 {
+				t.Errorf("失效的 pickcode 应只请求一次: %v", client.downloads)
+			}
+			if len(client.listed) != 1 {
+				t.Errorf("期望重新列出目录 1 次, 实际: %v", client.listed)
+			}
+			if alistCalls != tc.wantAList {
+				t.Errorf("期望请求 AList %d 次, 实际: %d", tc.wantAList, alistCalls)
+			}
+
+			cache, found := storage.GetPickcodeCache("/115/剧集/e1.mkv")
+			if tc.wantCache == "" && found {
+				t.Errorf("文件已删除时缓存应被删除: %+v", cache)
+			}
+			if tc.wantCache != "" && (!found || cache.Pickcode != tc.wantCache || cache.ParentCID != "1") {
+				t.Errorf("期望缓存更新为 %s, 实际: %+v %v", tc.wantCache, cache, found)
+			}
+
+			// 等待异步缓存目录中的其他文件
+			deadline := time.Now().Add(time.Second)
+			for {
+				if _, found := storage.GetPickcodeFromCache("/115/剧集/e2.mkv"); found {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("重新列出的目录中的文件应被缓存")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func countOf(values []string, value string) int {
+	n := 0
+	for _, v := range values {
+		if v == value {
+			n++
+		}
+	}
+	return n
+}
@@ -5,6 +5,7 @@ import (
 	"cinexus/internal/config"
 	"cinexus/internal/helper"
 	"cinexus/internal/logger"
+	"cinexus/internal/server/middleware"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -20,7 +21,7 @@ import (
 )
 
 // Setup 配置所有应用程序路由
-func Setup(e *echo.Echo, cfg *config.Config, log *logger.Logger) {
+func Setup(e *echo.Echo, cfg *config.Config, log *logger.Logger, components Components) {
 	goCache := cache.New(time.Duration(cfg.Proxy.CacheTime)*time.Minute, 1*time.Minute)
 	embyURL, _ := url.Parse(cfg.Proxy.URL)
 	proxy := httputil.NewSingleHostReverseProxy(embyURL)
@@ -36,13 +37,20 @@ func Setup(e *echo.Echo, cfg *config.Config, log *logger.Logger) {
 			return Playing(c, proxy, cfg, log)
 		}
 
+		if err == nil {
+			promoteItemTasks(removeEmbyRequestPath, log)
+		}
+
 		if cacheLink, found := goCache.Get(cacheKey); found {
-			return c.Redirect(302, cacheLink.(string))
+			return c.Redirect(302, cacheLink.(cachedLink).URL)
 		}
 
 		url, skip := ProxyPlay(c, proxy, cfg, log)
+		if localPath, ok := localFileFrom(c); ok {
+			return serveLocalFile(c, localPath, log)
+		}
 		if !skip {
-			goCache.Set(cacheKey, url, cache.DefaultExpiration)
+			goCache.Set(cacheKey, newCachedLink(c, url), cache.DefaultExpiration)
 			return c.Redirect(302, url)
 		}
 
@@ -51,11 +59,25 @@ func Setup(e *echo.Echo, cfg *config.Config, log *logger.Logger) {
 	})
 
 	cinexusAPI := e.Group("/cinexus-api")
-	webhook := cinexusAPI.Group("/webhook")
+	webhook := cinexusAPI.Group("/webhook", middleware.WebhookAuth(cfg.Webhook.Secret))
 
-	webhook.POST("/emby", func(c echo.Context) error {
-		return HandleEmbyWebhook(c, cfg, log)
-	})
+	// 请求格式会自动识别，不同路径只是方便在日志中区分来源
+	handleWebhook := func(c echo.Context) error {
+		return HandleWebhook(c, cfg, log, goCache)
+	}
+	webhook.POST("/emby", handleWebhook)
+	webhook.POST("/jellyfin", handleWebhook)
+	webhook.POST("/generic", handleWebhook)
+
+	setupDirectLink(cinexusAPI, cfg, log, goCache)
+
+	var embyValidator *middleware.EmbyAdminValidator
+	if cfg.Admin.AllowEmbyAdmin && cfg.Proxy.URL != "" {
+		embyValidator = middleware.NewEmbyAdminValidator(cfg.Proxy.URL)
+	}
+
+	admin := cinexusAPI.Group("/admin", middleware.AdminAuth(cfg.Admin.APIKey, embyValidator, log))
+	setupAdmin(admin, cfg, log, goCache, components)
 }
 
 type SimpleStartInfo struct {
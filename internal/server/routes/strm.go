@@ -0,0 +1,497 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/helper/alist"
+	"cinexus/internal/logger"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 直链方式，pickcode 方式只支持从 115 列出的源目录
+const (
+	StrmModePickcode = "pickcode"
+	StrmModePath     = "path"
+)
+
+// strmVideoExts 生成 .strm 的视频文件扩展名
+var strmVideoExts = map[string]bool{
+	".mkv": true, ".mp4": true, ".m4v": true, ".avi": true, ".ts": true, ".m2ts": true, ".iso": true,
+	".rmvb": true, ".wmv": true, ".mov": true, ".flv": true, ".webm": true, ".mpg": true, ".mpeg": true, ".vob": true,
+}
+
+// strmSidecarExts 直接复制的附属文件扩展名，包括 nfo、图片和字幕
+var strmSidecarExts = map[string]bool{
+	".nfo": true, ".jpg": true, ".jpeg": true, ".png": true, ".webp": true,
+	".srt": true, ".ass": true, ".ssa": true, ".sub": true, ".idx": true, ".vtt": true, ".sup": true,
+}
+
+// strmUserAgent 下载附属文件时使用的 User-Agent，115 的下载地址只能使用获取时的 User-Agent 下载
+const strmUserAgent = "Cinexus-STRM"
+
+// StrmOptions 生成 STRM 媒体库的参数
+type StrmOptions struct {
+	Source         string        // 115 或 AList 中的源目录
+	Out            string        // 输出目录，只存放该源目录生成的文件
+	AList          bool          // 通过 AList 列出源目录，否则按 proxy.method 列出 115 目录
+	Mode           string        // 直链方式 pickcode 或 path，为空时 115 使用 pickcode，AList 使用 path
+	BaseURL        string        // 写入 .strm 的服务地址，如 http://192.168.1.2:8080
+	Interval       time.Duration // 两次列出目录的间隔，避免被风控
+	SidecarMaxSize int64         // 附属文件的最大大小，超过时不复制，0 为不限制
+	Prune          bool          // 删除源目录中已不存在的文件生成的 .strm
+	PruneSidecars  bool          // Prune 时同时删除已不存在的附属文件，输出目录中 Emby 或刮削器保存的 nfo 和图片也会被删除
+	DryRun         bool          // 只统计，不写入和删除文件
+	Progress       func(result *StrmResult, dir string)
+}
+
+// StrmResult 生成 STRM 媒体库的结果
+type StrmResult struct {
+	Dirs      int `json:"dirs"`      // 已列出的目录数
+	Strm      int `json:"strm"`      // 新写入或更新的 .strm
+	Sidecars  int `json:"sidecars"`  // 新复制或更新的附属文件
+	Unchanged int `json:"unchanged"` // 没有变化的文件
+	Removed   int `json:"removed"`   // 删除的文件
+	Failed    int `json:"failed"`    // 复制失败的附属文件
+}
+
+// strmEntry 源目录中的文件或子目录
+type strmEntry struct {
+	Path     string // 源路径
+	ID       string // 115 中子目录的 CID
+	Pickcode string
+	Size     int64
+	SHA1     string    // 115 中文件的 SHA1
+	Modified time.Time // AList 中文件的修改时间
+	IsDir    bool
+}
+
+// strmSource 列出源目录并下载附属文件
+type strmSource interface {
+	Root(root string) (strmEntry, error)
+	List(ctx context.Context, dir strmEntry) ([]strmEntry, error)
+	Open(ctx context.Context, file strmEntry) (io.ReadCloser, error)
+}
+
+// fileDownloader 获取 115 文件的下载地址
+type fileDownloader interface {
+	DownloadURL(ctx context.Context, pickcode, userAgent string) (string, error)
+}
+
+// cloudStrmSource 通过 Cookie 或 115open 列出 115 目录
+type cloudStrmSource struct {
+	lister dirLister
+}
+
+func (s *cloudStrmSource) Root(root string) (strmEntry, error) {
+	cid, err := s.lister.DirID(root)
+	if err != nil {
+		return strmEntry{}, err
+	}
+	return strmEntry{Path: root, ID: cid, IsDir: true}, nil
+}
+
+func (s *cloudStrmSource) List(ctx context.Context, dir strmEntry) ([]strmEntry, error) {
+	entries, err := s.lister.List(ctx, dir.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]strmEntry, 0, len(entries))
+	for _, entry := range entries {
+		files = append(files, strmEntry{
+			Path:     path.Join(dir.Path, entry.Name),
+			ID:       entry.ID,
+			Pickcode: entry.Pickcode,
+			Size:     entry.Size,
+			SHA1:     entry.SHA1,
+			IsDir:    entry.IsDir,
+		})
+	}
+	return files, nil
+}
+
+func (s *cloudStrmSource) Open(ctx context.Context, file strmEntry) (io.ReadCloser, error) {
+	downloader, ok := s.lister.(fileDownloader)
+	if !ok {
+		return nil, fmt.Errorf("不支持下载 115 文件")
+	}
+	link, err := downloader.DownloadURL(ctx, file.Pickcode, strmUserAgent)
+	if err != nil {
+		return nil, err
+	}
+	return httpGet(ctx, link)
+}
+
+// alistStrmSource 通过 AList 列出目录
+type alistStrmSource struct {
+	cfg *config.Config
+}
+
+func (s *alistStrmSource) Root(root string) (strmEntry, error) {
+	info, err := alist.FsGet(s.cfg.Alist.URL, s.cfg.Alist.APIKey, root)
+	if errors.Is(err, alist.ErrNotFound) || (err == nil && !info.IsDir) {
+		return strmEntry{}, errCloudDirNotFound
+	}
+	if err != nil {
+		return strmEntry{}, err
+	}
+	return strmEntry{Path: root, IsDir: true}, nil
+}
+
+func (s *alistStrmSource) List(ctx context.Context, dir strmEntry) ([]strmEntry, error) {
+	infos, err := alist.FsList(s.cfg.Alist.URL, s.cfg.Alist.APIKey, dir.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]strmEntry, 0, len(infos))
+	for _, info := range infos {
+		modified, _ := time.Parse(time.RFC3339, info.Modified)
+		files = append(files, strmEntry{Path: path.Join(dir.Path, info.Name), Size: info.Size, Modified: modified, IsDir: info.IsDir})
+	}
+	return files, nil
+}
+
+func (s *alistStrmSource) Open(ctx context.Context, file strmEntry) (io.ReadCloser, error) {
+	link := strings.TrimRight(s.cfg.Alist.URL, "/") + (&url.URL{Path: "/d" + file.Path}).EscapedPath()
+	if s.cfg.Alist.Sign {
+		link += "?sign=" + alist.Sign(file.Path, 0, s.cfg.Alist.APIKey)
+	}
+	return httpGet(ctx, link)
+}
+
+// httpGet 下载文件，跟随重定向
+func httpGet(ctx context.Context, link string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", strmUserAgent)
+
+	resp, err := (&http.Client{Timeout: 5 * time.Minute}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("下载失败，状态码: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// GenerateStrm 遍历 115 或 AList 中的源目录，为每个视频生成包含签名直链的 .strm，并复制 nfo、图片和字幕等附属文件
+// 再次执行时只写入有变化的文件，Prune 时删除源目录中已不存在的文件生成的 .strm，PruneSidecars 时同时删除附属文件
+func GenerateStrm(ctx context.Context, cfg *config.Config, log *logger.Logger, opts StrmOptions) (*StrmResult, error) {
+	var source strmSource
+	if opts.AList {
+		if cfg.Alist.URL == "" {
+			return nil, fmt.Errorf("没有配置 alist.url")
+		}
+		source = &alistStrmSource{cfg: cfg}
+	} else {
+		lister, err := newDirLister(cfg)
+		if err != nil {
+			return nil, err
+		}
+		source = &cloudStrmSource{lister: lister}
+	}
+	return generateStrm(ctx, cfg, log, source, opts)
+}
+
+// generateStrm 使用 source 生成 STRM 媒体库
+func generateStrm(ctx context.Context, cfg *config.Config, log *logger.Logger, source strmSource, opts StrmOptions) (*StrmResult, error) {
+	if cfg.Link.Secret == "" {
+		return nil, fmt.Errorf("直链接口未启用，请配置 link.secret")
+	}
+	if opts.Mode == "" {
+		opts.Mode = StrmModePickcode
+		if opts.AList {
+			opts.Mode = StrmModePath
+		}
+	}
+	switch {
+	case opts.Mode != StrmModePickcode && opts.Mode != StrmModePath:
+		return nil, fmt.Errorf("直链方式必须是 pickcode 或 path")
+	case opts.Mode == StrmModePickcode && opts.AList:
+		return nil, fmt.Errorf("AList 源目录只支持 path 方式")
+	}
+
+	rootPath := path.Clean("/" + opts.Source)
+	root, err := source.Root(rootPath)
+	if err != nil {
+		if errors.Is(err, errCloudDirNotFound) {
+			return nil, fmt.Errorf("源目录 %s 不存在", rootPath)
+		}
+		return nil, fmt.Errorf("获取源目录 %s 错误: %w", rootPath, err)
+	}
+
+	result := &StrmResult{}
+	expected := make(map[string]bool)
+	pending := []strmEntry{root}
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		dir := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		entries, err := source.List(ctx, dir)
+		if err != nil {
+			return result, fmt.Errorf("列出目录 %s 错误: %w", dir.Path, err)
+		}
+		result.Dirs++
+
+		var subdirs []strmEntry
+		for _, entry := range entries {
+			if entry.IsDir {
+				subdirs = append(subdirs, entry)
+				continue
+			}
+
+			outPath := filepath.Join(opts.Out, filepath.FromSlash(strings.TrimPrefix(entry.Path, rootPath)))
+			ext := strings.ToLower(path.Ext(entry.Path))
+			switch {
+			case strmVideoExts[ext]:
+				outPath = strings.TrimSuffix(outPath, filepath.Ext(outPath)) + ".strm"
+				expected[outPath] = true
+				link, err := strmLink(cfg, opts, entry)
+				if err != nil {
+					return result, err
+				}
+				changed, err := writeStrmFile(outPath, link, opts.DryRun)
+				if err != nil {
+					return result, fmt.Errorf("写入 %s 失败: %w", outPath, err)
+				}
+				if changed {
+					result.Strm++
+				} else {
+					result.Unchanged++
+				}
+			case strmSidecarExts[ext]:
+				if opts.SidecarMaxSize > 0 && entry.Size > opts.SidecarMaxSize {
+					log.Debugf("附属文件超过大小限制，跳过: %s", entry.Path)
+					continue
+				}
+				expected[outPath] = true
+				if sidecarUnchanged(outPath, entry) {
+					result.Unchanged++
+					continue
+				}
+				if opts.DryRun {
+					result.Sidecars++
+					continue
+				}
+				if err := copySidecar(ctx, source, entry, outPath); err != nil {
+					log.Warnf("复制附属文件 %s 失败: %v", entry.Path, err)
+					result.Failed++
+					continue
+				}
+				result.Sidecars++
+			}
+		}
+
+		// 子目录按名称倒序入栈，按名称顺序生成
+		sort.Slice(subdirs, func(i, j int) bool { return subdirs[i].Path > subdirs[j].Path })
+		pending = append(pending, subdirs...)
+
+		log.Debugf("📼 已列出目录: %s, 文件: %d, 子目录: %d", dir.Path, len(entries)-len(subdirs), len(subdirs))
+		if opts.Progress != nil {
+			opts.Progress(result, dir.Path)
+		}
+
+		if len(pending) > 0 && opts.Interval > 0 {
+			select {
+			case <-ctx.Done():
+				return result, ctx.Err()
+			case <-time.After(opts.Interval):
+			}
+		}
+	}
+
+	// 只有完整遍历后才删除，避免中途出错时误删
+	if opts.Prune {
+		removed, err := pruneStrmDir(opts.Out, expected, opts.PruneSidecars, opts.DryRun)
+		result.Removed = removed
+		if err != nil {
+			return result, fmt.Errorf("删除已不存在的文件失败: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// strmLink 生成写入 .strm 的签名直链，直链永不过期，再次生成时内容不变，媒体服务器不会重新扫描
+func strmLink(cfg *config.Config, opts StrmOptions, entry strmEntry) (string, error) {
+	linkPath := PickcodeLinkPath(entry.Pickcode)
+	if opts.Mode == StrmModePath {
+		embyPath, ok := strmEmbyPath(cfg, entry.Path, opts.AList)
+		if !ok {
+			return "", fmt.Errorf("%s 不在 proxy.paths 中，无法生成 path 方式的直链", entry.Path)
+		}
+		linkPath = EmbyPathLinkPath(embyPath)
+	} else if entry.Pickcode == "" {
+		return "", fmt.Errorf("%s 没有 pickcode", entry.Path)
+	}
+
+	link, _ := SignLink(cfg.Link.Secret, linkPath, 0)
+	return strings.TrimRight(opts.BaseURL, "/") + link, nil
+}
+
+// strmEmbyPath 把源路径按 proxy.paths 转换为直链使用的 Emby 路径，115 路径按 real 转换，AList 路径按 new 转换
+func strmEmbyPath(cfg *config.Config, sourcePath string, fromAList bool) (string, bool) {
+	for _, p := range cfg.Proxy.Paths {
+		prefix := p.Real
+		if fromAList {
+			prefix = p.New
+		}
+		prefix = strings.TrimRight(prefix, "/")
+		if prefix == "" || p.Old == "" {
+			continue
+		}
+		if sourcePath == prefix || strings.HasPrefix(sourcePath, prefix+"/") {
+			return strings.TrimRight(p.Old, "/") + strings.TrimPrefix(sourcePath, prefix), true
+		}
+	}
+	return "", false
+}
+
+// writeStrmFile 内容有变化时写入 .strm，返回是否写入
+func writeStrmFile(outPath, link string, dryRun bool) (bool, error) {
+	if data, err := os.ReadFile(outPath); err == nil && strings.TrimSpace(string(data)) == link {
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+	return true, writeFileAtomic(outPath, strings.NewReader(link))
+}
+
+// sidecarUnchanged 判断已复制的附属文件是否与源文件相同
+// 大小相同时，115 的文件再比较 SHA1，AList 的文件再比较复制时设置的修改时间
+func sidecarUnchanged(outPath string, entry strmEntry) bool {
+	info, err := os.Stat(outPath)
+	if err != nil || info.Size() != entry.Size {
+		return false
+	}
+
+	switch {
+	case entry.SHA1 != "":
+		sum, err := fileSHA1(outPath)
+		return err == nil && strings.EqualFold(sum, entry.SHA1)
+	case !entry.Modified.IsZero():
+		return info.ModTime().Truncate(time.Second).Equal(entry.Modified.Truncate(time.Second))
+	}
+	return true
+}
+
+// fileSHA1 计算文件的 SHA1
+func fileSHA1(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copySidecar 下载附属文件到输出目录，修改时间设置为源文件的修改时间
+func copySidecar(ctx context.Context, source strmSource, entry strmEntry, outPath string) error {
+	body, err := source.Open(ctx, entry)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := writeFileAtomic(outPath, body); err != nil {
+		return err
+	}
+	if !entry.Modified.IsZero() {
+		return os.Chtimes(outPath, entry.Modified, entry.Modified)
+	}
+	return nil
+}
+
+// writeFileAtomic 先写入临时文件再重命名，中断时不会留下不完整的文件
+func writeFileAtomic(outPath string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(outPath), ".cinexus-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), outPath)
+}
+
+// pruneStrmDir 删除输出目录中不在 expected 中的 .strm 以及删除后的空目录，sidecars 时同时删除附属文件，其他文件不会被删除
+// 附属文件可能是 Emby 或刮削器保存的，默认不删除
+func pruneStrmDir(out string, expected map[string]bool, sidecars, dryRun bool) (int, error) {
+	removed := 0
+	var dirs []string
+	err := filepath.WalkDir(out, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != out {
+				dirs = append(dirs, p)
+			}
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(p))
+		if (ext != ".strm" && !(sidecars && strmSidecarExts[ext])) || expected[p] {
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+		}
+		removed++
+		return nil
+	})
+	if err != nil || dryRun {
+		return removed, err
+	}
+
+	// 从最深的目录开始删除空目录，非空目录删除失败时忽略
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, dir := range dirs {
+		os.Remove(dir)
+	}
+	return removed, nil
+}
@@ -0,0 +1,165 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+)
+
+// fakeStrmSource 按路径返回目录内容，附属文件的内容为其路径
+type fakeStrmSource struct {
+	dirs map[string][]strmEntry
+}
+
+func (s *fakeStrmSource) Root(root string) (strmEntry, error) {
+	if _, ok := s.dirs[root]; !ok {
+		return strmEntry{}, errCloudDirNotFound
+	}
+	return strmEntry{Path: root, IsDir: true}, nil
+}
+
+func (s *fakeStrmSource) List(ctx context.Context, dir strmEntry) ([]strmEntry, error) {
+	return s.dirs[dir.Path], nil
+}
+
+func (s *fakeStrmSource) Open(ctx context.Context, file strmEntry) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(file.Path)), nil
+}
+
+func TestGenerateStrm(t *testing.T) {
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{Paths: []config.Path{{Old: "/media", New: "/alist/115", Real: "/115"}}},
+		Link:  config.LinkConfig{Secret: "secret"},
+	}
+	log := logger.New(config.LogConfig{Level: "error"})
+	out := t.TempDir()
+
+	source := &fakeStrmSource{dirs: map[string][]strmEntry{
+		"/115/电影": {
+			{Path: "/115/电影/A", IsDir: true},
+			{Path: "/115/电影/B", IsDir: true},
+		},
+		"/115/电影/A": {
+			{Path: "/115/电影/A/a.mkv", Pickcode: "pa", Size: 1 << 30},
+			{Path: "/115/电影/A/a.nfo", Size: int64(len("/115/电影/A/a.nfo"))},
+			{Path: "/115/电影/A/a.zh.srt", Size: 1 << 30},
+			{Path: "/115/电影/A/readme.txt", Size: 10},
+		},
+		"/115/电影/B": {{Path: "/115/电影/B/b.mp4", Pickcode: "pb"}},
+	}}
+	opts := StrmOptions{Source: "/115/电影", Out: out, BaseURL: "http://proxy:8080/", SidecarMaxSize: 1 << 20, Prune: true}
+
+	result, err := generateStrm(context.Background(), cfg, log, source, opts)
+	if err != nil {
+		t.Fatalf("generateStrm 失败: %v", err)
+	}
+	// 超过大小限制的字幕和其他文件不会被复制
+	if result.Dirs != 3 || result.Strm != 2 || result.Sidecars != 1 || result.Removed != 0 {
+		t.Errorf("生成结果错误: %+v", result)
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "A", "a.strm"))
+	if err != nil || !strings.HasPrefix(string(data), "http://proxy:8080/cinexus-api/115/pick/pa?e=0&sign=") {
+		t.Errorf(".strm 内容错误: %s %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "A", "a.nfo")); err != nil {
+		t.Errorf("nfo 没有被复制: %v", err)
+	}
+
+	// 用户自己的文件不会被删除
+	own := filepath.Join(out, "B", "poster.txt")
+	os.WriteFile(own, []byte("keep"), 0644)
+
+	// 源目录中删除 B 后再次生成，只删除 B 中生成的文件
+	source.dirs["/115/电影"] = source.dirs["/115/电影"][:1]
+	result, err = generateStrm(context.Background(), cfg, log, source, opts)
+	if err != nil {
+		t.Fatalf("再次生成失败: %v", err)
+	}
+	if result.Strm != 0 || result.Sidecars != 0 || result.Unchanged != 2 || result.Removed != 1 {
+		t.Errorf("增量生成结果错误: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(out, "B", "b.strm")); !os.IsNotExist(err) {
+		t.Errorf("已不存在的文件生成的 .strm 应被删除: %v", err)
+	}
+	if _, err := os.Stat(own); err != nil {
+		t.Errorf("不是生成的文件不应被删除: %v", err)
+	}
+
+	// path 方式按 real 转换为 Emby 中的路径
+	opts.Mode = StrmModePath
+	if _, err := generateStrm(context.Background(), cfg, log, source, opts); err != nil {
+		t.Fatalf("path 方式生成失败: %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(out, "A", "a.strm"))
+	if !strings.HasPrefix(string(data), "http://proxy:8080/cinexus-api/d/media/%E7%94%B5%E5%BD%B1/A/a.mkv?") {
+		t.Errorf("path 方式的 .strm 内容错误: %s", data)
+	}
+
+	if _, err := generateStrm(context.Background(), cfg, log, source, StrmOptions{Source: "/115/不存在", Out: out}); err == nil {
+		t.Error("源目录不存在时应返回错误")
+	}
+}
+
+func TestGenerateStrmSidecars(t *testing.T) {
+	cfg := &config.Config{Link: config.LinkConfig{Secret: "secret"}}
+	log := logger.New(config.LogConfig{Level: "error"})
+	out := t.TempDir()
+
+	nfoPath, posterPath := "/115/电影/a.nfo", "/115/电影/poster.jpg"
+	nfoSum := sha1.Sum([]byte(nfoPath))
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	source := &fakeStrmSource{dirs: map[string][]strmEntry{
+		"/115/电影": {
+			{Path: "/115/电影/a.mkv", Pickcode: "pa"},
+			{Path: nfoPath, Size: int64(len(nfoPath)), SHA1: hex.EncodeToString(nfoSum[:])},
+			{Path: posterPath, Size: int64(len(posterPath)), Modified: modified},
+		},
+	}}
+	opts := StrmOptions{Source: "/115/电影", Out: out, BaseURL: "http://proxy:8080", Prune: true}
+	generate := func() *StrmResult {
+		t.Helper()
+		result, err := generateStrm(context.Background(), cfg, log, source, opts)
+		if err != nil {
+			t.Fatalf("generateStrm 失败: %v", err)
+		}
+		return result
+	}
+
+	if result := generate(); result.Sidecars != 2 {
+		t.Fatalf("期望复制 2 个附属文件, 实际: %+v", result)
+	}
+	if result := generate(); result.Sidecars != 0 || result.Unchanged != 3 {
+		t.Errorf("没有变化时不应重新复制: %+v", result)
+	}
+
+	// 大小相同但 SHA1 或修改时间变化时重新复制
+	entries := source.dirs["/115/电影"]
+	entries[1].SHA1 = strings.Repeat("0", 40)
+	entries[2].Modified = modified.Add(time.Hour)
+	if result := generate(); result.Sidecars != 2 {
+		t.Errorf("SHA1 或修改时间变化时应重新复制: %+v", result)
+	}
+
+	// 源目录中删除 nfo 后默认不删除附属文件，Emby 或刮削器可能保存了同名文件
+	source.dirs["/115/电影"] = []strmEntry{entries[0], entries[2]}
+	if result := generate(); result.Removed != 0 {
+		t.Errorf("默认不应删除附属文件: %+v", result)
+	}
+	opts.PruneSidecars = true
+	if result := generate(); result.Removed != 1 {
+		t.Errorf("--prune-sidecars 时应删除附属文件: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(out, "a.nfo")); !os.IsNotExist(err) {
+		t.Errorf("已不存在的附属文件应被删除: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/helper/emby"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+	"context"
+	"regexp"
+	"time"
+)
+
+// TaskHandlers 任务队列中与 Emby 和 115 相关的任务处理函数，服务和命令行共用
+func TaskHandlers(cfg *config.Config, log *logger.Logger) map[storage.TaskType]storage.TaskHandler {
+	return map[storage.TaskType]storage.TaskHandler{
+		storage.TaskTypePlaybackInfo: {
+			Handle: func(ctx context.Context, task *storage.MediaTask) error {
+				return GETPlaybackInfo(task.ItemID, cfg)
+			},
+			MaxAttempts: 3,
+			Timeout:     2 * time.Minute, // 获取播放信息时 Emby 需要探测媒体
+		},
+		storage.TaskTypeWarmPickcode: {
+			Handle: func(ctx context.Context, task *storage.MediaTask) error {
+				return WarmPickcode(ctx, task.ItemID, cfg, log)
+			},
+			MaxAttempts: 5, // 刚上传的文件可能还没出现在 115 的目录列表中
+			Timeout:     time.Minute,
+		},
+		storage.TaskTypeRefreshMetadata: {
+			Handle: func(ctx context.Context, task *storage.MediaTask) error {
+				return emby.New(cfg).RefreshItem(task.ItemID)
+			},
+			MaxAttempts: 3,
+			Timeout:     30 * time.Second, // Emby 收到请求后在后台刷新
+		},
+		storage.TaskTypeValidatePickcode: {
+			Handle: func(ctx context.Context, task *storage.MediaTask) error {
+				return ValidatePickcodeDir(ctx, task.ItemID, cfg, log)
+			},
+			MaxAttempts: 3,
+			Timeout:     2 * time.Minute,
+		},
+		storage.TaskTypeCrawlPickcode: {
+			Handle: func(ctx context.Context, task *storage.MediaTask) error {
+				_, err := CrawlPickcodeTree(ctx, cfg, log, task.ItemID, CrawlOptions{Interval: time.Second})
+				return err
+			},
+			MaxAttempts: 5,             // 失败后从检查点继续遍历
+			Timeout:     6 * time.Hour, // 大的目录树需要列出上万个目录
+		},
+	}
+}
+
+// playbackInfoRegexp Emby 客户端打开项目准备播放时请求的 PlaybackInfo 路径
+var playbackInfoRegexp = regexp.MustCompile(`(?i)^/Items/([^/]+)/PlaybackInfo$`)
+
+// promoteItemTasks 用户打开项目准备播放时，把该项目的待处理任务提到批量任务前面
+func promoteItemTasks(requestPath string, log *logger.Logger) {
+	matches := playbackInfoRegexp.FindStringSubmatch(requestPath)
+	if matches == nil {
+		return
+	}
+
+	taskQueue := storage.GetTaskQueue()
+	if taskQueue == nil {
+		return
+	}
+
+	go func() {
+		if _, err := taskQueue.PromoteTasks(matches[1], storage.TaskPriorityHigh); err != nil {
+			log.Warnf("提高任务优先级失败: ItemID=%s, 错误: %v", matches[1], err)
+		}
+	}()
+}
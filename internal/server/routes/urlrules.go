@@ -0,0 +1,166 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/helper/alist"
+	"cinexus/internal/logger"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// urlRulePatterns 缓存已编译的规则正则，键为正则字符串
+var urlRulePatterns sync.Map
+
+// urlFollowClient 跟随重定向获取 url 规则的最终地址
+var urlFollowClient = &http.Client{Timeout: 10 * time.Second}
+
+// compileURLRule 编译规则的正则，配置加载时已校验，这里只会在热更新后的无效配置上失败
+func compileURLRule(pattern string) (*regexp.Regexp, error) {
+	if re, ok := urlRulePatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	urlRulePatterns.Store(pattern, re)
+	return re, nil
+}
+
+// matchURLRule 按顺序查找第一条匹配链接的规则，返回规则和按模板改写后的结果
+func matchURLRule(rules []config.URLRule, rawURL string) (config.URLRule, string, bool) {
+	for _, rule := range rules {
+		re, err := compileURLRule(rule.Match)
+		if err != nil {
+			continue
+		}
+		idx := re.FindStringSubmatchIndex(rawURL)
+		if idx == nil {
+			continue
+		}
+
+		template := rule.Template
+		if template == "" {
+			template = "$0"
+		}
+		target := string(re.ExpandString(nil, template, rawURL, idx))
+		// 路径和 pickcode 来自链接，需要先解码
+		if rule.Resolver != config.URLResolverURL && !isHTTPURL(target) {
+			if decoded, err := url.PathUnescape(target); err == nil {
+				target = decoded
+			}
+		}
+		return rule, target, true
+	}
+	return config.URLRule{}, "", false
+}
+
+// resolveURLRule 按 proxy.url_rules 解析路径为链接的媒体，没有匹配的规则时返回 false
+func resolveURLRule(c echo.Context, rawURL string, cfg *config.Config, log *logger.Logger) (string, bool, bool) {
+	rule, target, ok := matchURLRule(cfg.Proxy.URLRules, rawURL)
+	if !ok {
+		return "", false, false
+	}
+
+	name := rule.Name
+	if name == "" {
+		name = rule.Match
+	}
+	log.Infof("【EMBY PROXY】链接匹配规则 %s，使用 %s 方式解析: %s", name, rule.Resolver, target)
+	traceFrom(c).Step(fmt.Sprintf("匹配链接规则 %s", name), 0)
+
+	switch rule.Resolver {
+	case config.URLResolverAList:
+		originalHeaders := make(map[string]string)
+		for key, value := range c.Request().Header {
+			if len(value) > 0 {
+				originalHeaders[key] = value[0]
+			}
+		}
+		// 完整链接直接请求，其他按 AList 中的路径处理
+		if isHTTPURL(target) {
+			link, err := alist.GetRedirectURL(target, originalHeaders)
+			if err != nil {
+				log.Errorf("获取 %s 的重定向地址错误: %v", target, err)
+				traceFrom(c).Error(err)
+				return "", true, true
+			}
+			return link, false, true
+		}
+		link, skip := GetAlistRedirectURL(target, log, cfg, originalHeaders)
+		return link, skip, true
+	case config.URLResolverPickcode:
+		if !pickcodePattern.MatchString(target) {
+			log.Errorf("链接规则 %s 改写的结果不是 pickcode: %s", name, target)
+			return "", true, true
+		}
+		link, err := resolvePickcodeLink(c, target, cfg, log)
+		if err != nil {
+			log.Errorf("按 pickcode 获取直链失败，交给 Emby 处理: %v", err)
+			traceFrom(c).Error(err)
+			traceFrom(c).Fallback("按 pickcode 获取直链失败，交给 Emby 处理")
+			return "", true, true
+		}
+		return link, false, true
+	case config.URLResolverPath:
+		c.Set(playPathContextKey, target)
+		link, skip := ResolvePlayPath(c, target, cfg, log)
+		return link, skip, true
+	case config.URLResolverURL:
+		if !isHTTPURL(target) {
+			log.Errorf("链接规则 %s 改写的结果不是链接: %s", name, target)
+			return "", true, true
+		}
+		if rule.Follow {
+			return followRedirects(c, target, log), false, true
+		}
+		return target, false, true
+	}
+	return "", true, true
+}
+
+// followRedirects 通过 HEAD 请求跟随重定向，返回最终地址，失败时返回原链接
+func followRedirects(c echo.Context, link string, log *logger.Logger) string {
+	stepStart := time.Now()
+	req, err := http.NewRequestWithContext(c.Request().Context(), http.MethodHead, link, nil)
+	if err != nil {
+		return link
+	}
+	req.Header.Set("User-Agent", c.Request().UserAgent())
+
+	resp, err := urlFollowClient.Do(req)
+	if err != nil {
+		log.Warnf("跟随 %s 的重定向失败，直接使用原链接: %v", link, err)
+		return link
+	}
+	resp.Body.Close()
+	recordStep(c, log, "跟随链接重定向", stepStart)
+	return resp.Request.URL.String()
+}
+
+// resolveURLPath 解析路径为链接的媒体：本服务的直链、proxy.url_rules、AList 链接，最后按 proxy.url_redirect 302 到链接本身
+func resolveURLPath(c echo.Context, rawURL string, cfg *config.Config, log *logger.Logger) (string, bool) {
+	if link, skip, ok := resolveStrmLink(c, rawURL, cfg, log); ok {
+		return link, skip
+	}
+	if link, skip, ok := resolveURLRule(c, rawURL, cfg, log); ok {
+		return link, skip
+	}
+	if cfg.Alist.URL != "" && strings.HasPrefix(rawURL, cfg.Alist.URL) {
+		return ResolvePlayPath(c, rawURL, cfg, log)
+	}
+
+	if !cfg.Proxy.URLRedirect {
+		traceFrom(c).Fallback("链接没有匹配的规则，交给 Emby 处理")
+		return "", true
+	}
+	traceFrom(c).Fallback("链接没有匹配的规则，直接 302 到链接")
+	return rawURL, false
+}
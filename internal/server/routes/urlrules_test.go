@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestResolveURLPath(t *testing.T) {
+	// 模拟 OpenList 的 /d 接口和 CDN 的跳转
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/d/115/电影/a.mkv":
+			http.Redirect(w, r, "https://cdn.example.com/a.mkv", http.StatusFound)
+		case "/cdn/b.mkv":
+			http.Redirect(w, r, "/edge/b.mkv", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Proxy: config.ProxyConfig{
+			Method: "alist",
+			Paths:  []config.Path{{Old: "/media", New: "/115", Real: "/115"}},
+			URLRules: []config.URLRule{
+				{Name: "openlist", Match: `^https?://openlist\.lan(/d/.*)$`, Resolver: config.URLResolverAList, Template: server.URL + "$1"},
+				{Name: "cdn", Match: `^https?://cdn\.lan/(.*)$`, Resolver: config.URLResolverURL, Template: server.URL + "/cdn/$1", Follow: true},
+				{Name: "emby", Match: `^https?://nas\.lan/(?P<path>.*)$`, Resolver: config.URLResolverPath, Template: "/media/${path}"},
+			},
+			URLRedirect: true,
+		},
+		Alist: config.AlistConfig{URL: server.URL},
+	}
+	log := logger.New(config.LogConfig{Level: "error"})
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/Videos/1/stream", nil), httptest.NewRecorder())
+
+	cases := []struct {
+		rawURL string
+		want   string
+	}{
+		{"http://openlist.lan/d/115/电影/a.mkv", "https://cdn.example.com/a.mkv"},
+		{"http://cdn.lan/b.mkv", server.URL + "/edge/b.mkv"},
+		// path 方式先解码再按 proxy.paths 解析
+		{"http://nas.lan/%E7%94%B5%E5%BD%B1/a.mkv", "https://cdn.example.com/a.mkv"},
+		// AList 链接不需要规则
+		{server.URL + "/d/115/电影/a.mkv", "https://cdn.example.com/a.mkv"},
+		// 没有匹配的规则时直接 302 到链接
+		{"https://other.example.com/c.mkv", "https://other.example.com/c.mkv"},
+	}
+	for _, tc := range cases {
+		if link, skip := resolveURLPath(c, tc.rawURL, cfg, log); skip || link != tc.want {
+			t.Errorf("解析 %s 错误, 期望: %s, 实际: %s %v", tc.rawURL, tc.want, link, skip)
+		}
+	}
+
+	cfg.Proxy.URLRedirect = false
+	if _, skip := resolveURLPath(c, "https://other.example.com/c.mkv", cfg, log); !skip {
+		t.Error("关闭 url_redirect 后没有匹配规则的链接应交给 Emby 处理")
+	}
+
+	if err := (config.URLRule{Match: "(", Resolver: config.URLResolverURL}).Validate(); err == nil {
+		t.Error("无效的正则应校验失败")
+	}
+	if err := (config.URLRule{Match: ".*", Resolver: "ftp"}).Validate(); err == nil {
+		t.Error("不支持的解析方式应校验失败")
+	}
+
+	// 试运行解析与播放使用相同的流程，项目 ID 会被转义
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("Ids") != "1&x" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"Items":[{"Id":"1&x","Path":"https://other.example.com/c.mkv"}]}`))
+	}))
+	defer emby.Close()
+	cfg.Proxy.URL = emby.URL
+	cfg.Proxy.URLRedirect = true
+
+	rec := httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/cinexus-api/admin/resolve/x", nil), rec)
+	c.SetParamNames("itemId")
+	c.SetParamValues("1&x")
+	if err := HandleResolveDryRun(c, cfg, log); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("试运行解析失败: %v %d %s", err, rec.Code, rec.Body.String())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"url":"https://other.example.com/c.mkv"`) || !strings.Contains(body, `"proxied_by_emby":false`) {
+		t.Errorf("试运行解析 .strm 链接的结果错误: %s", body)
+	}
+}
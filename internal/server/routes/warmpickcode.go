@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"cinexus/internal/config"
+	"cinexus/internal/helper"
+	"cinexus/internal/helper/emby"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// WarmPickcodeEnabled 判断是否需要预热 pickcode 缓存，只有 ck 和 ck+115open 方案会通过目录列表查找 pickcode
+func WarmPickcodeEnabled(cfg *config.Config) bool {
+	return cfg.Proxy.CachePickcode && (cfg.Proxy.Method == "ck" || cfg.Proxy.Method == "ck+115open")
+}
+
+// WarmPickcode 按播放时的路径映射找到新增媒体在 115 中的目录，列出一次目录并缓存其中所有文件的 pickcode
+func WarmPickcode(ctx context.Context, itemID string, cfg *config.Config, log *logger.Logger) error {
+	if !WarmPickcodeEnabled(cfg) {
+		log.Infof("未开启 pickcode 缓存或不是 ck 方案，跳过预热: ItemID=%s", itemID)
+		return nil
+	}
+
+	itemPath, err := emby.New(cfg).GetItemPath(itemID)
+	if err != nil {
+		return fmt.Errorf("获取媒体路径失败: %w", err)
+	}
+
+	embyPath := helper.EnsureLeadingSlash(itemPath)
+	cloudPath, ok := CloudPath(cfg, embyPath)
+	if !ok {
+		log.Infof("媒体路径不在路径映射中，跳过预热: %s", embyPath)
+		return nil
+	}
+
+	// 同一目录中的其他媒体已经预热过
+	if _, found := storage.GetPickcodeFromCache(cloudPath); found {
+		log.Debugf("pickcode 已缓存，跳过预热: %s", cloudPath)
+		return nil
+	}
+
+	lister, err := newDirLister(cfg)
+	if err != nil {
+		return err
+	}
+	return warmPickcodeDir(ctx, lister, cloudPath, log)
+}
+
+// warmPickcodeDir 列出文件所在的目录并缓存其中所有文件的 pickcode，目录不存在时不重试
+func warmPickcodeDir(ctx context.Context, lister dirLister, cloudPath string, log *logger.Logger) error {
+	start := time.Now()
+	dirPath := path.Dir(cloudPath)
+	cid, err := lister.DirID(dirPath)
+	if errors.Is(err, errCloudDirNotFound) {
+		return storage.NoRetry(fmt.Errorf("115 中不存在目录 %s", dirPath))
+	}
+	if err != nil {
+		return fmt.Errorf("获取目录 %s 的 CID 错误: %w", dirPath, err)
+	}
+
+	entries, err := lister.List(ctx, cid)
+	if err != nil {
+		return fmt.Errorf("列出目录 %s 错误: %w", dirPath, err)
+	}
+
+	caches := make([]storage.PickcodeCacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir {
+			caches = append(caches, entry.cacheEntry(path.Join(dirPath, entry.Name), cid))
+		}
+	}
+	cached, err := storage.SavePickcodeEntries(caches)
+	if err != nil {
+		return fmt.Errorf("批量缓存目录 %s 的 pickcode 失败: %w", dirPath, err)
+	}
+	log.Infof("🔥 pickcode 缓存预热完成: %s, 缓存: %d, 耗时: %v",
+		dirPath, cached, time.Since(start))
+
+	if _, found := storage.GetPickcodeFromCache(cloudPath); !found {
+		return fmt.Errorf("目录 %s 中找不到文件 %s", dirPath, path.Base(cloudPath))
+	}
+
+	return nil
+}
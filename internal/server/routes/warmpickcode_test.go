@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"context"
+	"testing"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+)
+
+func TestWarmPickcodeDir(t *testing.T) {
+	storage.DataDir = t.TempDir()
+	if err := storage.InitDB(); err != nil {
+		t.Fatalf("InitDB 失败: %v", err)
+	}
+	log := logger.New(config.LogConfig{Level: "error"})
+
+	lister := &fakeLister{dirs: map[string][]cloudEntry{
+		"1": {
+			{Name: "e1.mkv", ID: "11", Pickcode: "pe1"},
+			{Name: "e2.mkv", ID: "12", Pickcode: "pe2"},
+			{Name: "S01", ID: "2", IsDir: true},
+		},
+		// 目录不存在时不应列出根目录
+		"0": {{Name: "root.mkv", Pickcode: "proot"}},
+	}}
+
+	if err := warmPickcodeDir(context.Background(), lister, "/115/剧集/e1.mkv", log); err != nil {
+		t.Fatalf("预热失败: %v", err)
+	}
+	if cache, found := storage.GetPickcodeCache("/115/剧集/e2.mkv"); !found || cache.Pickcode != "pe2" || cache.ParentCID != "1" {
+		t.Errorf("同目录的文件应被缓存: %+v %v", cache, found)
+	}
+
+	err := warmPickcodeDir(context.Background(), lister, "/115/电影/root.mkv", log)
+	if !storage.IsNoRetry(err) {
+		t.Errorf("目录不存在时应返回不重试的错误: %v", err)
+	}
+	if _, found := storage.GetPickcodeFromCache("/115/电影/root.mkv"); found {
+		t.Error("目录不存在时不应缓存根目录中的文件")
+	}
+	if len(lister.listed) != 1 {
+		t.Errorf("目录不存在时不应列出目录, 已列出: %v", lister.listed)
+	}
+}
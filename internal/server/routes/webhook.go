@@ -1,25 +1,31 @@
 package routes
 
 import (
+	"bytes"
 	"cinexus/internal/config"
+	"cinexus/internal/helper"
+	"cinexus/internal/helper/emby"
 	"cinexus/internal/logger"
 	"cinexus/internal/storage"
-	"encoding/json"
 	"io"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
 )
 
 // EmbyWebhookRequest 定义 Emby webhook 请求的数据结构
 type EmbyWebhookRequest struct {
-	Title       string     `json:"Title"`
-	Description string     `json:"Description,omitempty"`
-	Date        time.Time  `json:"Date"`
-	Event       string     `json:"Event"`
-	Severity    string     `json:"Severity"`
-	Item        EmbyItem   `json:"Item"`
-	Server      EmbyServer `json:"Server"`
+	Title        string           `json:"Title"`
+	Description  string           `json:"Description,omitempty"`
+	Date         time.Time        `json:"Date"`
+	Event        string           `json:"Event"`
+	Severity     string           `json:"Severity"`
+	Item         EmbyItem         `json:"Item"`
+	Server       EmbyServer       `json:"Server"`
+	User         EmbyUser         `json:"User"`
+	Session      EmbySession      `json:"Session"`
+	PlaybackInfo EmbyPlaybackInfo `json:"PlaybackInfo"`
 }
 
 // EmbyItem 定义 Emby 媒体项目的数据结构
@@ -70,6 +76,27 @@ type ExternalURL struct {
 	Url  string `json:"Url"`
 }
 
+// EmbyUser 定义触发事件的 Emby 用户
+type EmbyUser struct {
+	Name string `json:"Name"`
+	Id   string `json:"Id"`
+}
+
+// EmbySession 定义播放事件的会话信息
+type EmbySession struct {
+	Id         string `json:"Id"`
+	Client     string `json:"Client"`
+	DeviceName string `json:"DeviceName"`
+	DeviceId   string `json:"DeviceId"`
+}
+
+// EmbyPlaybackInfo 定义播放事件的进度信息
+type EmbyPlaybackInfo struct {
+	PlayedToCompletion bool   `json:"PlayedToCompletion"`
+	PositionTicks      int64  `json:"PositionTicks"`
+	PlaySessionId      string `json:"PlaySessionId"`
+}
+
 // EmbyServer 定义 Emby 服务器的数据结构
 type EmbyServer struct {
 	Name    string `json:"Name"`
@@ -77,8 +104,27 @@ type EmbyServer struct {
 	Version string `json:"Version"`
 }
 
-// HandleEmbyWebhook 处理 Emby webhook 请求
-func HandleEmbyWebhook(c echo.Context, cfg *config.Config, log *logger.Logger) error {
+// webhookContext webhook 事件处理器可以访问的依赖
+type webhookContext struct {
+	cfg       *config.Config
+	log       *logger.Logger
+	linkCache *cache.Cache
+}
+
+// webhookHandler 处理一种 webhook 事件
+type webhookHandler func(w *webhookContext, data *WebhookEvent)
+
+// webhookHandlers 按事件类型注册的处理器，新增事件只需要在这里注册
+var webhookHandlers = map[string]webhookHandler{
+	"library.new":     handleLibraryNew,
+	"library.deleted": handleLibraryDeleted,
+	"item.update":     handleItemUpdate,
+	"playback.start":  handlePlaybackStart,
+	"playback.stop":   handlePlaybackStop,
+}
+
+// HandleWebhook 处理 webhook 请求，识别请求格式后按事件类型分发
+func HandleWebhook(c echo.Context, cfg *config.Config, log *logger.Logger, linkCache *cache.Cache) error {
 	// 读取请求体
 	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
@@ -86,36 +132,52 @@ func HandleEmbyWebhook(c echo.Context, cfg *config.Config, log *logger.Logger) e
 		return c.JSON(400, map[string]string{"error": "读取请求体失败"})
 	}
 
+	// 旧版 Emby 的 multipart 请求需要重新读取表单
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
 	// 解析 webhook 数据
-	var webhookData EmbyWebhookRequest
-	if err := json.Unmarshal(body, &webhookData); err != nil {
-		log.Errorf("Emby webhook JSON 解析失败: %v", err)
-		return c.JSON(400, map[string]string{"error": "JSON 解析失败"})
+	event, err := parseWebhookEvent(c, body)
+	if err != nil {
+		log.Errorf("webhook 解析失败: %v", err)
+		return c.JSON(400, map[string]string{"error": err.Error()})
 	}
 
-	// 处理不同类型的事件
-	switch webhookData.Event {
-	case "library.new":
-		handleLibraryNew(webhookData, cfg, log)
-	default:
-		log.Infof("收到事件类型: %s，暂不处理", webhookData.Event)
+	// 按事件类型分发
+	handler, ok := webhookHandlers[event.Event]
+	if !ok {
+		log.Infof("收到 %s 事件类型: %s，暂不处理", event.Source, event.Event)
+		return c.JSON(200, map[string]string{
+			"message": "ok",
+			"event":   event.Event,
+			"status":  "未处理",
+		})
 	}
 
+	handler(&webhookContext{cfg: cfg, log: log, linkCache: linkCache}, event)
+
 	return c.JSON(200, map[string]string{
 		"message": "ok",
-		"event":   webhookData.Event,
+		"event":   event.Event,
 		"status":  "已处理",
 	})
 }
 
-// handleLibraryNew 处理新增媒体事件
-func handleLibraryNew(data EmbyWebhookRequest, cfg *config.Config, log *logger.Logger) {
+// handleLibraryNew 处理新增媒体事件，按配置添加补充媒体信息和预热 pickcode 缓存的任务
+func handleLibraryNew(w *webhookContext, data *WebhookEvent) {
+	cfg, log := w.cfg, w.log
+
 	// 判断是否处理该事件
-	if !cfg.Server.ProcessNewMedia {
+	warmPickcode := WarmPickcodeEnabled(cfg)
+	if !cfg.Server.ProcessNewMedia && !warmPickcode {
 		log.Infof("新增媒体事件处理已禁用，跳过处理: %s", data.Item.Name)
 		return
 	}
 
+	if data.Item.Id == "" {
+		log.Warnf("新增媒体事件缺少 ItemID，跳过处理: %s", data.Item.Path)
+		return
+	}
+
 	// 获取持久化任务队列并添加任务
 	taskQueue := storage.GetTaskQueue()
 	if taskQueue == nil {
@@ -123,10 +185,135 @@ func handleLibraryNew(data EmbyWebhookRequest, cfg *config.Config, log *logger.L
 		return
 	}
 
-	// 添加任务到持久化队列
-	if err := taskQueue.AddTask(data.Item.Id); err != nil {
-		log.Errorf("添加媒体处理任务失败: %v", err)
+	itemIDs := []string{data.Item.Id}
+
+	// 剧集、季等文件夹无法直接获取播放信息，展开为可播放的子项目
+	if data.Item.IsFolder || emby.IsFolderType(data.Item.Type) {
+		var err error
+		itemIDs, err = expandFolderItem(cfg, data.Item.Id)
+		if err != nil {
+			log.Errorf("展开文件夹 %s (ItemID=%s) 失败: %v", data.Item.Name, data.Item.Id, err)
+			return
+		}
+		log.Infof("文件夹 %s 展开为 %d 个媒体", data.Item.Name, len(itemIDs))
+	}
+
+	// 预热任务排在前面，新增的媒体第一次播放时就能命中缓存
+	// 同一目录只会列出一次，其余媒体执行时直接命中缓存
+	if warmPickcode {
+		added, skipped, err := taskQueue.AddTypedTasks(storage.TaskTypeWarmPickcode, itemIDs)
+		if err != nil {
+			log.Errorf("添加预热 pickcode 缓存任务失败: %v", err)
+		} else {
+			log.Infof("预热 pickcode 缓存任务已添加到队列: 新增 %d 个, 跳过 %d 个已在队列中的任务", added, skipped)
+		}
+	}
+
+	if cfg.Server.ProcessNewMedia {
+		added, skipped, err := taskQueue.AddTasks(itemIDs)
+		if err != nil {
+			log.Errorf("添加媒体处理任务失败: %v", err)
+		} else {
+			log.Infof("媒体处理任务已添加到队列: 新增 %d 个, 跳过 %d 个已在队列中的任务", added, skipped)
+		}
+	}
+}
+
+// expandFolderItem 获取文件夹下所有可播放的子项目 ID，与 cinexus emby refresh-media 一致
+func expandFolderItem(cfg *config.Config, folderID string) ([]string, error) {
+	items, err := emby.New(cfg).GetFolderItems(folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	itemIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.IsFolder || emby.IsFolderType(item.Type) {
+			continue
+		}
+		itemIDs = append(itemIDs, item.Id)
+	}
+
+	return itemIDs, nil
+}
+
+// handleLibraryDeleted 处理删除媒体事件，清理该项目的直链缓存和 pickcode 缓存，文件夹会清理其下的所有文件
+func handleLibraryDeleted(w *webhookContext, data *WebhookEvent) {
+	w.log.Infof("🗑️ 媒体已删除: %s (ItemID=%s, Path=%s)", data.Item.Name, data.Item.Id, data.Item.Path)
+	w.invalidateItem(data.Item, data.Item.IsFolder)
+}
+
+// handleItemUpdate 处理媒体更新事件，文件可能被替换，清理缓存后重新查找
+// Emby 不发送该事件，由 Jellyfin 的 ItemUpdated 和通用 webhook 转换而来
+// 更新多数只是元数据变化，只清理项目自身文件的缓存，文件夹不会清理其下的 pickcode 缓存
+func handleItemUpdate(w *webhookContext, data *WebhookEvent) {
+	w.log.Infof("✏️ 媒体已更新: %s (ItemID=%s)", data.Item.Name, data.Item.Id)
+	w.invalidateItem(data.Item, false)
+}
+
+// handlePlaybackStart 记录开始播放
+func handlePlaybackStart(w *webhookContext, data *WebhookEvent) {
+	if err := storage.RecordPlaybackStart(newPlaybackEvent(data)); err != nil {
+		w.log.Warnf("记录开始播放失败: %v", err)
+		return
+	}
+	w.log.Debugf("▶️ %s 开始播放: %s", data.User.Name, data.Item.Name)
+}
+
+// handlePlaybackStop 记录停止播放
+func handlePlaybackStop(w *webhookContext, data *WebhookEvent) {
+	if err := storage.RecordPlaybackStop(newPlaybackEvent(data)); err != nil {
+		w.log.Warnf("记录停止播放失败: %v", err)
+		return
+	}
+	w.log.Debugf("⏹️ %s 停止播放: %s", data.User.Name, data.Item.Name)
+}
+
+// newPlaybackEvent 把 webhook 数据转换为播放事件
+func newPlaybackEvent(data *WebhookEvent) storage.PlaybackEvent {
+	return storage.PlaybackEvent{
+		UserID:             data.User.Id,
+		UserName:           data.User.Name,
+		ItemID:             data.Item.Id,
+		ItemName:           data.Item.Name,
+		ItemType:           data.Item.Type,
+		Client:             data.Session.Client,
+		DeviceName:         data.Session.DeviceName,
+		PositionTicks:      data.Session.PositionTicks,
+		PlayedToCompletion: data.Session.PlayedToCompletion,
+		Time:               data.Date,
+	}
+}
+
+// invalidateItem 清理项目的直链缓存和 pickcode 缓存，recursive 时清理文件夹下所有文件的 pickcode 缓存
+// 不清理下级时文件夹本身没有 pickcode 缓存，只清理直链缓存
+func (w *webhookContext) invalidateItem(item WebhookItem, recursive bool) {
+	embyPath := ""
+	if item.Path != "" {
+		embyPath = helper.EnsureLeadingSlash(item.Path)
+	}
+
+	links := purgeLinkCache(w.linkCache, item.Id, embyPath)
+
+	var pickcodes int64
+	if embyPath != "" && w.cfg.Proxy.CachePickcode {
+		if cloudPath, ok := CloudPath(w.cfg, embyPath); ok {
+			var err error
+			switch {
+			case item.IsFolder && recursive:
+				pickcodes, err = storage.DeletePickcodeByPrefix(cloudPath)
+			case !item.IsFolder:
+				err = storage.DeletePickcodeFromCache(cloudPath)
+			}
+			if err != nil {
+				w.log.Warnf("删除 pickcode 缓存失败: %v", err)
+			}
+		}
+	}
+
+	if item.IsFolder && recursive {
+		w.log.Infof("🧹 已清理缓存: ItemID=%s, 直链缓存 %d 条, pickcode 缓存 %d 条", item.Id, links, pickcodes)
 	} else {
-		log.Infof("媒体处理任务已添加到队列: ItemID=%s", data.Item.Id)
+		w.log.Infof("🧹 已清理缓存: ItemID=%s, 直链缓存 %d 条", item.Id, links)
 	}
 }
@@ -0,0 +1,221 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"cinexus/internal/helper/emby"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Webhook 事件来源
+const (
+	WebhookSourceEmby       = "emby"
+	WebhookSourceEmbyLegacy = "emby-legacy"
+	WebhookSourceJellyfin   = "jellyfin"
+	WebhookSourceGeneric    = "generic"
+)
+
+// WebhookEvent 归一化后的 webhook 事件，事件名统一使用 Emby 的命名
+type WebhookEvent struct {
+	Source  string
+	Event   string
+	Date    time.Time
+	Item    WebhookItem
+	User    WebhookUser
+	Session WebhookSession
+}
+
+// WebhookItem 事件关联的媒体项目
+type WebhookItem struct {
+	Id       string
+	Name     string
+	Type     string
+	Path     string
+	IsFolder bool
+}
+
+// WebhookUser 触发事件的用户
+type WebhookUser struct {
+	Id   string
+	Name string
+}
+
+// WebhookSession 播放事件的会话和进度
+type WebhookSession struct {
+	Client             string
+	DeviceName         string
+	PositionTicks      int64
+	PlayedToCompletion bool
+}
+
+// jellyfinEvents Jellyfin Webhook 插件的 NotificationType 到 Emby 事件名的映射
+var jellyfinEvents = map[string]string{
+	"ItemAdded":     "library.new",
+	"ItemDeleted":   "library.deleted",
+	"ItemUpdated":   "item.update",
+	"PlaybackStart": "playback.start",
+	"PlaybackStop":  "playback.stop",
+}
+
+// parseWebhookEvent 识别 webhook 请求的格式并转换为 WebhookEvent
+// 支持 Emby Premiere webhook JSON、旧版 Emby 的 multipart data 字段、Jellyfin Webhook 插件 JSON 和通用 JSON
+func parseWebhookEvent(c echo.Context, body []byte) (*WebhookEvent, error) {
+	source := ""
+
+	// 旧版 Emby 以 multipart/form-data 的 data 字段提交 JSON
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		data := c.FormValue("data")
+		if data == "" {
+			return nil, fmt.Errorf("multipart 请求中缺少 data 字段")
+		}
+		body = []byte(data)
+		source = WebhookSourceEmbyLegacy
+	}
+
+	// 按字段名识别 JSON 格式，encoding/json 的字段匹配不区分大小写，所以需要先看原始的键
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("JSON 解析失败: %w", err)
+	}
+
+	switch {
+	case fields["NotificationType"] != nil:
+		return parseJellyfinEvent(body)
+	case fields["Event"] != nil:
+		if source == "" {
+			source = WebhookSourceEmby
+		}
+		return parseEmbyEvent(body, source)
+	case fields["event"] != nil:
+		return parseGenericEvent(body)
+	default:
+		return nil, fmt.Errorf("无法识别的 webhook 格式")
+	}
+}
+
+// parseEmbyEvent 解析 Emby webhook JSON
+func parseEmbyEvent(body []byte, source string) (*WebhookEvent, error) {
+	var data EmbyWebhookRequest
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("Emby webhook JSON 解析失败: %w", err)
+	}
+
+	return &WebhookEvent{
+		Source: source,
+		Event:  data.Event,
+		Date:   data.Date,
+		Item: WebhookItem{
+			Id:       data.Item.Id,
+			Name:     data.Item.Name,
+			Type:     data.Item.Type,
+			Path:     data.Item.Path,
+			IsFolder: data.Item.IsFolder,
+		},
+		User: WebhookUser{
+			Id:   data.User.Id,
+			Name: data.User.Name,
+		},
+		Session: WebhookSession{
+			Client:             data.Session.Client,
+			DeviceName:         data.Session.DeviceName,
+			PositionTicks:      data.PlaybackInfo.PositionTicks,
+			PlayedToCompletion: data.PlaybackInfo.PlayedToCompletion,
+		},
+	}, nil
+}
+
+// JellyfinWebhookRequest Jellyfin Webhook 插件默认模板的数据结构，Path 需要在模板中自行添加
+type JellyfinWebhookRequest struct {
+	NotificationType      string `json:"NotificationType"`
+	UtcTimestamp          string `json:"UtcTimestamp"`
+	ItemId                string `json:"ItemId"`
+	ItemType              string `json:"ItemType"`
+	Name                  string `json:"Name"`
+	Path                  string `json:"Path"`
+	NotificationUsername  string `json:"NotificationUsername"`
+	UserId                string `json:"UserId"`
+	ClientName            string `json:"ClientName"`
+	DeviceName            string `json:"DeviceName"`
+	PlaybackPositionTicks int64  `json:"PlaybackPositionTicks"`
+	PlayedToCompletion    bool   `json:"PlayedToCompletion"`
+}
+
+// parseJellyfinEvent 解析 Jellyfin Webhook 插件 JSON
+func parseJellyfinEvent(body []byte) (*WebhookEvent, error) {
+	var data JellyfinWebhookRequest
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("Jellyfin webhook JSON 解析失败: %w", err)
+	}
+
+	// 时间格式取决于插件模板，无法解析时使用当前时间
+	date, err := time.Parse(time.RFC3339, data.UtcTimestamp)
+	if err != nil {
+		date = time.Now()
+	}
+
+	event, ok := jellyfinEvents[data.NotificationType]
+	if !ok {
+		// 未映射的事件保留原始名称，交给分发逻辑记录为暂不处理
+		event = data.NotificationType
+	}
+
+	return &WebhookEvent{
+		Source: WebhookSourceJellyfin,
+		Event:  event,
+		Date:   date,
+		Item: WebhookItem{
+			Id:       data.ItemId,
+			Name:     data.Name,
+			Type:     data.ItemType,
+			Path:     data.Path,
+			IsFolder: emby.IsFolderType(data.ItemType), // 插件不提供 IsFolder 字段
+		},
+		User: WebhookUser{
+			Id:   data.UserId,
+			Name: data.NotificationUsername,
+		},
+		Session: WebhookSession{
+			Client:             data.ClientName,
+			DeviceName:         data.DeviceName,
+			PositionTicks:      data.PlaybackPositionTicks,
+			PlayedToCompletion: data.PlayedToCompletion,
+		},
+	}, nil
+}
+
+// GenericWebhookRequest 通用 webhook JSON，event 使用 Emby 的事件名
+type GenericWebhookRequest struct {
+	Event    string `json:"event"`
+	ItemID   string `json:"item_id"`
+	Path     string `json:"path"`
+	Name     string `json:"name,omitempty"`
+	IsFolder bool   `json:"is_folder,omitempty"`
+}
+
+// parseGenericEvent 解析通用 webhook JSON
+func parseGenericEvent(body []byte) (*WebhookEvent, error) {
+	var data GenericWebhookRequest
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("通用 webhook JSON 解析失败: %w", err)
+	}
+
+	if data.ItemID == "" && data.Path == "" {
+		return nil, fmt.Errorf("item_id 和 path 不能同时为空")
+	}
+
+	return &WebhookEvent{
+		Source: WebhookSourceGeneric,
+		Event:  data.Event,
+		Date:   time.Now(),
+		Item: WebhookItem{
+			Id:       data.ItemID,
+			Name:     data.Name,
+			Path:     data.Path,
+			IsFolder: data.IsFolder,
+		},
+	}, nil
+}
@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+const embyLibraryNewJSON = `{
+	"Title": "新增 S01E01",
+	"Date": "2024-01-01T12:00:00.0000000Z",
+	"Event": "library.new",
+	"Item": {"Name": "S01E01", "Id": "123", "Path": "/media/show/S01E01.mkv", "Type": "Episode", "IsFolder": false},
+	"Server": {"Name": "emby", "Id": "srv", "Version": "4.8.0.0"}
+}`
+
+// newWebhookContext 创建 webhook 请求的 echo.Context
+func newWebhookContext(body []byte, contentType string) echo.Context {
+	req := httptest.NewRequest(http.MethodPost, "/cinexus-api/webhook/emby", bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, contentType)
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestParseWebhookEventEmby(t *testing.T) {
+	body := []byte(embyLibraryNewJSON)
+
+	event, err := parseWebhookEvent(newWebhookContext(body, echo.MIMEApplicationJSON), body)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if event.Source != WebhookSourceEmby || event.Event != "library.new" {
+		t.Fatalf("unexpected source or event: %+v", event)
+	}
+	if event.Item.Id != "123" || event.Item.Path != "/media/show/S01E01.mkv" || event.Item.Type != "Episode" {
+		t.Fatalf("unexpected item: %+v", event.Item)
+	}
+}
+
+func TestParseWebhookEventEmbyLegacyMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("data", embyLibraryNewJSON)
+	writer.Close()
+
+	event, err := parseWebhookEvent(newWebhookContext(buf.Bytes(), writer.FormDataContentType()), buf.Bytes())
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if event.Source != WebhookSourceEmbyLegacy || event.Event != "library.new" || event.Item.Id != "123" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+func TestParseWebhookEventJellyfin(t *testing.T) {
+	body := []byte(`{
+		"NotificationType": "PlaybackStop",
+		"UtcTimestamp": "2024-01-01T12:00:00Z",
+		"ItemId": "abc",
+		"ItemType": "Episode",
+		"Name": "S01E01",
+		"NotificationUsername": "alice",
+		"UserId": "u1",
+		"ClientName": "Jellyfin Web",
+		"DeviceName": "Firefox",
+		"PlaybackPositionTicks": 600000000,
+		"PlayedToCompletion": true
+	}`)
+
+	event, err := parseWebhookEvent(newWebhookContext(body, echo.MIMEApplicationJSON), body)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if event.Source != WebhookSourceJellyfin || event.Event != "playback.stop" {
+		t.Fatalf("unexpected source or event: %+v", event)
+	}
+	if event.User.Id != "u1" || event.User.Name != "alice" || event.Item.Id != "abc" {
+		t.Fatalf("unexpected user or item: %+v", event)
+	}
+	if event.Session.PositionTicks != 600000000 || !event.Session.PlayedToCompletion || event.Session.Client != "Jellyfin Web" {
+		t.Fatalf("unexpected session: %+v", event.Session)
+	}
+	if event.Date.Year() != 2024 {
+		t.Fatalf("unexpected date: %v", event.Date)
+	}
+}
+
+func TestParseWebhookEventJellyfinFolder(t *testing.T) {
+	body := []byte(`{"NotificationType": "ItemAdded", "ItemId": "s1", "ItemType": "Season", "UtcTimestamp": "not a time"}`)
+
+	event, err := parseWebhookEvent(newWebhookContext(body, echo.MIMEApplicationJSON), body)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if event.Event != "library.new" || !event.Item.IsFolder || event.Date.IsZero() {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+func TestParseWebhookEventGeneric(t *testing.T) {
+	body := []byte(`{"event": "library.deleted", "path": "/media/show"}`)
+
+	event, err := parseWebhookEvent(newWebhookContext(body, echo.MIMEApplicationJSON), body)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if event.Source != WebhookSourceGeneric || event.Event != "library.deleted" || event.Item.Path != "/media/show" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+func TestParseWebhookEventInvalid(t *testing.T) {
+	cases := map[string]string{
+		"not json":        `Event=library.new`,
+		"unknown format":  `{"foo": "bar"}`,
+		"generic no item": `{"event": "library.new"}`,
+	}
+
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseWebhookEvent(newWebhookContext([]byte(body), echo.MIMEApplicationJSON), []byte(body)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	// multipart 请求缺少 data 字段
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("other", "x")
+	writer.Close()
+	if _, err := parseWebhookEvent(newWebhookContext(buf.Bytes(), writer.FormDataContentType()), buf.Bytes()); err == nil || !strings.Contains(err.Error(), "data") {
+		t.Fatalf("expected missing data error, got %v", err)
+	}
+}
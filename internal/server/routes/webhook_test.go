@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+	"cinexus/internal/storage"
+
+	"github.com/patrickmn/go-cache"
+)
+
+func TestInvalidateItemOnUpdate(t *testing.T) {
+	storage.DataDir = t.TempDir()
+	if err := storage.InitDB(); err != nil {
+		t.Fatalf("InitDB 失败: %v", err)
+	}
+
+	w := &webhookContext{
+		cfg: &config.Config{Proxy: config.ProxyConfig{
+			CachePickcode: true,
+			Paths:         []config.Path{{Old: "/media", New: "/115", Real: "/115"}},
+		}},
+		log:       logger.New(config.LogConfig{Level: "error"}),
+		linkCache: cache.New(time.Minute, time.Minute),
+	}
+	for _, name := range []string{"e1.mkv", "e2.mkv"} {
+		if err := storage.SavePickcodeToCache("/115/剧集/S01/"+name, "p"+name); err != nil {
+			t.Fatalf("保存 pickcode 失败: %v", err)
+		}
+	}
+
+	// 文件夹的元数据更新不应清理其下的 pickcode 缓存
+	handleItemUpdate(w, &WebhookEvent{Event: "item.update", Item: WebhookItem{Id: "s1", Path: "/media/剧集/S01", IsFolder: true}})
+	for _, name := range []string{"e1.mkv", "e2.mkv"} {
+		if _, found := storage.GetPickcodeFromCache("/115/剧集/S01/" + name); !found {
+			t.Errorf("更新文件夹后 %s 的缓存不应被删除", name)
+		}
+	}
+
+	// 文件的更新只清理该文件
+	handleItemUpdate(w, &WebhookEvent{Event: "item.update", Item: WebhookItem{Id: "e1", Path: "/media/剧集/S01/e1.mkv"}})
+	if _, found := storage.GetPickcodeFromCache("/115/剧集/S01/e1.mkv"); found {
+		t.Error("更新文件后该文件的缓存应被删除")
+	}
+	if _, found := storage.GetPickcodeFromCache("/115/剧集/S01/e2.mkv"); !found {
+		t.Error("更新文件不应影响同目录的其他文件")
+	}
+
+	// 删除文件夹时清理其下所有文件
+	handleLibraryDeleted(w, &WebhookEvent{Event: "library.deleted", Item: WebhookItem{Id: "s1", Path: "/media/剧集/S01", IsFolder: true}})
+	if _, found := storage.GetPickcodeFromCache("/115/剧集/S01/e2.mkv"); found {
+		t.Error("删除文件夹后其下文件的缓存应被删除")
+	}
+}
@@ -2,13 +2,21 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"cinexus/internal/config"
+	"cinexus/internal/cookiechecker"
 	"cinexus/internal/filewatcher"
+	"cinexus/internal/helper/pan115"
 	"cinexus/internal/logger"
+	"cinexus/internal/notify"
+	"cinexus/internal/scheduler"
+	"cinexus/internal/server/middleware"
 	"cinexus/internal/server/routes"
+	"cinexus/internal/server/ui"
 	"cinexus/internal/storage"
 	"cinexus/internal/tokenrefresher"
 
@@ -22,7 +30,9 @@ type Server struct {
 	config         *config.Config
 	logger         *logger.Logger
 	tokenRefresher *tokenrefresher.TokenRefresher
+	cookieChecker  *cookiechecker.CookieChecker
 	fileWatcher    *filewatcher.FileWatcherManager
+	scheduler      *scheduler.Scheduler
 }
 
 // New 创建新的服务器实例
@@ -39,12 +49,12 @@ func New(cfg *config.Config, log *logger.Logger) *Server {
 	// 设置 echo
 	s.setupEcho()
 
+	// 初始化通知，需要在其他组件之前完成，以便它们的失败能够发出通知
+	s.setupNotifier()
+
 	// 设置中间件
 	s.setupMiddleware()
 
-	// 设置路由
-	s.setupRoutes()
-
 	// 初始化pickcode缓存数据库
 	s.setupPickcodeCache()
 
@@ -54,12 +64,38 @@ func New(cfg *config.Config, log *logger.Logger) *Server {
 	// 初始化并启动token刷新器
 	s.setupTokenRefresher()
 
+	// 初始化并启动115 Cookie 校验器
+	s.setupCookieChecker()
+
 	// 初始化并启动文件监控器
 	s.setupFileWatcher()
 
+	// 初始化并启动定时任务，定时任务通过任务队列执行
+	s.setupScheduler()
+
+	// 设置路由，管理 API 需要访问上面初始化的组件
+	s.setupRoutes()
+
 	return s
 }
 
+// setupNotifier 初始化通知分发器
+func (s *Server) setupNotifier() {
+	if !s.config.Notify.Enabled {
+		s.logger.Info("⚠️ 通知功能已禁用")
+		return
+	}
+
+	notifier, err := notify.New(s.config.Notify, s.logger)
+	if err != nil {
+		s.logger.Errorf("❌ 初始化通知失败: %v", err)
+		return
+	}
+
+	notify.SetDefault(notifier)
+	s.logger.Infof("🔔 通知功能已启用，共 %d 个通知渠道", len(s.config.Notify.Channels))
+}
+
 // setupPickcodeCache 初始化pickcode缓存数据库
 func (s *Server) setupPickcodeCache() {
 	if s.config.Proxy.CachePickcode {
@@ -96,6 +132,26 @@ func (s *Server) setupTokenRefresher() {
 	s.tokenRefresher.Start()
 }
 
+// setupCookieChecker 设置115 Cookie 校验器，仅在使用 ck 方案时启用
+func (s *Server) setupCookieChecker() {
+	if s.config.Proxy.Method != "ck" && s.config.Proxy.Method != "ck+115open" {
+		return
+	}
+
+	if s.config.Driver115.CheckInterval <= 0 {
+		s.logger.Info("⚠️ 115 Cookie 校验已禁用")
+		return
+	}
+
+	s.cookieChecker = cookiechecker.New(s.logger, cookiechecker.Config{
+		CheckInterval:  time.Duration(s.config.Driver115.CheckInterval) * time.Minute,
+		FallbackCookie: s.config.Driver115.Cookie,
+	})
+
+	cookiechecker.SetDefault(s.cookieChecker)
+	s.cookieChecker.Start()
+}
+
 // setupEcho 配置 echo 实例
 func (s *Server) setupEcho() {
 	// 隐藏 echo 横幅
@@ -115,13 +171,26 @@ func (s *Server) setupMiddleware() {
 	// 恢复中间件
 	s.echo.Use(echomiddleware.Recover())
 
-	// CORS 中间件
+	// 代理 Emby 的请求允许所有来源跨域
 	s.echo.Use(echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
+		Skipper:      isCinexusAPI,
 		AllowOrigins: []string{"*"},
 		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
 	}))
 
+	// /cinexus-api 只允许 admin.cors_origins 中的来源跨域，未配置时不允许跨域
+	apiCORS := echomiddleware.CORSConfig{
+		Skipper:      func(c echo.Context) bool { return !isCinexusAPI(c) },
+		AllowOrigins: s.config.Admin.CORSOrigins,
+		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, middleware.HeaderAPIKey, middleware.HeaderSignature},
+	}
+	if len(apiCORS.AllowOrigins) == 0 {
+		apiCORS.AllowOriginFunc = func(string) (bool, error) { return false, nil }
+	}
+	s.echo.Use(echomiddleware.CORSWithConfig(apiCORS))
+
 	// 请求 ID 中间件
 	s.echo.Use(echomiddleware.RequestID())
 
@@ -134,9 +203,22 @@ func (s *Server) setupMiddleware() {
 	// }))
 }
 
+// isCinexusAPI 判断请求是否访问 /cinexus-api
+func isCinexusAPI(c echo.Context) bool {
+	path := c.Request().URL.Path
+	return path == "/cinexus-api" || strings.HasPrefix(path, "/cinexus-api/")
+}
+
 // setupRoutes 配置应用程序路由
 func (s *Server) setupRoutes() {
-	routes.Setup(s.echo, s.config, s.logger)
+	routes.Setup(s.echo, s.config, s.logger, routes.Components{
+		TokenRefresher: s.tokenRefresher,
+		FileWatcher:    s.fileWatcher,
+		Scheduler:      s.scheduler,
+	})
+
+	// 内嵌的管理面板
+	ui.Register(s.echo)
 }
 
 // customErrorHandler 处理错误
@@ -177,13 +259,8 @@ func (s *Server) customErrorHandler(err error, c echo.Context) {
 func (s *Server) setupTaskQueue() {
 	s.logger.Info("🔄 正在初始化任务队列...")
 
-	// 创建回调函数包装器
-	playbackCallback := func(itemID string, cfg *config.Config) error {
-		return routes.GETPlaybackInfo(itemID, cfg)
-	}
-
-	// 创建并启动任务队列
-	taskQueue := storage.NewPersistentTaskQueue(s.config, s.logger, playbackCallback)
+	// 创建并启动任务队列，文件监控的任务处理函数在文件监控初始化后注册
+	taskQueue := storage.NewPersistentTaskQueue(s.config, s.logger, routes.TaskHandlers(s.config, s.logger))
 	if taskQueue != nil {
 		s.logger.Info("✅ 任务队列初始化成功")
 
@@ -214,6 +291,11 @@ func (s *Server) setupFileWatcher() {
 
 	s.fileWatcher = manager
 
+	// 开启 use_queue 的监控配置通过任务队列处理文件
+	if taskQueue := storage.GetTaskQueue(); taskQueue != nil {
+		taskQueue.RegisterHandler(storage.TaskTypeCopyFile, manager.CopyFileTaskHandler())
+	}
+
 	// 启动文件监控管理器
 	if err := s.fileWatcher.Start(); err != nil {
 		s.logger.Errorf("❌ 启动文件监控管理器失败: %v", err)
@@ -223,6 +305,67 @@ func (s *Server) setupFileWatcher() {
 	s.logger.Info("✅ 文件监控管理器初始化并启动成功")
 }
 
+// setupScheduler 设置定时任务调度器
+func (s *Server) setupScheduler() {
+	if !s.config.Scheduler.Enabled {
+		s.logger.Info("⚠️ 定时任务已禁用")
+		return
+	}
+
+	taskQueue := storage.GetTaskQueue()
+	if taskQueue == nil {
+		s.logger.Error("❌ 任务队列未初始化，无法启动定时任务")
+		return
+	}
+
+	jobs := scheduler.New(taskQueue, s.logger)
+	jobCfg := s.config.Scheduler
+	useCookie := s.config.Proxy.Method == "ck" || s.config.Proxy.Method == "ck+115open"
+
+	add := func(name, expr string, run scheduler.JobFunc) {
+		if expr == "" {
+			return
+		}
+		if err := jobs.Add(name, expr, run); err != nil {
+			s.logger.Errorf("❌ 添加定时任务失败: %v", err)
+		}
+	}
+
+	add("missing-media-info", jobCfg.MissingMediaInfo, func(ctx context.Context) (string, error) {
+		return routes.EnqueueMissingMediaInfo(ctx, s.config)
+	})
+
+	if s.config.Proxy.CachePickcode {
+		add("pickcode-validate", jobCfg.PickcodeValidate, routes.EnqueuePickcodeValidation)
+		add("pickcode-verify", jobCfg.PickcodeVerify, routes.EnqueuePickcodeVerification)
+	}
+
+	if useCookie {
+		add("cookie-check", jobCfg.CookieCheck, func(ctx context.Context) (string, error) {
+			if s.cookieChecker != nil {
+				if !s.cookieChecker.Check() {
+					return "", fmt.Errorf("115 Cookie 无效")
+				}
+			} else if err := pan115.CheckStoredCookie(s.config.Driver115.Cookie); err != nil {
+				return "", err
+			}
+			return "115 Cookie 有效", nil
+		})
+	}
+
+	add("cleanup", jobCfg.Cleanup, func(ctx context.Context) (string, error) {
+		deleted, err := taskQueue.ManualCleanup()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("清理了 %d 个旧任务", deleted), nil
+	})
+
+	taskQueue.RegisterHandler(storage.TaskTypeScheduledJob, jobs.TaskHandler())
+	s.scheduler = jobs
+	s.scheduler.Start()
+}
+
 // Start 启动服务器
 func (s *Server) Start(address string) error {
 	return s.echo.Start(address)
@@ -242,6 +385,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// 停止定时任务调度器，需要在任务队列之前停止
+	if s.scheduler != nil {
+		s.scheduler.Stop()
+	}
+
 	// 停止任务队列
 	if taskQueue := storage.GetTaskQueue(); taskQueue != nil {
 		s.logger.Info("🛑 正在停止任务队列...")
@@ -249,6 +397,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.logger.Info("✅ 任务队列已停止")
 	}
 
+	// 停止115 Cookie 校验器
+	if s.cookieChecker != nil {
+		s.cookieChecker.Stop()
+	}
+
 	// 停止token刷新器
 	if s.tokenRefresher != nil {
 		s.logger.Info("🛑 正在停止token刷新器...")
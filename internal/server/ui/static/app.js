@@ -0,0 +1,289 @@
+'use strict';
+
+const API = '/cinexus-api/admin';
+const KEY_STORAGE = 'cinexus-api-key';
+const REFRESH_INTERVAL = 5000;
+
+const $ = (id) => document.getElementById(id);
+const expanded = new Set();
+
+// api 调用管理 API，非 2xx 时抛出包含服务端错误信息的异常
+async function api(method, path) {
+  const res = await fetch(API + path, {
+    method,
+    headers: { 'X-Cinexus-Key': localStorage.getItem(KEY_STORAGE) || '' },
+  });
+  const body = await res.json().catch(() => ({}));
+  if (!res.ok) {
+    throw new Error(body.error || res.status + ' ' + res.statusText);
+  }
+  return body;
+}
+
+function escapeHTML(value) {
+  return String(value ?? '').replace(/[&<>"']/g, (ch) => ({
+    '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;',
+  })[ch]);
+}
+
+function formatTime(value) {
+  if (!value || value.startsWith('0001-')) return '-';
+  return new Date(value).toLocaleString();
+}
+
+// formatDuration 把 Go 的 time.Duration（纳秒）格式化为毫秒或秒
+function formatDuration(ns) {
+  const ms = ns / 1e6;
+  return ms < 1000 ? ms.toFixed(1) + 'ms' : (ms / 1000).toFixed(2) + 's';
+}
+
+function showMessage(text, isError) {
+  const el = $('message');
+  el.textContent = text;
+  el.className = 'message' + (isError ? ' error' : '');
+  clearTimeout(showMessage.timer);
+  showMessage.timer = setTimeout(() => el.classList.add('hidden'), 5000);
+}
+
+function renderList(el, rows) {
+  el.innerHTML = rows.map(([k, v]) => `<dt>${escapeHTML(k)}</dt><dd>${v}</dd>`).join('');
+}
+
+function status(ok, text) {
+  return `<span class="${ok ? 'ok' : 'bad'}">${escapeHTML(text)}</span>`;
+}
+
+async function loadSessions() {
+  const el = $('sessions');
+  try {
+    const { sessions } = await api('GET', '/sessions');
+    if (!sessions || sessions.length === 0) {
+      el.innerHTML = '<span class="muted">当前没有正在播放的会话</span>';
+      return;
+    }
+    el.innerHTML = '<table><thead><tr><th>用户</th><th>客户端</th><th>设备</th><th>正在播放</th><th>播放方式</th></tr></thead><tbody>' +
+      sessions.map((s) => {
+        const item = s.NowPlayingItem || {};
+        const name = item.SeriesName ? `${item.SeriesName} - ${item.Name}` : item.Name;
+        const playMethod = (s.PlayState && s.PlayState.PlayMethod) || '-';
+        return `<tr><td>${escapeHTML(s.UserName)}</td><td>${escapeHTML(s.Client)}</td>` +
+          `<td>${escapeHTML(s.DeviceName)}</td><td>${escapeHTML(name)}</td><td>${escapeHTML(playMethod)}</td></tr>`;
+      }).join('') + '</tbody></table>';
+  } catch (err) {
+    el.innerHTML = `<span class="bad">${escapeHTML(err.message)}</span>`;
+  }
+}
+
+function playResult(t) {
+  if (t.finished_at === undefined || t.finished_at.startsWith('0001-')) {
+    return '<span class="warn">解析中</span>';
+  }
+  if (t.skipped) {
+    return '<span class="warn">交给 Emby</span>';
+  }
+  return (t.fallbacks && t.fallbacks.length) ? '<span class="warn">降级</span>' : '<span class="ok">302</span>';
+}
+
+function playDetail(t) {
+  const steps = (t.steps || []).map((s) => `${escapeHTML(s.name)}: ${formatDuration(s.duration)}`).join('<br>');
+  const fallbacks = (t.fallbacks || []).map((f) => `<div class="warn">${escapeHTML(f)}</div>`).join('');
+  const errors = (t.errors || []).map((e) => `<div class="bad">${escapeHTML(e)}</div>`).join('');
+  return `<tr class="detail"><td colspan="6">${steps || '<span class="muted">无步骤记录</span>'}` +
+    `${fallbacks}${errors}${t.url ? `<div class="path">${escapeHTML(t.url)}</div>` : ''}` +
+    `${t.user_agent ? `<div class="muted">${escapeHTML(t.user_agent)}</div>` : ''}</td></tr>`;
+}
+
+async function loadPlays() {
+  const { active, recent } = await api('GET', '/plays?limit=50');
+  $('active-count').textContent = active.length;
+  $('plays').innerHTML = active.concat(recent).map((t) => {
+    const row = `<tr class="clickable" data-trace="${t.id}"><td>${formatTime(t.started_at)}</td>` +
+      `<td>${escapeHTML(t.item_id)}</td><td class="path">${escapeHTML(t.path)}</td><td>${escapeHTML(t.method)}</td>` +
+      `<td>${playResult(t)}</td><td>${formatDuration(t.duration)}</td></tr>`;
+    return expanded.has(String(t.id)) ? row + playDetail(t) : row;
+  }).join('') || '<tr><td colspan="6" class="muted">暂无记录</td></tr>';
+}
+
+async function loadToken() {
+  const t = await api('GET', '/token');
+  renderList($('token'), [
+    ['refresh token', status(t.has_refresh_token, t.has_refresh_token ? '已设置' : '未设置')],
+    ['access token', status(t.has_access_token, t.has_access_token ? '已设置' : '未设置')],
+    ['更新时间', formatTime(t.updated_at)],
+    ['上次刷新', formatTime(t.last_refresh_at)],
+    ['刷新错误', t.last_error ? status(false, t.last_error) : '-'],
+  ]);
+}
+
+async function loadCookie() {
+  const c = await api('GET', '/115/cookie');
+  const checked = c.last_checked_at && !c.last_checked_at.startsWith('0001-');
+  renderList($('cookie'), [
+    ['来源', escapeHTML(c.source || '未设置')],
+    ['客户端', escapeHTML(c.app || '-')],
+    ['状态', checked ? status(c.valid, c.valid ? '有效' : '失效') : '<span class="muted">未校验</span>'],
+    ['上次校验', formatTime(c.last_checked_at)],
+    ['校验错误', c.check_error ? status(false, c.check_error) : '-'],
+  ]);
+}
+
+async function loadCaches() {
+  const [link, pickcode] = await Promise.all([
+    api('GET', '/cache/link'),
+    api('GET', '/cache/pickcode').catch((err) => ({ error: err.message })),
+  ]);
+  renderList($('caches'), [
+    ['直链缓存', String(link.count)],
+    ['pickcode 缓存', pickcode.error ? status(false, pickcode.error) : String(pickcode.count)],
+  ]);
+}
+
+async function loadQueue() {
+  const filter = $('queue-filter').value;
+  const { status: counts, in_flight: inFlight, tasks } = await api('GET', '/queue?limit=50&status=' + encodeURIComponent(filter));
+  $('queue-status').textContent = Object.entries(counts).map(([k, v]) => `${k} ${v}`).join(' · ') + ` · 执行中 ${inFlight || 0}`;
+  $('queue').innerHTML = (tasks || []).map((t) => {
+    const actions = [];
+    if (t.Status === 'pending') actions.push(`<button data-action="queue-cancel" data-id="${t.ID}">取消</button>`);
+    if (t.Status === 'failed' || t.Status === 'canceled') actions.push(`<button data-action="queue-retry" data-id="${t.ID}">重试</button>`);
+    const cls = t.Status === 'failed' ? 'bad' : t.Status === 'completed' ? 'ok' : '';
+    return `<tr><td>${t.ID}</td><td>${escapeHTML(t.Type)}</td><td>${escapeHTML(t.ItemID)}</td><td class="${cls}">${escapeHTML(t.Status)}</td>` +
+      `<td>${t.Retries}</td><td>${formatTime(t.UpdatedAt)}</td><td class="path">${escapeHTML(t.ErrorMsg)}</td>` +
+      `<td>${actions.join(' ')}</td></tr>`;
+  }).join('') || '<tr><td colspan="8" class="muted">暂无任务</td></tr>';
+}
+
+async function loadJobs() {
+  const { enabled, jobs } = await api('GET', '/jobs');
+  if (!enabled) {
+    $('jobs').innerHTML = '<tr><td colspan="8" class="muted">定时任务未启用</td></tr>';
+    return;
+  }
+  $('jobs').innerHTML = (jobs || []).map((j) => {
+    const cls = j.last_status === 'failed' ? 'bad' : j.last_status === 'success' ? 'ok' : '';
+    return `<tr><td>${escapeHTML(j.name)}</td><td>${escapeHTML(j.schedule)}</td><td>${formatTime(j.next_run_at)}</td>` +
+      `<td class="${cls}">${escapeHTML(j.last_status || '-')}</td><td>${formatTime(j.last_finished_at)}</td>` +
+      `<td>${escapeHTML(j.last_duration || '-')}</td><td class="path">${escapeHTML(j.last_error || j.last_result || '-')}</td>` +
+      `<td><button data-action="job-run" data-name="${escapeHTML(j.name)}">立即执行</button></td></tr>`;
+  }).join('') || '<tr><td colspan="8" class="muted">没有定时任务</td></tr>';
+}
+
+async function loadFileWatcher() {
+  const { enabled, watchers } = await api('GET', '/filewatcher');
+  if (!enabled) {
+    $('filewatcher').innerHTML = '<tr><td colspan="7" class="muted">文件监控未启用</td></tr>';
+    return;
+  }
+  $('filewatcher').innerHTML = (watchers || []).map((w) =>
+    `<tr><td>${escapeHTML(w.name)}</td><td class="path">${escapeHTML(w.source_dir)} → ${escapeHTML(w.target_dir)} (${escapeHTML(w.copy_mode)})</td>` +
+    `<td>${status(w.watching, w.watching ? '监控中' : '已停止')}</td><td>${w.processed_count}</td><td>${w.error_count}</td>` +
+    `<td class="path">${escapeHTML(w.last_file || '-')}<br><span class="muted">${formatTime(w.last_processed_at)}</span></td>` +
+    `<td class="path">${w.last_error ? status(false, w.last_error) : '-'}</td></tr>`).join('');
+}
+
+async function refresh() {
+  const results = await Promise.allSettled([
+    loadPlays(), loadToken(), loadCookie(), loadCaches(), loadQueue(), loadJobs(), loadFileWatcher(),
+  ]);
+  loadSessions();
+
+  const failed = results.find((r) => r.status === 'rejected');
+  if (failed) {
+    showMessage(failed.reason.message, true);
+  }
+  $('updated-at').textContent = '更新于 ' + new Date().toLocaleTimeString();
+}
+
+// pollQRCode 轮询扫码状态，直到登录成功、过期或取消
+async function pollQRCode(uid) {
+  const box = $('qrcode');
+  const text = box.querySelector('p');
+  try {
+    const res = await api('GET', '/115/cookie/qrcode/' + encodeURIComponent(uid));
+    text.textContent = res.message || res.status;
+    if (res.status === 'waiting' || res.status === 'scanned') {
+      setTimeout(() => pollQRCode(uid), 2000);
+      return;
+    }
+    if (res.status === 'success') {
+      showMessage('115 Cookie 登录成功');
+      refresh();
+    }
+  } catch (err) {
+    text.textContent = err.message;
+    return;
+  }
+  setTimeout(() => box.classList.add('hidden'), 3000);
+}
+
+const actions = {
+  'token-refresh': () => api('POST', '/token/refresh').then(() => 'token 已刷新'),
+  'cookie-check': () => api('POST', '/115/cookie/check').then(() => 'Cookie 校验完成'),
+  'cookie-login': async () => {
+    const res = await api('POST', '/115/cookie/qrcode');
+    const box = $('qrcode');
+    box.querySelector('img').src = res.image;
+    box.querySelector('p').textContent = '请使用 115 App 扫码';
+    box.classList.remove('hidden');
+    pollQRCode(res.uid);
+  },
+  'link-flush': () => api('DELETE', '/cache/link').then((r) => `已清空 ${r.deleted} 条直链缓存`),
+  'pickcode-prefix': async () => {
+    const prefix = $('pickcode-prefix').value.trim();
+    if (!prefix) throw new Error('请输入目录前缀');
+    if (!confirm(`确定删除 ${prefix} 下的 pickcode 缓存？`)) return;
+    const r = await api('DELETE', '/cache/pickcode?prefix=' + encodeURIComponent(prefix));
+    return `已删除 ${r.deleted} 条 pickcode 缓存`;
+  },
+  'resolve': async () => {
+    const itemID = $('resolve-item').value.trim();
+    if (!itemID) throw new Error('请输入 Item ID');
+    const r = await api('GET', '/resolve/' + encodeURIComponent(itemID));
+    const pre = $('resolve-result');
+    pre.textContent = JSON.stringify(r, null, 2);
+    pre.classList.remove('hidden');
+  },
+  'queue-purge': () => api('DELETE', '/queue?status=completed&older_than=7d').then((r) => `已清理 ${r.deleted} 个任务`),
+  'queue-retry': (btn) => api('POST', `/queue/${btn.dataset.id}/retry`).then(() => `任务 ${btn.dataset.id} 已重新排队`),
+  'job-run': (btn) => api('POST', `/jobs/${encodeURIComponent(btn.dataset.name)}/run`).then(() => `定时任务 ${btn.dataset.name} 已加入队列`),
+  'queue-cancel': (btn) => api('POST', `/queue/${btn.dataset.id}/cancel`).then(() => `任务 ${btn.dataset.id} 已取消`),
+};
+
+document.addEventListener('click', async (event) => {
+  const btn = event.target.closest('button[data-action]');
+  if (btn) {
+    btn.disabled = true;
+    try {
+      const msg = await actions[btn.dataset.action](btn);
+      if (msg) showMessage(msg);
+      refresh();
+    } catch (err) {
+      showMessage(err.message, true);
+    } finally {
+      btn.disabled = false;
+    }
+    return;
+  }
+
+  const row = event.target.closest('tr[data-trace]');
+  if (row) {
+    const id = row.dataset.trace;
+    expanded.has(id) ? expanded.delete(id) : expanded.add(id);
+    loadPlays().catch((err) => showMessage(err.message, true));
+  }
+});
+
+$('save-key').addEventListener('click', () => {
+  localStorage.setItem(KEY_STORAGE, $('api-key').value);
+  refresh();
+});
+
+$('queue-filter').addEventListener('change', () => loadQueue().catch((err) => showMessage(err.message, true)));
+
+$('api-key').value = localStorage.getItem(KEY_STORAGE) || '';
+
+setInterval(() => {
+  if ($('auto-refresh').checked && !document.hidden) refresh();
+}, REFRESH_INTERVAL);
+
+refresh();
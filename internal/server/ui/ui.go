@@ -0,0 +1,19 @@
+package ui
+
+import (
+	"embed"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Prefix 管理面板的访问路径
+const Prefix = "/cinexus-ui"
+
+//go:embed static
+var static embed.FS
+
+// Register 在 /cinexus-ui 提供内嵌的管理面板页面
+// 页面本身不需要认证，所有数据都通过管理 API 获取，API 密钥保存在浏览器本地
+func Register(e *echo.Echo) {
+	e.StaticFS(Prefix, echo.MustSubFS(static, "static"))
+}
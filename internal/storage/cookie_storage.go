@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Cookie115 定义 115 Cookie 的存储结构
+type Cookie115 struct {
+	Cookie        string    `json:"cookie"`
+	App           string    `json:"app"`             // 扫码登录时使用的客户端类型
+	UpdatedAt     time.Time `json:"updated_at"`      // Cookie 写入时间
+	LastCheckedAt time.Time `json:"last_checked_at"` // 最后一次校验时间
+	Valid         bool      `json:"valid"`           // 最后一次校验是否有效
+	CheckError    string    `json:"check_error"`     // 最后一次校验的错误信息
+}
+
+var CookieFile = "115_cookie.json"
+
+// 内存中的 Cookie，播放时不需要每次读取文件，文件修改时间变化时重新读取
+var (
+	cookieCacheMu      sync.RWMutex
+	cookieCache        *Cookie115
+	cookieCacheModTime time.Time
+	cookieCacheSize    int64
+)
+
+// getCookiePath 获取完整的 cookie 文件路径
+func getCookiePath() string {
+	return DataDir + "/" + CookieFile
+}
+
+// ReadCookie 从 JSON 文件读取 115 Cookie
+func ReadCookie() (*Cookie115, error) {
+	// 确保数据目录存在
+	if err := EnsureDataDir(); err != nil {
+		return nil, fmt.Errorf("创建数据目录失败: %w", err)
+	}
+
+	// 检查文件是否存在
+	if _, err := os.Stat(getCookiePath()); os.IsNotExist(err) {
+		// 如果文件不存在，返回空的 cookie 结构
+		return &Cookie115{}, nil
+	}
+
+	data, err := os.ReadFile(getCookiePath())
+	if err != nil {
+		return nil, fmt.Errorf("读取 cookie 文件失败: %w", err)
+	}
+
+	var cookie Cookie115
+	if err := json.Unmarshal(data, &cookie); err != nil {
+		return nil, fmt.Errorf("解析 cookie JSON 失败: %w", err)
+	}
+
+	return &cookie, nil
+}
+
+// WriteCookie 将 115 Cookie 写入 JSON 文件（带锁保护），新写入的 Cookie 视为有效
+func WriteCookie(cookie, app string) error {
+	now := time.Now()
+	return saveCookie(&Cookie115{
+		Cookie:        cookie,
+		App:           app,
+		UpdatedAt:     now,
+		LastCheckedAt: now,
+		Valid:         true,
+	})
+}
+
+// UpdateCookieStatus 更新 Cookie 的校验状态（带锁保护）
+func UpdateCookieStatus(valid bool, checkErr error) error {
+	return modifyCookie(func(cookie *Cookie115) {
+		cookie.LastCheckedAt = time.Now()
+		cookie.Valid = valid
+		cookie.CheckError = ""
+		if checkErr != nil {
+			cookie.CheckError = checkErr.Error()
+		}
+	})
+}
+
+// GetCookie 获取当前可用的 115 Cookie，存储中没有时使用 fallback（通常为配置文件中的 cookie）
+func GetCookie(fallback string) string {
+	cookie, err := cachedCookie()
+	if err != nil || cookie.Cookie == "" {
+		return fallback
+	}
+	return cookie.Cookie
+}
+
+// cachedCookie 返回内存中的 Cookie，只检查文件的修改时间和大小
+// 本进程写入时直接更新内存，cinexus login 等其他进程写入文件后重新读取
+func cachedCookie() (Cookie115, error) {
+	info, err := os.Stat(getCookiePath())
+	if os.IsNotExist(err) {
+		return Cookie115{}, nil
+	}
+	if err != nil {
+		return Cookie115{}, fmt.Errorf("读取 cookie 文件信息失败: %w", err)
+	}
+
+	cookieCacheMu.RLock()
+	if cookieCache != nil && info.ModTime().Equal(cookieCacheModTime) && info.Size() == cookieCacheSize {
+		cookie := *cookieCache
+		cookieCacheMu.RUnlock()
+		return cookie, nil
+	}
+	cookieCacheMu.RUnlock()
+
+	cookie, err := ReadCookie()
+	if err != nil {
+		return Cookie115{}, err
+	}
+	setCookieCache(cookie, info)
+	return *cookie, nil
+}
+
+// setCookieCache 更新内存中的 Cookie 以及对应的文件修改时间和大小
+func setCookieCache(cookie *Cookie115, info os.FileInfo) {
+	cached := *cookie
+
+	cookieCacheMu.Lock()
+	defer cookieCacheMu.Unlock()
+	cookieCache = &cached
+	cookieCacheModTime = info.ModTime()
+	cookieCacheSize = info.Size()
+}
+
+// modifyCookie 读取、修改并写回 Cookie（带锁保护）
+func modifyCookie(fn func(cookie *Cookie115)) error {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	lockFile, err := acquireFileLock()
+	if err != nil {
+		return fmt.Errorf("获取文件锁失败: %w", err)
+	}
+	defer func() {
+		if releaseErr := releaseFileLock(lockFile); releaseErr != nil {
+			fmt.Printf("警告: 释放文件锁失败: %v\n", releaseErr)
+		}
+	}()
+
+	cookie, err := ReadCookie()
+	if err != nil {
+		return fmt.Errorf("读取现有 cookie 失败: %w", err)
+	}
+
+	fn(cookie)
+
+	return writeCookieFile(cookie)
+}
+
+// saveCookie 完全重写 Cookie 文件（带锁保护）
+func saveCookie(cookie *Cookie115) error {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	lockFile, err := acquireFileLock()
+	if err != nil {
+		return fmt.Errorf("获取文件锁失败: %w", err)
+	}
+	defer func() {
+		if releaseErr := releaseFileLock(lockFile); releaseErr != nil {
+			fmt.Printf("警告: 释放文件锁失败: %v\n", releaseErr)
+		}
+	}()
+
+	return writeCookieFile(cookie)
+}
+
+// writeCookieFile 序列化并写入 Cookie 文件（不加锁）
+func writeCookieFile(cookie *Cookie115) error {
+	if err := EnsureDataDir(); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+
+	data, err := json.MarshalIndent(cookie, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化 cookie 为 JSON 失败: %w", err)
+	}
+
+	// Cookie 等同于账号密码，仅允许当前用户读写
+	if err := os.WriteFile(getCookiePath(), data, 0600); err != nil {
+		return fmt.Errorf("写入 cookie 文件失败: %w", err)
+	}
+
+	if info, err := os.Stat(getCookiePath()); err == nil {
+		setCookieCache(cookie, info)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCookieStorage(t *testing.T) {
+	// 使用临时目录进行测试
+	tempDir := "/tmp/test_cookie_data"
+	originalDataDir := DataDir
+
+	DataDir = tempDir
+
+	defer func() {
+		os.RemoveAll(tempDir)
+		DataDir = originalDataDir
+	}()
+
+	// 1. 没有保存 Cookie 时使用 fallback
+	if cookie := GetCookie("UID=fallback"); cookie != "UID=fallback" {
+		t.Errorf("未保存 Cookie 时应该使用 fallback, 实际: %s", cookie)
+	}
+
+	// 2. 写入 Cookie
+	testCookie := "UID=1;CID=2;SEID=3;KID=4"
+	if err := WriteCookie(testCookie, "tv"); err != nil {
+		t.Fatalf("WriteCookie 失败: %v", err)
+	}
+
+	if cookie := GetCookie("UID=fallback"); cookie != testCookie {
+		t.Errorf("Cookie 不匹配. 期望: %s, 实际: %s", testCookie, cookie)
+	}
+
+	cookie, err := ReadCookie()
+	if err != nil {
+		t.Fatalf("ReadCookie 失败: %v", err)
+	}
+
+	if !cookie.Valid || cookie.App != "tv" || cookie.UpdatedAt.IsZero() {
+		t.Errorf("新写入的 Cookie 状态不正确: %+v", cookie)
+	}
+
+	// 3. 更新校验状态，Cookie 本身保持不变
+	if err := UpdateCookieStatus(false, errors.New("cookie expired")); err != nil {
+		t.Fatalf("UpdateCookieStatus 失败: %v", err)
+	}
+
+	cookie, err = ReadCookie()
+	if err != nil {
+		t.Fatalf("ReadCookie after update 失败: %v", err)
+	}
+
+	if cookie.Valid || cookie.CheckError != "cookie expired" {
+		t.Errorf("校验状态未更新: %+v", cookie)
+	}
+
+	if cookie.Cookie != testCookie {
+		t.Errorf("更新校验状态后 Cookie 应该保持不变. 期望: %s, 实际: %s", testCookie, cookie.Cookie)
+	}
+
+	// 4. 其他进程（如 cinexus login）直接写入文件后，内存中的 Cookie 会重新读取
+	if err := os.WriteFile(getCookiePath(), []byte(`{"cookie":"UID=login;CID=2;SEID=3;KID=4"}`), 0600); err != nil {
+		t.Fatalf("写入 cookie 文件失败: %v", err)
+	}
+	if cookie := GetCookie("UID=fallback"); cookie != "UID=login;CID=2;SEID=3;KID=4" {
+		t.Errorf("文件被修改后应读取新的 Cookie, 实际: %s", cookie)
+	}
+}
@@ -27,8 +27,9 @@ func InitDB() error {
 		// 统一数据库文件路径
 		dbPath := filepath.Join(DataDir, "storage.db")
 
-		// 打开数据库连接
-		db, dbErr = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+		// 打开数据库连接，服务运行时命令行也会访问同一个数据库
+		// WAL 模式下读写互不阻塞，写入冲突时最多等待 5 秒
+		db, dbErr = gorm.Open(sqlite.Open(dbPath+"?_busy_timeout=5000&_journal_mode=WAL"), &gorm.Config{
 			Logger: logger.Default.LogMode(logger.Silent), // 静默模式，避免过多日志
 		})
 
@@ -38,9 +39,16 @@ func InitDB() error {
 
 		// 自动迁移所有表结构
 		dbErr = db.AutoMigrate(
-			&PickcodeCache{}, // pickcode 缓存表
-			&MediaTask{},     // 媒体任务表
+			&PickcodeCache{},  // pickcode 缓存表
+			&MediaTask{},      // 媒体任务表
+			&PlaybackRecord{}, // 播放记录表
+			&PickcodeCrawl{},  // pickcode 遍历检查点表
 		)
+		if dbErr != nil {
+			return
+		}
+
+		dbErr = migrateMediaTasks(db)
 	})
 
 	return dbErr
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+)
+
+// setupTestDB 在临时目录中初始化独立的数据库，测试结束后恢复
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	originalDataDir := DataDir
+	DataDir = t.TempDir()
+
+	db, dbOnce, dbErr = nil, sync.Once{}, nil
+	if err := InitDB(); err != nil {
+		t.Fatalf("InitDB 失败: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		db, dbOnce, dbErr = nil, sync.Once{}, nil
+		DataDir = originalDataDir
+	})
+}
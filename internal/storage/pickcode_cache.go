@@ -1,16 +1,32 @@
 package storage
 
 import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // PickcodeCache 表示 pickcode 缓存的数据库模型
 type PickcodeCache struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	FilePath  string    `gorm:"uniqueIndex;not null" json:"file_path"` // 文件路径作为唯一索引
-	Pickcode  string    `gorm:"not null" json:"pickcode"`              // 115 pickcode
+	FilePath  string    `gorm:"uniqueIndex;not null" json:"file_path"`         // 文件路径作为唯一索引
+	Pickcode  string    `gorm:"not null;index" json:"pickcode"`                // 115 pickcode
+	FileID    string    `json:"file_id,omitempty"`                             // 115 文件 ID
+	Size      int64     `json:"size,omitempty"`                                // 文件大小
+	SHA1      string    `gorm:"column:sha1;index" json:"sha1,omitempty"`       // 文件内容的 SHA1，用于识别重复上传和重命名的文件
+	ParentCID string    `gorm:"column:parent_cid" json:"parent_cid,omitempty"` // 所在目录的 CID，同目录的文件不需要再通过路径查找目录
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// LastVerifiedAt 最近一次通过 115 确认 pickcode 有效的时间，为空时从未确认过，如导入的缓存
+	LastVerifiedAt *time.Time `gorm:"index" json:"last_verified_at,omitempty"`
 }
 
 // InitPickcodeDB 初始化 pickcode 缓存数据库
@@ -36,6 +52,155 @@ func GetPickcodeFromCache(filePath string) (string, bool) {
 	return cache.Pickcode, true
 }
 
+// GetPickcodeCache 获取文件的完整缓存记录
+func GetPickcodeCache(filePath string) (*PickcodeCache, bool) {
+	db := GetDB()
+	if db == nil {
+		return nil, false
+	}
+
+	var cache PickcodeCache
+	if err := db.Where("file_path = ?", filePath).First(&cache).Error; err != nil {
+		return nil, false
+	}
+	return &cache, true
+}
+
+// GetPickcodeCacheByPickcode 按 pickcode 查找缓存记录
+func GetPickcodeCacheByPickcode(pickcode string) (*PickcodeCache, bool) {
+	db := GetDB()
+	if db == nil {
+		return nil, false
+	}
+
+	var cache PickcodeCache
+	if err := db.Where("pickcode = ?", pickcode).First(&cache).Error; err != nil {
+		return nil, false
+	}
+	return &cache, true
+}
+
+// FindPickcodeCachesBySHA1 按 SHA1 查找缓存记录，同一个文件上传了多份时会返回多条
+func FindPickcodeCachesBySHA1(sha1 string) ([]PickcodeCache, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, InitDB()
+	}
+
+	var caches []PickcodeCache
+	err := db.Where("sha1 = ?", strings.ToUpper(sha1)).Order("file_path").Find(&caches).Error
+	return caches, err
+}
+
+// PickcodeDuplicate 表示 SHA1 相同的多个文件
+type PickcodeDuplicate struct {
+	SHA1  string   `json:"sha1"`
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+}
+
+// FindDuplicatePickcodeCaches 查找 SHA1 相同的文件，即重复上传的文件，按文件大小倒序
+func FindDuplicatePickcodeCaches() ([]PickcodeDuplicate, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, InitDB()
+	}
+
+	var groups []struct {
+		SHA1 string `gorm:"column:sha1"`
+		Size int64
+	}
+	err := db.Model(&PickcodeCache{}).Select("sha1, MAX(size) AS size").
+		Where("sha1 <> ''").Group("sha1").Having("COUNT(*) > 1").
+		Order("size DESC").Scan(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := make([]PickcodeDuplicate, 0, len(groups))
+	for _, group := range groups {
+		var paths []string
+		if err := db.Model(&PickcodeCache{}).Where("sha1 = ?", group.SHA1).Order("file_path").Pluck("file_path", &paths).Error; err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, PickcodeDuplicate{SHA1: group.SHA1, Size: group.Size, Paths: paths})
+	}
+	return duplicates, nil
+}
+
+// GetCachedDirCID 从目录中已缓存的文件获取目录的 CID，没有记录时返回 false
+func GetCachedDirCID(dir string) (string, bool) {
+	db := GetDB()
+	if db == nil {
+		return "", false
+	}
+
+	prefix := escapeLike(strings.TrimRight(dir, "/")) + "/"
+	var cache PickcodeCache
+	err := db.Where("file_path LIKE ? ESCAPE '\\' AND file_path NOT LIKE ? ESCAPE '\\' AND parent_cid <> ''", prefix+"%", prefix+"%/%").
+		Order("updated_at DESC").First(&cache).Error
+	if err != nil {
+		return "", false
+	}
+	return cache.ParentCID, true
+}
+
+// SavePickcodeEntries 批量保存从 115 目录列表得到的缓存，已存在的记录会被覆盖，返回写入的数量
+func SavePickcodeEntries(entries []PickcodeCacheEntry) (int64, error) {
+	db := GetDB()
+	if db == nil {
+		return 0, InitDB()
+	}
+
+	now := time.Now()
+	var saved int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		saved, err = upsertPickcodeEntries(tx, entries, &now, true)
+		return err
+	})
+	return saved, err
+}
+
+// pickcodeUpdateColumns 覆盖已存在的缓存时更新的列
+var pickcodeUpdateColumns = []string{"pickcode", "file_id", "size", "sha1", "parent_cid", "updated_at", "last_verified_at"}
+
+// upsertPickcodeEntries 分批写入缓存，verifiedAt 为确认时间，overwrite 为 false 时保留已存在的记录
+func upsertPickcodeEntries(tx *gorm.DB, entries []PickcodeCacheEntry, verifiedAt *time.Time, overwrite bool) (int64, error) {
+	onConflict := clause.OnConflict{Columns: []clause.Column{{Name: "file_path"}}, DoNothing: true}
+	if overwrite {
+		onConflict = clause.OnConflict{
+			Columns:   []clause.Column{{Name: "file_path"}},
+			DoUpdates: clause.AssignmentColumns(pickcodeUpdateColumns),
+		}
+	}
+
+	var written int64
+	for start := 0; start < len(entries); start += pickcodeBatchSize {
+		end := min(start+pickcodeBatchSize, len(entries))
+		caches := make([]PickcodeCache, 0, end-start)
+		for _, entry := range entries[start:end] {
+			caches = append(caches, PickcodeCache{
+				FilePath:       entry.FilePath,
+				Pickcode:       entry.Pickcode,
+				FileID:         entry.FileID,
+				Size:           entry.Size,
+				SHA1:           strings.ToUpper(entry.SHA1),
+				ParentCID:      entry.ParentCID,
+				UpdatedAt:      entry.UpdatedAt,
+				LastVerifiedAt: verifiedAt,
+			})
+		}
+
+		result := tx.Clauses(onConflict).Create(&caches)
+		if result.Error != nil {
+			return written, result.Error
+		}
+		written += result.RowsAffected
+	}
+	return written, nil
+}
+
 // SavePickcodeToCache 保存 pickcode 到缓存
 func SavePickcodeToCache(filePath, pickcode string) error {
 	db := GetDB()
@@ -43,9 +208,12 @@ func SavePickcodeToCache(filePath, pickcode string) error {
 		return InitDB()
 	}
 
+	// pickcode 都是刚从 115 获取的，保存时即为已确认
+	now := time.Now()
 	cache := PickcodeCache{
-		FilePath: filePath,
-		Pickcode: pickcode,
+		FilePath:       filePath,
+		Pickcode:       pickcode,
+		LastVerifiedAt: &now,
 	}
 
 	// 使用 Upsert 操作，如果存在则更新，不存在则插入
@@ -56,12 +224,62 @@ func SavePickcodeToCache(filePath, pickcode string) error {
 	} else {
 		// 记录存在，更新
 		return db.Model(&PickcodeCache{}).Where("file_path = ?", filePath).Updates(map[string]interface{}{
-			"pickcode":   pickcode,
-			"updated_at": time.Now(),
+			"pickcode":         pickcode,
+			"updated_at":       now,
+			"last_verified_at": now,
 		}).Error
 	}
 }
 
+// MarkPickcodesVerified 记录这些文件的 pickcode 刚通过 115 确认有效
+func MarkPickcodesVerified(filePaths []string) error {
+	db := GetDB()
+	if db == nil {
+		return InitDB()
+	}
+
+	now := time.Now()
+	for start := 0; start < len(filePaths); start += pickcodeBatchSize {
+		end := min(start+pickcodeBatchSize, len(filePaths))
+		err := db.Model(&PickcodeCache{}).Where("file_path IN ?", filePaths[start:end]).
+			Update("last_verified_at", now).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListUnverifiedPickcodeDirs 抽取最久没有确认过（或从未确认过）的 limit 个缓存，返回它们所在的目录
+// 只包括 olderThan 之内没有确认过的缓存，从未确认过的排在最前面
+func ListUnverifiedPickcodeDirs(olderThan time.Duration, limit int) ([]string, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, InitDB()
+	}
+
+	var paths []string
+	err := db.Model(&PickcodeCache{}).
+		Where("last_verified_at IS NULL OR last_verified_at < ?", time.Now().Add(-olderThan)).
+		Order("last_verified_at IS NOT NULL, last_verified_at, updated_at").
+		Limit(limit).
+		Pluck("file_path", &paths).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		dir := path.Dir(p)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
 // DeletePickcodeFromCache 从缓存中删除 pickcode
 func DeletePickcodeFromCache(filePath string) error {
 	db := GetDB()
@@ -72,6 +290,66 @@ func DeletePickcodeFromCache(filePath string) error {
 	return db.Where("file_path = ?", filePath).Delete(&PickcodeCache{}).Error
 }
 
+// DeletePickcodeByPrefix 删除指定目录下的所有 pickcode 缓存，返回删除的数量
+func DeletePickcodeByPrefix(prefix string) (int64, error) {
+	db := GetDB()
+	if db == nil {
+		return 0, InitDB()
+	}
+
+	if prefix == "" {
+		return 0, fmt.Errorf("目录前缀不能为空")
+	}
+
+	// 按目录前缀匹配
+	result := db.Where("file_path LIKE ? ESCAPE '\\'", escapeLike(strings.TrimRight(prefix, "/"))+"/%").Delete(&PickcodeCache{})
+	return result.RowsAffected, result.Error
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// ListPickcodeDirs 列出缓存中所有文件所在的目录，按路径排序
+func ListPickcodeDirs() ([]string, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, InitDB()
+	}
+
+	var paths []string
+	if err := db.Model(&PickcodeCache{}).Pluck("file_path", &paths).Error; err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		dir := path.Dir(p)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// ListPickcodesInDir 列出目录中直接包含的文件的缓存，不包括子目录
+func ListPickcodesInDir(dir string) ([]PickcodeCache, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, InitDB()
+	}
+
+	prefix := escapeLike(strings.TrimRight(dir, "/")) + "/"
+	var caches []PickcodeCache
+	err := db.Where("file_path LIKE ? ESCAPE '\\' AND file_path NOT LIKE ? ESCAPE '\\'", prefix+"%", prefix+"%/%").
+		Find(&caches).Error
+	return caches, err
+}
+
 // ClearPickcodeCache 清空所有 pickcode 缓存
 func ClearPickcodeCache() error {
 	db := GetDB()
@@ -86,12 +364,110 @@ func ClearPickcodeCache() error {
 func GetPickcodeCacheStats() (int64, error) {
 	db := GetDB()
 	if db == nil {
-		if err := InitDB(); err != nil {
-			return 0, err
-		}
+		return 0, InitDB()
 	}
 
 	var count int64
 	err := db.Model(&PickcodeCache{}).Count(&count).Error
 	return count, err
 }
+
+// PickcodeCacheEntry 表示导出和导入的一条 pickcode 缓存，每行一个 JSON 对象
+type PickcodeCacheEntry struct {
+	FilePath  string    `json:"file_path"`
+	Pickcode  string    `json:"pickcode"`
+	FileID    string    `json:"file_id,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	SHA1      string    `json:"sha1,omitempty"`
+	ParentCID string    `json:"parent_cid,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// pickcodeBatchSize 导出和导入时每批处理的记录数
+const pickcodeBatchSize = 500
+
+// ExportPickcodeCache 把 pickcode 缓存以 JSON Lines 格式写入 w，prefix 不为空时只导出该目录，返回导出的数量
+func ExportPickcodeCache(w io.Writer, prefix string) (int64, error) {
+	db := GetDB()
+	if db == nil {
+		return 0, InitDB()
+	}
+
+	query := db.Model(&PickcodeCache{})
+	if prefix != "" {
+		query = query.Where("file_path LIKE ? ESCAPE '\\'", escapeLike(strings.TrimRight(prefix, "/"))+"/%")
+	}
+
+	var count int64
+	encoder := json.NewEncoder(w)
+	var caches []PickcodeCache
+	result := query.FindInBatches(&caches, pickcodeBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, cache := range caches {
+			entry := PickcodeCacheEntry{
+				FilePath:  cache.FilePath,
+				Pickcode:  cache.Pickcode,
+				FileID:    cache.FileID,
+				Size:      cache.Size,
+				SHA1:      cache.SHA1,
+				ParentCID: cache.ParentCID,
+				UpdatedAt: cache.UpdatedAt,
+			}
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, result.Error
+}
+
+// ImportPickcodeCache 从 JSON Lines 格式的 r 中导入 pickcode 缓存，空行会被跳过
+// overwrite 为 false 时保留已存在的缓存，返回写入的数量
+func ImportPickcodeCache(r io.Reader, overwrite bool) (int64, error) {
+	db := GetDB()
+	if db == nil {
+		return 0, InitDB()
+	}
+
+	var imported int64
+	batch := make([]PickcodeCacheEntry, 0, pickcodeBatchSize)
+	flush := func() error {
+		// 导入的 pickcode 没有经过确认，确认时间为空
+		written, err := upsertPickcodeEntries(db, batch, nil, overwrite)
+		imported += written
+		batch = batch[:0]
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var entry PickcodeCacheEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return imported, fmt.Errorf("第 %d 行格式错误: %w", line, err)
+		}
+		if entry.FilePath == "" || entry.Pickcode == "" {
+			return imported, fmt.Errorf("第 %d 行缺少 file_path 或 pickcode", line)
+		}
+
+		batch = append(batch, entry)
+		if len(batch) == pickcodeBatchSize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return imported, err
+	}
+
+	return imported, flush()
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListPickcodesInDir(t *testing.T) {
+	setupTestDB(t)
+
+	for path, pickcode := range map[string]string{
+		"/电影/A/a.mkv":    "pa",
+		"/电影/A/a.srt":    "ps",
+		"/电影/A/花絮/b.mkv": "pb",
+		"/电影/A_B/c.mkv":  "pc",
+		"/剧集/S01/e1.mkv": "pe",
+	} {
+		if err := SavePickcodeToCache(path, pickcode); err != nil {
+			t.Fatalf("SavePickcodeToCache 失败: %v", err)
+		}
+	}
+
+	dirs, err := ListPickcodeDirs()
+	if err != nil {
+		t.Fatalf("ListPickcodeDirs 失败: %v", err)
+	}
+	want := []string{"/剧集/S01", "/电影/A", "/电影/A/花絮", "/电影/A_B"}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("目录列表错误, 期望: %v, 实际: %v", want, dirs)
+	}
+
+	// 不包括子目录和前缀相同的其他目录
+	caches, err := ListPickcodesInDir("/电影/A/")
+	if err != nil {
+		t.Fatalf("ListPickcodesInDir 失败: %v", err)
+	}
+	if len(caches) != 2 {
+		t.Errorf("期望 2 条缓存, 实际: %d 条 %+v", len(caches), caches)
+	}
+}
+
+func TestExportImportPickcodeCache(t *testing.T) {
+	setupTestDB(t)
+
+	for path, pickcode := range map[string]string{
+		"/电影/A/a.mkv":    "pa",
+		"/电影/A/花絮/b.mkv": "pb",
+		"/剧集/S01/e1.mkv": "pe",
+	} {
+		if err := SavePickcodeToCache(path, pickcode); err != nil {
+			t.Fatalf("SavePickcodeToCache 失败: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	count, err := ExportPickcodeCache(&buf, "/电影")
+	if err != nil {
+		t.Fatalf("ExportPickcodeCache 失败: %v", err)
+	}
+	if count != 2 || strings.Count(buf.String(), "\n") != 2 {
+		t.Fatalf("期望导出 2 条, 实际: %d 条\n%s", count, buf.String())
+	}
+
+	if err := ClearPickcodeCache(); err != nil {
+		t.Fatalf("ClearPickcodeCache 失败: %v", err)
+	}
+	if err := SavePickcodeToCache("/电影/A/a.mkv", "new"); err != nil {
+		t.Fatalf("SavePickcodeToCache 失败: %v", err)
+	}
+
+	// 不覆盖时保留已存在的缓存
+	data := buf.String() + "\n"
+	imported, err := ImportPickcodeCache(strings.NewReader(data), false)
+	if err != nil {
+		t.Fatalf("ImportPickcodeCache 失败: %v", err)
+	}
+	if imported != 1 {
+		t.Errorf("期望导入 1 条, 实际: %d", imported)
+	}
+	if pickcode, _ := GetPickcodeFromCache("/电影/A/a.mkv"); pickcode != "new" {
+		t.Errorf("不覆盖时 pickcode 不应改变, 实际: %s", pickcode)
+	}
+
+	if _, err := ImportPickcodeCache(strings.NewReader(data), true); err != nil {
+		t.Fatalf("ImportPickcodeCache 失败: %v", err)
+	}
+	if pickcode, _ := GetPickcodeFromCache("/电影/A/a.mkv"); pickcode != "pa" {
+		t.Errorf("覆盖时 pickcode 应为 pa, 实际: %s", pickcode)
+	}
+
+	if _, err := ImportPickcodeCache(strings.NewReader("{\"file_path\":\"/x\"}\n"), true); err == nil {
+		t.Error("缺少 pickcode 时应返回错误")
+	}
+}
+
+func TestListUnverifiedPickcodeDirs(t *testing.T) {
+	setupTestDB(t)
+
+	// 导入的缓存没有确认时间，保存的缓存刚刚确认过
+	data := "{\"file_path\":\"/电影/A/a.mkv\",\"pickcode\":\"pa\"}\n{\"file_path\":\"/电影/B/b.mkv\",\"pickcode\":\"pb\"}\n"
+	if _, err := ImportPickcodeCache(strings.NewReader(data), true); err != nil {
+		t.Fatalf("ImportPickcodeCache 失败: %v", err)
+	}
+	if err := SavePickcodeToCache("/剧集/S01/e1.mkv", "pe"); err != nil {
+		t.Fatalf("SavePickcodeToCache 失败: %v", err)
+	}
+
+	dirs, err := ListUnverifiedPickcodeDirs(time.Hour, 10)
+	if err != nil {
+		t.Fatalf("ListUnverifiedPickcodeDirs 失败: %v", err)
+	}
+	if want := []string{"/电影/A", "/电影/B"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("期望抽取 %v, 实际: %v", want, dirs)
+	}
+
+	if err := MarkPickcodesVerified([]string{"/电影/A/a.mkv"}); err != nil {
+		t.Fatalf("MarkPickcodesVerified 失败: %v", err)
+	}
+	dirs, _ = ListUnverifiedPickcodeDirs(time.Hour, 10)
+	if want := []string{"/电影/B"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("确认后期望抽取 %v, 实际: %v", want, dirs)
+	}
+
+	// 超过时间没有确认的缓存也会被抽取
+	dirs, _ = ListUnverifiedPickcodeDirs(-time.Hour, 10)
+	if len(dirs) != 3 {
+		t.Errorf("期望抽取 3 个目录, 实际: %v", dirs)
+	}
+}
+
+func TestPickcodeCacheMetadata(t *testing.T) {
+	setupTestDB(t)
+
+	// 旧版本的缓存没有文件信息，保存目录列表后补全
+	if err := SavePickcodeToCache("/电影/A/a.mkv", "old"); err != nil {
+		t.Fatalf("SavePickcodeToCache 失败: %v", err)
+	}
+	if _, found := GetCachedDirCID("/电影/A"); found {
+		t.Error("没有目录 CID 时不应命中")
+	}
+
+	saved, err := SavePickcodeEntries([]PickcodeCacheEntry{
+		{FilePath: "/电影/A/a.mkv", Pickcode: "pa", FileID: "11", Size: 100, SHA1: "abc", ParentCID: "1"},
+		{FilePath: "/电影/B/a.mkv", Pickcode: "pb", FileID: "21", Size: 100, SHA1: "ABC", ParentCID: "2"},
+		{FilePath: "/电影/B/S01/c.mkv", Pickcode: "pc", FileID: "31", Size: 50, SHA1: "DEF", ParentCID: "3"},
+	})
+	if err != nil || saved != 3 {
+		t.Fatalf("SavePickcodeEntries 失败: %d %v", saved, err)
+	}
+
+	cache, found := GetPickcodeCache("/电影/A/a.mkv")
+	if !found || cache.Pickcode != "pa" || cache.FileID != "11" || cache.Size != 100 || cache.SHA1 != "ABC" || cache.LastVerifiedAt == nil {
+		t.Errorf("缓存记录错误: %+v", cache)
+	}
+	if cache, found := GetPickcodeCacheByPickcode("pc"); !found || cache.FilePath != "/电影/B/S01/c.mkv" {
+		t.Errorf("按 pickcode 查找错误: %+v", cache)
+	}
+	if caches, _ := FindPickcodeCachesBySHA1("abc"); len(caches) != 2 {
+		t.Errorf("按 SHA1 期望找到 2 个文件, 实际: %+v", caches)
+	}
+
+	// 子目录中文件的 CID 不是该目录的 CID
+	if cid, found := GetCachedDirCID("/电影/B"); !found || cid != "2" {
+		t.Errorf("目录 CID 期望 2, 实际: %s", cid)
+	}
+
+	duplicates, err := FindDuplicatePickcodeCaches()
+	if err != nil {
+		t.Fatalf("FindDuplicatePickcodeCaches 失败: %v", err)
+	}
+	want := []PickcodeDuplicate{{SHA1: "ABC", Size: 100, Paths: []string{"/电影/A/a.mkv", "/电影/B/a.mkv"}}}
+	if !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("期望重复文件 %+v, 实际: %+v", want, duplicates)
+	}
+}
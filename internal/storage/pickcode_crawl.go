@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 遍历状态
+const (
+	CrawlStatusRunning   = "running"
+	CrawlStatusCompleted = "completed"
+)
+
+// CrawlDir 遍历时待列出的 115 目录
+type CrawlDir struct {
+	Path string `json:"path"`
+	CID  string `json:"cid"`
+}
+
+// PickcodeCrawl 遍历 115 目录树预热 pickcode 缓存的检查点，中断后从未列出的目录继续
+type PickcodeCrawl struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Root        string     `gorm:"uniqueIndex;not null" json:"root"` // 遍历的 115 根目录
+	Status      string     `gorm:"not null" json:"status"`
+	Pending     string     `gorm:"type:text" json:"-"` // JSON 格式的待列出目录
+	PendingDirs int        `json:"pending_dirs"`
+	Dirs        int64      `json:"dirs"`  // 已列出的目录数
+	Files       int64      `json:"files"` // 已缓存的文件数
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// PendingList 解析待列出的目录
+func (c *PickcodeCrawl) PendingList() ([]CrawlDir, error) {
+	var dirs []CrawlDir
+	if c.Pending == "" {
+		return dirs, nil
+	}
+	if err := json.Unmarshal([]byte(c.Pending), &dirs); err != nil {
+		return nil, fmt.Errorf("解析遍历检查点失败: %w", err)
+	}
+	return dirs, nil
+}
+
+// GetPickcodeCrawl 获取根目录的遍历检查点，不存在时返回 nil
+func GetPickcodeCrawl(root string) (*PickcodeCrawl, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, InitDB()
+	}
+
+	var crawl PickcodeCrawl
+	err := db.Where("root = ?", root).First(&crawl).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &crawl, nil
+}
+
+// ListPickcodeCrawls 列出所有遍历检查点，按更新时间倒序
+func ListPickcodeCrawls() ([]PickcodeCrawl, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, InitDB()
+	}
+
+	var crawls []PickcodeCrawl
+	err := db.Order("updated_at DESC").Find(&crawls).Error
+	return crawls, err
+}
+
+// StartPickcodeCrawl 从根目录开始新的遍历，覆盖该根目录原有的检查点
+func StartPickcodeCrawl(root string, start CrawlDir) (*PickcodeCrawl, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, InitDB()
+	}
+
+	pending, err := json.Marshal([]CrawlDir{start})
+	if err != nil {
+		return nil, err
+	}
+
+	crawl := PickcodeCrawl{Root: root, Status: CrawlStatusRunning, Pending: string(pending), PendingDirs: 1}
+	err = db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "root"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"status":       CrawlStatusRunning,
+			"pending":      crawl.Pending,
+			"pending_dirs": 1,
+			"dirs":         0,
+			"files":        0,
+			"created_at":   time.Now(),
+			"updated_at":   time.Now(),
+			"completed_at": nil,
+		}),
+	}).Create(&crawl).Error
+	if err != nil {
+		return nil, err
+	}
+	return GetPickcodeCrawl(root)
+}
+
+// SavePickcodeCrawlProgress 在同一个事务中保存一个目录中文件的 pickcode 和新的检查点
+// 中断时缓存和检查点保持一致，继续遍历时不会漏掉目录
+func SavePickcodeCrawlProgress(crawl *PickcodeCrawl, pending []CrawlDir, entries []PickcodeCacheEntry) error {
+	db := GetDB()
+	if db == nil {
+		return InitDB()
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if _, err := upsertPickcodeEntries(tx, entries, &now, true); err != nil {
+			return err
+		}
+
+		crawl.Pending = string(data)
+		crawl.PendingDirs = len(pending)
+		crawl.Dirs++
+		crawl.Files += int64(len(entries))
+		updates := map[string]any{
+			"pending":      crawl.Pending,
+			"pending_dirs": crawl.PendingDirs,
+			"dirs":         crawl.Dirs,
+			"files":        crawl.Files,
+			"updated_at":   now,
+		}
+		if len(pending) == 0 {
+			crawl.Status = CrawlStatusCompleted
+			crawl.CompletedAt = &now
+			updates["status"] = crawl.Status
+			updates["completed_at"] = now
+		}
+		return tx.Model(&PickcodeCrawl{}).Where("id = ?", crawl.ID).Updates(updates).Error
+	})
+}
+
+// DeletePickcodeCrawl 删除根目录的遍历检查点
+func DeletePickcodeCrawl(root string) error {
+	db := GetDB()
+	if db == nil {
+		return InitDB()
+	}
+
+	return db.Where("root = ?", root).Delete(&PickcodeCrawl{}).Error
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PlaybackRecord 每个用户每个媒体项目的播放记录
+type PlaybackRecord struct {
+	ID                 uint       `gorm:"primaryKey" json:"id"`
+	UserID             string     `gorm:"not null;uniqueIndex:idx_playback_user_item" json:"user_id"`
+	ItemID             string     `gorm:"not null;uniqueIndex:idx_playback_user_item;index" json:"item_id"`
+	UserName           string     `json:"user_name"`
+	ItemName           string     `json:"item_name"`
+	ItemType           string     `json:"item_type"`
+	Client             string     `json:"client"`                      // 最近一次播放的客户端
+	DeviceName         string     `json:"device_name"`                 // 最近一次播放的设备
+	PlayCount          int        `gorm:"default:0" json:"play_count"` // 开始播放的次数
+	PositionTicks      int64      `json:"position_ticks"`              // 最近一次停止播放时的进度
+	PlayedToCompletion bool       `json:"played_to_completion"`        // 最近一次是否播放完成
+	LastStartedAt      *time.Time `json:"last_started_at,omitempty"`   // 最近一次开始播放时间
+	LastStoppedAt      *time.Time `json:"last_stopped_at,omitempty"`   // 最近一次停止播放时间
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// PlaybackEvent 一次播放开始或停止事件
+type PlaybackEvent struct {
+	UserID             string
+	UserName           string
+	ItemID             string
+	ItemName           string
+	ItemType           string
+	Client             string
+	DeviceName         string
+	PositionTicks      int64
+	PlayedToCompletion bool
+	Time               time.Time
+}
+
+// playbackRecordKey 按用户和项目定位记录，用于 upsert
+var playbackRecordKey = []clause.Column{{Name: "user_id"}, {Name: "item_id"}}
+
+// RecordPlaybackStart 记录开始播放，播放次数加一
+func RecordPlaybackStart(event PlaybackEvent) error {
+	db := GetDB()
+	if db == nil {
+		return InitDB()
+	}
+
+	if event.UserID == "" || event.ItemID == "" {
+		return fmt.Errorf("用户 ID 和项目 ID 不能为空")
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	record := newPlaybackRecord(event)
+	record.PlayCount = 1
+	record.LastStartedAt = &event.Time
+
+	return db.Clauses(clause.OnConflict{
+		Columns: playbackRecordKey,
+		DoUpdates: clause.Assignments(map[string]any{
+			"user_name":       event.UserName,
+			"item_name":       event.ItemName,
+			"item_type":       event.ItemType,
+			"client":          event.Client,
+			"device_name":     event.DeviceName,
+			"play_count":      gorm.Expr("play_count + 1"),
+			"last_started_at": event.Time,
+			"updated_at":      time.Now(),
+		}),
+	}).Create(record).Error
+}
+
+// RecordPlaybackStop 记录停止播放时的进度
+func RecordPlaybackStop(event PlaybackEvent) error {
+	db := GetDB()
+	if db == nil {
+		return InitDB()
+	}
+
+	if event.UserID == "" || event.ItemID == "" {
+		return fmt.Errorf("用户 ID 和项目 ID 不能为空")
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	record := newPlaybackRecord(event)
+	record.PositionTicks = event.PositionTicks
+	record.PlayedToCompletion = event.PlayedToCompletion
+	record.LastStoppedAt = &event.Time
+
+	return db.Clauses(clause.OnConflict{
+		Columns: playbackRecordKey,
+		DoUpdates: clause.Assignments(map[string]any{
+			"user_name":            event.UserName,
+			"item_name":            event.ItemName,
+			"item_type":            event.ItemType,
+			"client":               event.Client,
+			"device_name":          event.DeviceName,
+			"position_ticks":       event.PositionTicks,
+			"played_to_completion": event.PlayedToCompletion,
+			"last_stopped_at":      event.Time,
+			"updated_at":           time.Now(),
+		}),
+	}).Create(record).Error
+}
+
+// newPlaybackRecord 根据事件创建记录
+func newPlaybackRecord(event PlaybackEvent) *PlaybackRecord {
+	return &PlaybackRecord{
+		UserID:     event.UserID,
+		ItemID:     event.ItemID,
+		UserName:   event.UserName,
+		ItemName:   event.ItemName,
+		ItemType:   event.ItemType,
+		Client:     event.Client,
+		DeviceName: event.DeviceName,
+	}
+}
+
+// ListPlaybackRecords 按最近更新时间倒序列出播放记录，userID、itemID 为空时不过滤
+func ListPlaybackRecords(userID, itemID string, limit, offset int) ([]PlaybackRecord, int64, error) {
+	db := GetDB()
+	if db == nil {
+		return nil, 0, InitDB()
+	}
+
+	query := db.Model(&PlaybackRecord{})
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if itemID != "" {
+		query = query.Where("item_id = ?", itemID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var records []PlaybackRecord
+	err := query.Order("updated_at DESC").Limit(limit).Offset(offset).Find(&records).Error
+	return records, total, err
+}
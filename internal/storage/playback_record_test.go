@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlaybackRecord(t *testing.T) {
+	setupTestDB(t)
+
+	start := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	event := PlaybackEvent{UserID: "u1", UserName: "alice", ItemID: "i1", ItemName: "S01E01", Client: "Infuse", Time: start}
+
+	// 1. 两次开始播放，播放次数累加
+	for i := 0; i < 2; i++ {
+		if err := RecordPlaybackStart(event); err != nil {
+			t.Fatalf("RecordPlaybackStart 失败: %v", err)
+		}
+	}
+
+	// 2. 停止播放记录进度
+	stop := event
+	stop.PositionTicks = 12345
+	stop.PlayedToCompletion = true
+	stop.Time = start.Add(time.Hour)
+	if err := RecordPlaybackStop(stop); err != nil {
+		t.Fatalf("RecordPlaybackStop 失败: %v", err)
+	}
+
+	// 3. 其他用户的记录互不影响
+	other := event
+	other.UserID = "u2"
+	if err := RecordPlaybackStart(other); err != nil {
+		t.Fatalf("RecordPlaybackStart 失败: %v", err)
+	}
+
+	records, total, err := ListPlaybackRecords("u1", "i1", 10, 0)
+	if err != nil {
+		t.Fatalf("ListPlaybackRecords 失败: %v", err)
+	}
+	if total != 1 || len(records) != 1 {
+		t.Fatalf("期望 1 条记录, 实际: %d", total)
+	}
+
+	record := records[0]
+	if record.PlayCount != 2 {
+		t.Errorf("PlayCount 不匹配. 期望: 2, 实际: %d", record.PlayCount)
+	}
+	if record.PositionTicks != 12345 || !record.PlayedToCompletion {
+		t.Errorf("停止播放信息不匹配: %+v", record)
+	}
+	if record.LastStartedAt == nil || !record.LastStartedAt.Equal(start) {
+		t.Errorf("LastStartedAt 不匹配: %v", record.LastStartedAt)
+	}
+	if record.LastStoppedAt == nil || !record.LastStoppedAt.Equal(stop.Time) {
+		t.Errorf("LastStoppedAt 不匹配: %v", record.LastStoppedAt)
+	}
+
+	if _, total, _ := ListPlaybackRecords("", "i1", 10, 0); total != 2 {
+		t.Errorf("按项目过滤期望 2 条记录, 实际: %d", total)
+	}
+
+	// 4. 缺少用户 ID 时返回错误
+	if err := RecordPlaybackStart(PlaybackEvent{ItemID: "i1"}); err == nil {
+		t.Error("缺少用户 ID 时应该返回错误")
+	}
+}
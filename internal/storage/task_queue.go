@@ -3,6 +3,12 @@ package storage
 import (
 	"cinexus/internal/config"
 	"cinexus/internal/logger"
+	"cinexus/internal/notify"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -17,36 +23,116 @@ const (
 	TaskStatusProcessing TaskStatus = "processing"
 	TaskStatusCompleted  TaskStatus = "completed"
 	TaskStatusFailed     TaskStatus = "failed"
+	TaskStatusCanceled   TaskStatus = "canceled"
+)
+
+// TaskStatuses 所有任务状态
+var TaskStatuses = []TaskStatus{TaskStatusPending, TaskStatusProcessing, TaskStatusCompleted, TaskStatusFailed, TaskStatusCanceled}
+
+// TaskType 任务类型
+type TaskType string
+
+const (
+	TaskTypePlaybackInfo     TaskType = "playbackinfo"      // 获取播放信息，补充媒体信息
+	TaskTypeWarmPickcode     TaskType = "warm-pickcode"     // 预热新增媒体所在目录的 pickcode 缓存
+	TaskTypeRefreshMetadata  TaskType = "refresh-metadata"  // 刷新 Emby 元数据
+	TaskTypeCopyFile         TaskType = "copy-file"         // 文件监控复制、移动或链接文件
+	TaskTypeScheduledJob     TaskType = "scheduled-job"     // 按 cron 表达式执行的定时任务
+	TaskTypeValidatePickcode TaskType = "validate-pickcode" // 校验一个目录的 pickcode 缓存
+	TaskTypeCrawlPickcode    TaskType = "crawl-pickcode"    // 遍历 115 目录树预热 pickcode 缓存
+)
+
+// TaskPriority 任务优先级，数值越大越先执行
+type TaskPriority int
+
+const (
+	TaskPriorityLow    TaskPriority = -10 // 批量任务，如 refresh-media，只在 queue.low_priority_hours 内执行
+	TaskPriorityNormal TaskPriority = 0   // webhook、文件监控等自动添加的任务
+	TaskPriorityHigh   TaskPriority = 10  // 用户即将播放的项目，插队执行
+)
+
+// 未配置 queue 时的默认值
+const (
+	defaultMaxAttempts = 3
+	defaultBackoffBase = 30 * time.Second
+	defaultBackoffMax  = time.Hour
 )
 
 // MediaTask 媒体任务模型
 type MediaTask struct {
-	ID          uint       `gorm:"primaryKey"`
-	ItemID      string     `gorm:"not null;index"`
-	Status      TaskStatus `gorm:"default:'pending';index"`
+	ID          uint         `gorm:"primaryKey"`
+	Type        TaskType     `gorm:"default:'playbackinfo';index"`
+	Priority    TaskPriority `gorm:"default:0;index"`
+	ItemID      string       `gorm:"not null;index"` // Emby 项目 ID，与 Emby 无关的任务为用于去重的键，如文件路径
+	Payload     string       `gorm:"type:text"`      // JSON 格式的任务参数
+	Status      TaskStatus   `gorm:"default:'pending';index"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	StartedAt   *time.Time
 	CompletedAt *time.Time
 	ErrorMsg    string
-	Retries     int `gorm:"default:0"`
+	Retries     int        `gorm:"default:0"`
+	NextRunAt   *time.Time `gorm:"index"` // 失败后下一次重试的时间，为空时立即可以执行
+}
+
+// DecodePayload 把任务参数解析到 v
+func (t *MediaTask) DecodePayload(v any) error {
+	if t.Payload == "" {
+		return fmt.Errorf("任务 %d 没有参数", t.ID)
+	}
+	return json.Unmarshal([]byte(t.Payload), v)
+}
+
+// TaskHandlerFunc 任务处理函数，ctx 超时后应尽快返回
+type TaskHandlerFunc func(ctx context.Context, task *MediaTask) error
+
+// TaskHandler 一种任务类型的处理函数和重试策略
+type TaskHandler struct {
+	Handle      TaskHandlerFunc
+	MaxAttempts int           // 最多执行次数，为 0 时使用默认的 3 次，为 1 时失败后不重试
+	Timeout     time.Duration // 单次执行的超时时间，为 0 时不限制
+}
+
+// noRetryError 不需要重试的错误
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string { return e.err.Error() }
+func (e *noRetryError) Unwrap() error { return e.err }
+
+// NoRetry 标记错误不需要重试，任务会直接标记为失败，如参数错误、文件不存在
+func NoRetry(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &noRetryError{err: err}
 }
 
-// PlaybackInfoCallback 播放信息回调函数类型
-type PlaybackInfoCallback func(itemID string, cfg *config.Config) error
+// IsNoRetry 判断错误是否标记为不需要重试
+func IsNoRetry(err error) bool {
+	var noRetry *noRetryError
+	return errors.As(err, &noRetry)
+}
 
 // PersistentTaskQueue 持久化任务队列
 type PersistentTaskQueue struct {
-	db               *gorm.DB
-	cfg              *config.Config
-	log              *logger.Logger
-	stopCh           chan struct{}
-	wg               sync.WaitGroup
-	running          bool
-	mu               sync.Mutex
-	executing        bool                 // 标记是否正在执行任务（确保单线程）
-	cleanupWg        sync.WaitGroup       // 清理任务的WaitGroup
-	playbackCallback PlaybackInfoCallback // 播放信息回调函数
+	db         *gorm.DB
+	cfg        *config.Config
+	log        *logger.Logger
+	stopCh     chan struct{}
+	wg         sync.WaitGroup
+	running    bool
+	mu         sync.Mutex
+	cleanupWg  sync.WaitGroup // 清理任务的WaitGroup
+	taskWg     sync.WaitGroup // 正在执行的任务的WaitGroup
+	handlersMu sync.RWMutex
+	handlers   map[TaskType]TaskHandler // 按任务类型注册的处理函数
+
+	execMu        sync.Mutex
+	inFlight      int                    // 正在执行的任务数
+	lastStart     time.Time              // 最近一次开始执行任务的时间
+	lastTypeStart map[TaskType]time.Time // 各类型最近一次开始执行任务的时间
 }
 
 var (
@@ -54,8 +140,8 @@ var (
 	queueOnce sync.Once
 )
 
-// NewPersistentTaskQueue 创建持久化任务队列
-func NewPersistentTaskQueue(cfg *config.Config, log *logger.Logger, callback PlaybackInfoCallback) *PersistentTaskQueue {
+// NewPersistentTaskQueue 创建持久化任务队列，handlers 为各类型任务的处理函数
+func NewPersistentTaskQueue(cfg *config.Config, log *logger.Logger, handlers map[TaskType]TaskHandler) *PersistentTaskQueue {
 	queueOnce.Do(func() {
 		// 初始化数据库
 		if err := InitDB(); err != nil {
@@ -70,11 +156,14 @@ func NewPersistentTaskQueue(cfg *config.Config, log *logger.Logger, callback Pla
 		}
 
 		taskQueue = &PersistentTaskQueue{
-			db:               db,
-			cfg:              cfg,
-			log:              log,
-			stopCh:           make(chan struct{}),
-			playbackCallback: callback,
+			db:       db,
+			cfg:      cfg,
+			log:      log,
+			stopCh:   make(chan struct{}),
+			handlers: make(map[TaskType]TaskHandler, len(handlers)),
+		}
+		for taskType, handler := range handlers {
+			taskQueue.handlers[taskType] = handler
 		}
 
 		// 启动时重置处理中的任务为待处理状态
@@ -85,29 +174,110 @@ func NewPersistentTaskQueue(cfg *config.Config, log *logger.Logger, callback Pla
 	return taskQueue
 }
 
+// OpenTaskQueue 打开任务队列但不启动处理器，也不重置处理中的任务
+// 用于命令行在服务运行时查看和管理同一个数据库中的任务，任务仍由服务执行
+func OpenTaskQueue(cfg *config.Config, log *logger.Logger) (*PersistentTaskQueue, error) {
+	if err := InitDB(); err != nil {
+		return nil, fmt.Errorf("初始化数据库失败: %w", err)
+	}
+
+	return &PersistentTaskQueue{
+		db:       GetDB(),
+		cfg:      cfg,
+		log:      log,
+		stopCh:   make(chan struct{}),
+		handlers: make(map[TaskType]TaskHandler),
+	}, nil
+}
+
+// migrateMediaTasks 旧版本的任务只有获取播放信息一种，没有类型的任务迁移为 playbackinfo
+func migrateMediaTasks(db *gorm.DB) error {
+	return db.Model(&MediaTask{}).Where("type IS NULL OR type = ''").
+		Update("type", TaskTypePlaybackInfo).Error
+}
+
 // GetTaskQueue 获取任务队列单例
 func GetTaskQueue() *PersistentTaskQueue {
 	return taskQueue
 }
 
-// AddTask 添加任务
+// RegisterHandler 注册或替换一种任务类型的处理函数，用于在队列创建之后才初始化的组件
+func (q *PersistentTaskQueue) RegisterHandler(taskType TaskType, handler TaskHandler) {
+	q.handlersMu.Lock()
+	defer q.handlersMu.Unlock()
+	q.handlers[taskType] = handler
+}
+
+// handler 获取任务类型的处理函数
+func (q *PersistentTaskQueue) handler(taskType TaskType) (TaskHandler, bool) {
+	q.handlersMu.RLock()
+	defer q.handlersMu.RUnlock()
+	handler, ok := q.handlers[taskType]
+	return handler, ok && handler.Handle != nil
+}
+
+// handlerTypes 已注册处理函数的任务类型
+func (q *PersistentTaskQueue) handlerTypes() []TaskType {
+	q.handlersMu.RLock()
+	defer q.handlersMu.RUnlock()
+
+	types := make([]TaskType, 0, len(q.handlers))
+	for taskType, handler := range q.handlers {
+		if handler.Handle != nil {
+			types = append(types, taskType)
+		}
+	}
+	return types
+}
+
+// AddTask 添加获取播放信息的任务
 func (q *PersistentTaskQueue) AddTask(itemID string) error {
+	return q.AddTypedTask(TaskTypePlaybackInfo, itemID)
+}
+
+// AddTypedTask 添加指定类型的任务，同一项目同一类型已有未完成的任务时跳过
+func (q *PersistentTaskQueue) AddTypedTask(taskType TaskType, itemID string) error {
+	return q.AddTaskWithPayload(taskType, itemID, nil)
+}
+
+// AddTaskWithPayload 添加带参数的普通优先级任务
+func (q *PersistentTaskQueue) AddTaskWithPayload(taskType TaskType, itemID string, payload any) error {
+	return q.AddTaskWithPriority(taskType, itemID, payload, TaskPriorityNormal)
+}
+
+// AddTaskWithPriority 添加任务，payload 会保存为 JSON
+// 同一类型同一 itemID 已有未完成的任务时跳过，新任务的优先级更高时提高已有任务的优先级
+func (q *PersistentTaskQueue) AddTaskWithPriority(taskType TaskType, itemID string, payload any, priority TaskPriority) error {
+	var data string
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("序列化任务参数失败: %w", err)
+		}
+		data = string(raw)
+	}
+
 	// 检查是否已存在未完成的任务
 	var count int64
-	err := q.db.Model(&MediaTask{}).Where("item_id = ? AND status IN (?)",
-		itemID, []TaskStatus{TaskStatusPending, TaskStatusProcessing}).Count(&count).Error
+	err := q.db.Model(&MediaTask{}).Where("type = ? AND item_id = ? AND status IN (?)",
+		taskType, itemID, []TaskStatus{TaskStatusPending, TaskStatusProcessing}).Count(&count).Error
 	if err != nil {
 		return err
 	}
 
 	if count > 0 {
-		q.log.Infof("任务已存在，跳过添加: ItemID=%s", itemID)
+		q.log.Infof("任务已存在，跳过添加: Type=%s, ItemID=%s", taskType, itemID)
+		q.db.Model(&MediaTask{}).Where("type = ? AND item_id = ? AND status = ? AND priority < ?",
+			taskType, itemID, TaskStatusPending, priority).Update("priority", priority)
 		return nil
 	}
 
 	task := &MediaTask{
-		ItemID: itemID,
-		Status: TaskStatusPending,
+		Type:     taskType,
+		Priority: priority,
+		ItemID:   itemID,
+		Payload:  data,
+		Status:   TaskStatusPending,
 	}
 
 	if err := q.db.Create(task).Error; err != nil {
@@ -115,10 +285,88 @@ func (q *PersistentTaskQueue) AddTask(itemID string) error {
 		return err
 	}
 
-	q.log.Infof("任务已添加到队列: ItemID=%s, TaskID=%d", itemID, task.ID)
+	q.log.Infof("任务已添加到队列: Type=%s, ItemID=%s, TaskID=%d", taskType, itemID, task.ID)
 	return nil
 }
 
+// AddTasks 批量添加获取播放信息的任务，返回新增和跳过的数量
+func (q *PersistentTaskQueue) AddTasks(itemIDs []string) (added int, skipped int, err error) {
+	return q.AddTypedTasks(TaskTypePlaybackInfo, itemIDs)
+}
+
+// AddTypedTasks 批量添加指定类型的普通优先级任务，返回新增和跳过的数量
+func (q *PersistentTaskQueue) AddTypedTasks(taskType TaskType, itemIDs []string) (added int, skipped int, err error) {
+	return q.AddTypedTasksWithPriority(taskType, itemIDs, TaskPriorityNormal)
+}
+
+// taskBatchSize 批量添加任务时每批查询和插入的数量，每个任务约 12 个参数，不超过 SQLite 的参数数量限制
+const taskBatchSize = 500
+
+// AddTypedTasksWithPriority 批量添加指定类型的任务，跳过重复的 ID 和已有同类型未完成任务的项目，返回新增和跳过的数量
+func (q *PersistentTaskQueue) AddTypedTasksWithPriority(taskType TaskType, itemIDs []string, priority TaskPriority) (added int, skipped int, err error) {
+	if len(itemIDs) == 0 {
+		return 0, 0, nil
+	}
+
+	// 分批查询已有未完成任务的项目，避免超过 SQLite 的参数数量限制
+	seen := make(map[string]bool, len(itemIDs))
+	for start := 0; start < len(itemIDs); start += taskBatchSize {
+		end := min(start+taskBatchSize, len(itemIDs))
+		var existing []string
+		err = q.db.Model(&MediaTask{}).Where("type = ? AND item_id IN (?) AND status IN (?)",
+			taskType, itemIDs[start:end], []TaskStatus{TaskStatusPending, TaskStatusProcessing}).Pluck("item_id", &existing).Error
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, itemID := range existing {
+			seen[itemID] = true
+		}
+	}
+
+	tasks := make([]MediaTask, 0, len(itemIDs))
+	for _, itemID := range itemIDs {
+		if seen[itemID] {
+			skipped++
+			continue
+		}
+		seen[itemID] = true
+		tasks = append(tasks, MediaTask{Type: taskType, Priority: priority, ItemID: itemID, Status: TaskStatusPending})
+	}
+
+	if len(tasks) > 0 {
+		// 在同一个事务中分批插入，失败时不会只添加一部分
+		err := q.db.Transaction(func(tx *gorm.DB) error {
+			return tx.CreateInBatches(&tasks, taskBatchSize).Error
+		})
+		if err != nil {
+			q.log.Errorf("批量添加任务失败: %v", err)
+			return 0, skipped, err
+		}
+	}
+
+	q.log.Infof("批量添加任务完成: Type=%s, 新增 %d 个, 跳过 %d 个", taskType, len(tasks), skipped)
+	return len(tasks), skipped, nil
+}
+
+// PromoteTasks 把项目待处理任务的优先级提高到 priority，返回提高了优先级的任务数
+// 用户打开项目准备播放时调用，让这个项目的任务排到批量任务前面
+func (q *PersistentTaskQueue) PromoteTasks(itemID string, priority TaskPriority) (int64, error) {
+	result := q.db.Model(&MediaTask{}).
+		Where("item_id = ? AND status = ? AND priority < ?", itemID, TaskStatusPending, priority).
+		Updates(map[string]interface{}{
+			"priority":    priority,
+			"next_run_at": nil, // 用户正在等待，不再等待退避时间
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		q.log.Infof("⏫ 已提高 %d 个任务的优先级: ItemID=%s, Priority=%d", result.RowsAffected, itemID, priority)
+	}
+	return result.RowsAffected, nil
+}
+
 // Start 启动任务处理器
 func (q *PersistentTaskQueue) Start() {
 	q.mu.Lock()
@@ -153,18 +401,18 @@ func (q *PersistentTaskQueue) Stop() {
 	q.running = false
 	close(q.stopCh)
 
-	// 等待任务处理器和清理器都停止
+	// 等待任务处理器和清理器都停止，再等待正在执行的任务返回
 	q.wg.Wait()
 	q.cleanupWg.Wait()
+	q.taskWg.Wait()
 
 	q.log.Info("任务队列处理器已停止")
 }
 
-// worker 任务处理器
+// worker 任务处理器，每秒检查一次是否可以开始执行新的任务
 func (q *PersistentTaskQueue) worker() {
 	defer q.wg.Done()
 
-	var lastProcessTime time.Time
 	ticker := time.NewTicker(1 * time.Second) // 每1秒检查一次
 	defer ticker.Stop()
 
@@ -173,30 +421,98 @@ func (q *PersistentTaskQueue) worker() {
 		case <-q.stopCh:
 			return
 		case <-ticker.C:
-			// 检查是否距离上次处理已经过了10秒，并且没有任务正在执行
-			if time.Since(lastProcessTime) >= 10*time.Second && !q.executing {
-				if q.processNextTask() {
-					lastProcessTime = time.Now() // 更新最后处理时间
-				}
-			}
+			q.dispatch()
 		}
 	}
 }
 
-// processNextTask 处理下一个任务，返回是否成功处理了任务
-func (q *PersistentTaskQueue) processNextTask() bool {
+// dispatch 在并发数、最小间隔和各类型的间隔允许时开始执行待处理的任务
+// 只有 worker 会调用，正在执行的任务数只会在这里增加
+func (q *PersistentTaskQueue) dispatch() {
+	qc := q.queueConfig()
+	interval := time.Duration(qc.Interval) * time.Second
+
+	for {
+		q.execMu.Lock()
+		if q.inFlight >= qc.Workers || time.Since(q.lastStart) < interval {
+			q.execMu.Unlock()
+			return
+		}
+		types := q.readyTypes(qc)
+		q.execMu.Unlock()
+
+		if len(types) == 0 {
+			return
+		}
+
+		task, ok := q.claimNextTask(types, q.lowPriorityAllowed(qc, time.Now()))
+		if !ok {
+			return // 没有任务处理
+		}
+
+		now := time.Now()
+		q.execMu.Lock()
+		q.inFlight++
+		q.lastStart = now
+		if q.lastTypeStart == nil {
+			q.lastTypeStart = make(map[TaskType]time.Time)
+		}
+		q.lastTypeStart[task.Type] = now
+		q.execMu.Unlock()
+
+		// 处理任务（异步处理，不阻塞）
+		q.taskWg.Add(1)
+		go func() {
+			defer q.taskWg.Done()
+			defer func() {
+				q.execMu.Lock()
+				q.inFlight--
+				q.execMu.Unlock()
+			}()
+			q.executeTask(task)
+		}()
+	}
+}
+
+// readyTypes 已注册处理函数且没有被同类型间隔限制的任务类型，调用时需要持有 execMu
+func (q *PersistentTaskQueue) readyTypes(qc config.QueueConfig) []TaskType {
+	types := q.handlerTypes()
+	ready := types[:0]
+	for _, taskType := range types {
+		interval := time.Duration(qc.Types[string(taskType)].Interval) * time.Second
+		if interval > 0 && time.Since(q.lastTypeStart[taskType]) < interval {
+			continue
+		}
+		ready = append(ready, taskType)
+	}
+	return ready
+}
+
+// InFlight 正在执行的任务数
+func (q *PersistentTaskQueue) InFlight() int {
+	q.execMu.Lock()
+	defer q.execMu.Unlock()
+	return q.inFlight
+}
+
+// claimNextTask 按优先级获取最早的可以执行的任务并标记为处理中
+// 只获取 types 中的类型，其他类型留给注册了对应处理函数的进程，lowPriority 为 false 时不获取低优先级任务
+func (q *PersistentTaskQueue) claimNextTask(types []TaskType, lowPriority bool) (*MediaTask, bool) {
 	var task MediaTask
 
 	// 使用事务获取并更新任务状态
 	err := q.db.Transaction(func(tx *gorm.DB) error {
-		// 获取最早的待处理任务
-		if err := tx.Where("status = ?", TaskStatusPending).
-			Order("created_at ASC").First(&task).Error; err != nil {
+		now := time.Now()
+		query := tx.Where("status = ? AND type IN (?) AND (next_run_at IS NULL OR next_run_at <= ?)",
+			TaskStatusPending, types, now)
+		if !lowPriority {
+			query = query.Where("priority > ?", TaskPriorityLow)
+		}
+		if err := query.Order("priority DESC, created_at ASC").First(&task).Error; err != nil {
 			return err // 没有待处理任务
 		}
 
 		// 更新为处理中状态
-		now := time.Now()
 		return tx.Model(&task).Updates(MediaTask{
 			Status:    TaskStatusProcessing,
 			StartedAt: &now,
@@ -207,32 +523,107 @@ func (q *PersistentTaskQueue) processNextTask() bool {
 		if err != gorm.ErrRecordNotFound {
 			q.log.Errorf("获取任务失败: %v", err)
 		}
-		return false // 没有任务处理
+		return nil, false
+	}
+
+	return &task, true
+}
+
+// lowPriorityAllowed 判断当前时间是否可以执行低优先级任务，没有配置 queue.low_priority_hours 时不限制
+func (q *PersistentTaskQueue) lowPriorityAllowed(qc config.QueueConfig, now time.Time) bool {
+	if qc.LowPriorityHours == "" {
+		return true
+	}
+
+	windows, err := config.ParseTimeWindows(qc.LowPriorityHours)
+	if err != nil {
+		return true // 配置加载时已经校验过
+	}
+
+	for _, window := range windows {
+		if window.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// queueConfig 任务队列配置，未设置的值使用默认值
+func (q *PersistentTaskQueue) queueConfig() config.QueueConfig {
+	var qc config.QueueConfig
+	if q.cfg != nil {
+		qc = q.cfg.Queue
+	}
+
+	if qc.Workers <= 0 {
+		qc.Workers = 1
+	}
+	if qc.MaxAttempts <= 0 {
+		qc.MaxAttempts = defaultMaxAttempts
 	}
+	return qc
+}
 
-	// 设置执行状态
-	q.executing = true
+// maxAttempts 任务类型的最多执行次数，优先使用 queue.types 中的配置，其次是处理函数的默认值
+func (q *PersistentTaskQueue) maxAttempts(taskType TaskType, handler TaskHandler) int {
+	qc := q.queueConfig()
+	if attempts := qc.Types[string(taskType)].MaxAttempts; attempts > 0 {
+		return attempts
+	}
+	if handler.MaxAttempts > 0 {
+		return handler.MaxAttempts
+	}
+	return qc.MaxAttempts
+}
+
+// retryDelay 第 retries 次失败后重试前的等待时间
+func (q *PersistentTaskQueue) retryDelay(retries int) time.Duration {
+	qc := q.queueConfig()
+	base, max := defaultBackoffBase, defaultBackoffMax
+	if qc.BackoffBase > 0 {
+		base = time.Duration(qc.BackoffBase) * time.Second
+	}
+	if qc.BackoffMax > 0 {
+		max = time.Duration(qc.BackoffMax) * time.Second
+	}
+	return backoffDelay(retries, base, max)
+}
 
-	// 处理任务（异步处理，不阻塞）
-	go q.executeTask(&task)
+// backoffDelay 指数退避：第 n 次失败后等待 base*2^(n-1)，不超过 max，
+// 并在后一半范围内随机抖动，避免同时失败的任务同时重试
+func backoffDelay(retries int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < retries && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
 
-	return true // 成功开始处理任务
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
 }
 
 // executeTask 执行任务
 func (q *PersistentTaskQueue) executeTask(task *MediaTask) {
-	// 确保在函数退出时重置执行状态
-	defer func() {
-		q.executing = false
-	}()
-
-	q.log.Infof("🔄 开始处理媒体任务: TaskID=%d, ItemID=%s", task.ID, task.ItemID)
+	q.log.Infof("🔄 开始处理媒体任务: TaskID=%d, Type=%s, ItemID=%s", task.ID, task.Type, task.ItemID)
 
 	// 记录任务开始时间
 	startTime := time.Now()
 
-	// 调用播放信息处理函数
-	err := q.callGETPlaybackInfo(task.ItemID)
+	// 按任务类型调用处理函数
+	handler, ok := q.handler(task.Type)
+	var err error
+	if ok {
+		err = q.runHandler(handler, task)
+	} else {
+		err = NoRetry(fmt.Errorf("未注册的任务类型: %s", task.Type))
+	}
+
+	maxAttempts := q.maxAttempts(task.Type, handler)
 
 	// 计算执行时间
 	executionTime := time.Since(startTime)
@@ -242,27 +633,33 @@ func (q *PersistentTaskQueue) executeTask(task *MediaTask) {
 	if err != nil {
 		// 任务失败，增加重试次数
 		task.Retries++
-		q.log.Warnf("❌ 任务执行失败: TaskID=%d, ItemID=%s, 重试次数: %d, 错误: %v",
-			task.ID, task.ItemID, task.Retries, err)
+		q.log.Warnf("❌ 任务执行失败: TaskID=%d, Type=%s, ItemID=%s, 重试次数: %d, 错误: %v",
+			task.ID, task.Type, task.ItemID, task.Retries, err)
 
-		if task.Retries >= 3 {
-			// 超过重试次数，标记为失败
+		if task.Retries >= maxAttempts || IsNoRetry(err) {
+			// 超过重试次数或不需要重试，标记为失败
 			q.db.Model(task).Updates(MediaTask{
 				Status:      TaskStatusFailed,
 				CompletedAt: &now,
 				ErrorMsg:    err.Error(),
+				Retries:     task.Retries,
 			})
-			q.log.Errorf("💀 任务失败(超过重试次数): TaskID=%d, ItemID=%s, 总重试次数: %d, 最终错误: %v",
-				task.ID, task.ItemID, task.Retries, err)
+			q.log.Errorf("💀 任务失败: TaskID=%d, Type=%s, ItemID=%s, 总重试次数: %d, 最终错误: %v",
+				task.ID, task.Type, task.ItemID, task.Retries, err)
+			notify.Send(notify.EventTaskFailed, "媒体任务失败",
+				fmt.Sprintf("TaskID=%d, Type=%s, ItemID=%s, 执行 %d 次后仍然失败: %v", task.ID, task.Type, task.ItemID, task.Retries, err))
 		} else {
-			// 重新标记为待处理，稍后重试
+			// 重新标记为待处理，退避一段时间后重试
+			delay := q.retryDelay(task.Retries)
+			nextRunAt := now.Add(delay)
 			q.db.Model(task).Updates(MediaTask{
-				Status:   TaskStatusPending,
-				ErrorMsg: err.Error(),
-				Retries:  task.Retries,
+				Status:    TaskStatusPending,
+				ErrorMsg:  err.Error(),
+				Retries:   task.Retries,
+				NextRunAt: &nextRunAt,
 			})
-			q.log.Infof("🔄 任务将重试: TaskID=%d, ItemID=%s, 当前重试次数: %d/%d",
-				task.ID, task.ItemID, task.Retries, 3)
+			q.log.Infof("🔄 任务将在 %v 后重试: TaskID=%d, ItemID=%s, 当前重试次数: %d/%d",
+				delay.Round(time.Second), task.ID, task.ItemID, task.Retries, maxAttempts)
 		}
 	} else {
 		// 任务成功
@@ -270,34 +667,103 @@ func (q *PersistentTaskQueue) executeTask(task *MediaTask) {
 			Status:      TaskStatusCompleted,
 			CompletedAt: &now,
 		})
-		q.log.Infof("✅ 任务完成: TaskID=%d, ItemID=%s, 执行时间: %v",
-			task.ID, task.ItemID, executionTime)
+		q.log.Infof("✅ 任务完成: TaskID=%d, Type=%s, ItemID=%s, 执行时间: %v",
+			task.ID, task.Type, task.ItemID, executionTime)
 	}
 }
 
-// callGETPlaybackInfo 调用 GETPlaybackInfo（需要实现具体逻辑）
-func (q *PersistentTaskQueue) callGETPlaybackInfo(itemID string) error {
-	q.log.Infof("📺 开始处理媒体播放信息: ItemID=%s", itemID)
+// runHandler 调用处理函数，超时或 panic 时返回错误
+// 超时时取消 ctx，并等待处理函数真正返回后才返回超时错误，期间任务仍占用并发名额
+func (q *PersistentTaskQueue) runHandler(handler TaskHandler, task *MediaTask) error {
+	ctx := context.Background()
+	if handler.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, handler.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("任务处理函数 panic: %v", r)
+			}
+		}()
+		done <- handler.Handle(ctx, task)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
 
-	if q.playbackCallback != nil {
-		err := q.playbackCallback(itemID, q.cfg)
+	// 超时后处理函数可能没有响应 ctx，等它真正返回后再释放并发名额和安排重试，避免同一个任务同时执行两次
+	if q.log != nil {
+		q.log.Warnf("⏳ 任务执行超时（%v），等待处理函数返回: ID=%d, 类型=%s, ItemID=%s", handler.Timeout, task.ID, task.Type, task.ItemID)
+	}
+	<-done
+	return fmt.Errorf("任务执行超时（%v）", handler.Timeout)
+}
+
+// GetQueueStatsByType 按任务类型统计各状态的任务数量
+func (q *PersistentTaskQueue) GetQueueStatsByType() (map[TaskType]map[TaskStatus]int64, error) {
+	var rows []struct {
+		Type   TaskType
+		Status TaskStatus
+		Count  int64
+	}
+	err := q.db.Model(&MediaTask{}).Select("type, status, COUNT(*) AS count").
+		Group("type, status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[TaskType]map[TaskStatus]int64)
+	for _, row := range rows {
+		if stats[row.Type] == nil {
+			stats[row.Type] = make(map[TaskStatus]int64)
+		}
+		stats[row.Type][row.Status] = row.Count
+	}
+	return stats, nil
+}
+
+// GetTaskProgress 统计一批项目的任务进度，用于等待批量添加的任务完成
+// 未完成的任务全部计入，已结束的任务只计入 since 之后结束的，避免把以前执行过的任务算进来
+func (q *PersistentTaskQueue) GetTaskProgress(taskType TaskType, itemIDs []string, since time.Time) (map[TaskStatus]int64, error) {
+	progress := make(map[TaskStatus]int64)
+
+	// 分批查询，避免超过 SQLite 的参数数量限制
+	const batchSize = 500
+	for i := 0; i < len(itemIDs); i += batchSize {
+		end := min(i+batchSize, len(itemIDs))
+
+		var rows []struct {
+			Status TaskStatus
+			Count  int64
+		}
+		err := q.db.Model(&MediaTask{}).Select("status, COUNT(*) AS count").
+			Where("type = ? AND item_id IN (?)", taskType, itemIDs[i:end]).
+			Where("(status IN (?) OR updated_at >= ?)", []TaskStatus{TaskStatusPending, TaskStatusProcessing}, since).
+			Group("status").Scan(&rows).Error
 		if err != nil {
-			q.log.Errorf("❌ 处理媒体播放信息失败: ItemID=%s, 错误: %v", itemID, err)
-			return err
+			return nil, err
+		}
+
+		for _, row := range rows {
+			progress[row.Status] += row.Count
 		}
-		q.log.Infof("✅ 媒体播放信息处理成功: ItemID=%s", itemID)
-		return nil
 	}
 
-	q.log.Warnf("⚠️ 未设置播放信息回调函数: ItemID=%s", itemID)
-	return nil // 如果没有回调函数，返回 nil
+	return progress, nil
 }
 
 // GetQueueStatus 获取队列状态
 func (q *PersistentTaskQueue) GetQueueStatus() (map[string]int64, error) {
 	status := make(map[string]int64)
 
-	for _, s := range []TaskStatus{TaskStatusPending, TaskStatusProcessing, TaskStatusCompleted, TaskStatusFailed} {
+	for _, s := range TaskStatuses {
 		var count int64
 		if err := q.db.Model(&MediaTask{}).Where("status = ?", s).Count(&count).Error; err != nil {
 			return nil, err
@@ -308,6 +774,132 @@ func (q *PersistentTaskQueue) GetQueueStatus() (map[string]int64, error) {
 	return status, nil
 }
 
+// ListTasks 按创建时间倒序列出任务，status 为空时列出所有状态
+func (q *PersistentTaskQueue) ListTasks(status TaskStatus, limit, offset int) ([]MediaTask, int64, error) {
+	query := q.db.Model(&MediaTask{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var tasks []MediaTask
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&tasks).Error
+	return tasks, total, err
+}
+
+// GetTask 获取单个任务
+func (q *PersistentTaskQueue) GetTask(id uint) (*MediaTask, error) {
+	var task MediaTask
+	if err := q.db.First(&task, id).Error; err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// LatestTask 获取指定类型和 ItemID 最近创建的任务，不存在时返回 nil
+func (q *PersistentTaskQueue) LatestTask(taskType TaskType, itemID string) (*MediaTask, error) {
+	var tasks []MediaTask
+	err := q.db.Where("type = ? AND item_id = ?", taskType, itemID).
+		Order("created_at DESC").Limit(1).Find(&tasks).Error
+	if err != nil || len(tasks) == 0 {
+		return nil, err
+	}
+	return &tasks[0], nil
+}
+
+// RetryTask 把失败或已取消的任务重新标记为待处理，并清零重试次数
+func (q *PersistentTaskQueue) RetryTask(id uint) error {
+	result := q.db.Model(&MediaTask{}).
+		Where("id = ? AND status IN (?)", id, []TaskStatus{TaskStatusFailed, TaskStatusCanceled}).
+		Updates(map[string]interface{}{
+			"status":       TaskStatusPending,
+			"retries":      0,
+			"error_msg":    "",
+			"completed_at": nil,
+			"next_run_at":  nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("任务 %d 不存在或不是失败/已取消状态", id)
+	}
+
+	q.log.Infof("🔁 任务已重新加入队列: TaskID=%d", id)
+	return nil
+}
+
+// RetryFailedTasks 把所有失败的任务重新标记为待处理，返回重新排队的数量
+func (q *PersistentTaskQueue) RetryFailedTasks() (int64, error) {
+	result := q.db.Model(&MediaTask{}).
+		Where("status = ?", TaskStatusFailed).
+		Updates(map[string]interface{}{
+			"status":       TaskStatusPending,
+			"retries":      0,
+			"error_msg":    "",
+			"completed_at": nil,
+			"next_run_at":  nil,
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	q.log.Infof("🔁 %d 个失败的任务已重新加入队列", result.RowsAffected)
+	return result.RowsAffected, nil
+}
+
+// CancelTask 取消待处理的任务，正在执行的任务无法取消
+func (q *PersistentTaskQueue) CancelTask(id uint) error {
+	now := time.Now()
+	result := q.db.Model(&MediaTask{}).
+		Where("id = ? AND status = ?", id, TaskStatusPending).
+		Updates(MediaTask{
+			Status:      TaskStatusCanceled,
+			CompletedAt: &now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("任务 %d 不存在或不是待处理状态", id)
+	}
+
+	q.log.Infof("🚫 任务已取消: TaskID=%d", id)
+	return nil
+}
+
+// PurgeTasks 删除指定状态且更新时间早于 olderThan 的任务，不允许删除执行中的任务
+func (q *PersistentTaskQueue) PurgeTasks(status TaskStatus, olderThan time.Duration) (int64, error) {
+	if status == TaskStatusProcessing {
+		return 0, fmt.Errorf("不能删除执行中的任务")
+	}
+	if olderThan < 0 {
+		return 0, fmt.Errorf("时间长度不能为负数")
+	}
+
+	query := q.db.Where("status <> ?", TaskStatusProcessing)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if olderThan > 0 {
+		query = query.Where("updated_at < ?", time.Now().Add(-olderThan))
+	}
+
+	result := query.Delete(&MediaTask{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	q.log.Infof("🧹 清理了 %d 个任务: status=%s, olderThan=%v", result.RowsAffected, status, olderThan)
+	return result.RowsAffected, nil
+}
+
 // cleanupWorker 定期清理已完成的任务
 func (q *PersistentTaskQueue) cleanupWorker() {
 	defer q.cleanupWg.Done()
@@ -329,20 +921,21 @@ func (q *PersistentTaskQueue) cleanupWorker() {
 	}
 }
 
-// cleanupOldTasks 清理旧的已完成任务
-func (q *PersistentTaskQueue) cleanupOldTasks() {
+// cleanupOldTasks 清理旧的已完成任务，返回删除的任务数量
+func (q *PersistentTaskQueue) cleanupOldTasks() (int64, error) {
 	// 删除7天前已完成的任务
 	cutoffTime := time.Now().AddDate(0, 0, -7)
 
-	// 清理已完成的任务
-	result := q.db.Where("status = ? AND completed_at < ?", TaskStatusCompleted, cutoffTime).Delete(&MediaTask{})
+	// 清理已完成和已取消的任务
+	result := q.db.Where("status IN (?) AND completed_at < ?", []TaskStatus{TaskStatusCompleted, TaskStatusCanceled}, cutoffTime).Delete(&MediaTask{})
 	if result.Error != nil {
 		q.log.Errorf("清理已完成任务失败: %v", result.Error)
-		return
+		return 0, result.Error
 	}
+	deleted := result.RowsAffected
 
 	if result.RowsAffected > 0 {
-		q.log.Infof("清理了 %d 个已完成的任务（超过7天）", result.RowsAffected)
+		q.log.Infof("清理了 %d 个已完成或已取消的任务（超过7天）", result.RowsAffected)
 	}
 
 	// 清理30天前失败的任务
@@ -350,16 +943,19 @@ func (q *PersistentTaskQueue) cleanupOldTasks() {
 	result = q.db.Where("status = ? AND completed_at < ?", TaskStatusFailed, oldFailureCutoff).Delete(&MediaTask{})
 	if result.Error != nil {
 		q.log.Errorf("清理失败任务失败: %v", result.Error)
-		return
+		return deleted, result.Error
 	}
+	deleted += result.RowsAffected
 
 	if result.RowsAffected > 0 {
 		q.log.Infof("清理了 %d 个失败的任务（超过30天）", result.RowsAffected)
 	}
+
+	return deleted, nil
 }
 
-// ManualCleanup 手动触发清理（可用于测试或管理）
-func (q *PersistentTaskQueue) ManualCleanup() {
+// ManualCleanup 手动触发清理（可用于测试或管理），返回删除的任务数量
+func (q *PersistentTaskQueue) ManualCleanup() (int64, error) {
 	q.log.Info("手动触发任务清理")
-	q.cleanupOldTasks()
+	return q.cleanupOldTasks()
 }
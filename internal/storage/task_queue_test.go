@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cinexus/internal/config"
+	"cinexus/internal/logger"
+)
+
+func TestAddTasks(t *testing.T) {
+	setupTestDB(t)
+
+	// 不启动处理器，只测试入队
+	q := &PersistentTaskQueue{
+		db:  GetDB(),
+		log: logger.New(config.LogConfig{Level: "error", Output: "stdout"}),
+	}
+
+	if err := q.AddTask("e1"); err != nil {
+		t.Fatalf("AddTask 失败: %v", err)
+	}
+
+	// e1 已在队列中，e2 重复出现
+	added, skipped, err := q.AddTasks([]string{"e1", "e2", "e2", "e3"})
+	if err != nil {
+		t.Fatalf("AddTasks 失败: %v", err)
+	}
+	if added != 2 || skipped != 2 {
+		t.Errorf("期望新增 2 个、跳过 2 个, 实际: 新增 %d 个、跳过 %d 个", added, skipped)
+	}
+
+	// 不同类型的任务互不影响
+	added, skipped, err = q.AddTypedTasks(TaskTypeWarmPickcode, []string{"e1", "e2"})
+	if err != nil {
+		t.Fatalf("AddTypedTasks 失败: %v", err)
+	}
+	if added != 2 || skipped != 0 {
+		t.Errorf("期望新增 2 个预热任务, 实际: 新增 %d 个、跳过 %d 个", added, skipped)
+	}
+
+	status, err := q.GetQueueStatus()
+	if err != nil {
+		t.Fatalf("GetQueueStatus 失败: %v", err)
+	}
+	if status[string(TaskStatusPending)] != 5 {
+		t.Errorf("期望 5 个待处理任务, 实际: %d", status[string(TaskStatusPending)])
+	}
+
+	// 大量任务分批查询和插入，不超过 SQLite 的参数数量限制
+	itemIDs := make([]string, 5000)
+	for i := range itemIDs {
+		itemIDs[i] = fmt.Sprintf("bulk-%d", i)
+	}
+	itemIDs[0] = "e1"
+	added, skipped, err = q.AddTasks(itemIDs)
+	if err != nil {
+		t.Fatalf("批量添加大量任务失败: %v", err)
+	}
+	if added != 4999 || skipped != 1 {
+		t.Errorf("期望新增 4999 个、跳过 1 个, 实际: 新增 %d 个、跳过 %d 个", added, skipped)
+	}
+}
+
+func TestExecuteTaskRetryPolicy(t *testing.T) {
+	setupTestDB(t)
+
+	attempts := 0
+	q := &PersistentTaskQueue{
+		db:  GetDB(),
+		log: logger.New(config.LogConfig{Level: "error", Output: "stdout"}),
+		handlers: map[TaskType]TaskHandler{
+			TaskTypeCopyFile: {
+				Handle: func(ctx context.Context, task *MediaTask) error {
+					attempts++
+					var payload struct {
+						Path string `json:"path"`
+					}
+					if err := task.DecodePayload(&payload); err != nil {
+						return NoRetry(err)
+					}
+					if payload.Path == "/missing" {
+						return NoRetry(errors.New("源文件不存在"))
+					}
+					return errors.New("暂时失败")
+				},
+				MaxAttempts: 2,
+			},
+		},
+	}
+
+	if err := q.AddTaskWithPayload(TaskTypeCopyFile, "/a", map[string]string{"path": "/a"}); err != nil {
+		t.Fatalf("AddTaskWithPayload 失败: %v", err)
+	}
+	if err := q.AddTaskWithPayload(TaskTypeCopyFile, "/missing", map[string]string{"path": "/missing"}); err != nil {
+		t.Fatalf("AddTaskWithPayload 失败: %v", err)
+	}
+	// 没有注册处理函数的类型不会被获取
+	if err := q.AddTask("e1"); err != nil {
+		t.Fatalf("AddTask 失败: %v", err)
+	}
+
+	// 依次执行，直到没有可处理的任务
+	runAll := func() {
+		for {
+			task, ok := q.claimNextTask(q.handlerTypes(), true)
+			if !ok {
+				return
+			}
+			q.executeTask(task)
+		}
+	}
+	runAll()
+
+	// /a 失败后等待重试，/missing 执行 1 次后直接失败
+	if attempts != 2 {
+		t.Errorf("期望执行 2 次, 实际: %d", attempts)
+	}
+
+	var task MediaTask
+	if err := q.db.Where("item_id = ?", "/a").First(&task).Error; err != nil {
+		t.Fatalf("查询任务失败: %v", err)
+	}
+	if task.Status != TaskStatusPending || task.NextRunAt == nil || !task.NextRunAt.After(time.Now()) {
+		t.Fatalf("期望任务等待重试, 实际: %+v", task)
+	}
+
+	// 到达重试时间后再次执行，超过次数后失败
+	q.db.Model(&task).Update("next_run_at", time.Now().Add(-time.Second))
+	runAll()
+	if attempts != 3 {
+		t.Errorf("期望执行 3 次, 实际: %d", attempts)
+	}
+
+	status, err := q.GetQueueStatus()
+	if err != nil {
+		t.Fatalf("GetQueueStatus 失败: %v", err)
+	}
+	if status[string(TaskStatusFailed)] != 2 || status[string(TaskStatusPending)] != 1 {
+		t.Errorf("期望 2 个失败任务和 1 个待处理任务, 实际: %+v", status)
+	}
+}
+
+func TestClaimNextTaskPriority(t *testing.T) {
+	setupTestDB(t)
+
+	q := &PersistentTaskQueue{
+		db:  GetDB(),
+		log: logger.New(config.LogConfig{Level: "error", Output: "stdout"}),
+	}
+	types := []TaskType{TaskTypePlaybackInfo}
+
+	// 批量任务先入队
+	if _, _, err := q.AddTypedTasksWithPriority(TaskTypePlaybackInfo, []string{"b1", "b2"}, TaskPriorityLow); err != nil {
+		t.Fatalf("AddTypedTasksWithPriority 失败: %v", err)
+	}
+	if err := q.AddTask("n1"); err != nil {
+		t.Fatalf("AddTask 失败: %v", err)
+	}
+	// 用户即将播放 b2
+	if _, err := q.PromoteTasks("b2", TaskPriorityHigh); err != nil {
+		t.Fatalf("PromoteTasks 失败: %v", err)
+	}
+
+	// 不允许执行低优先级任务时跳过 b1
+	var order []string
+	for {
+		task, ok := q.claimNextTask(types, false)
+		if !ok {
+			break
+		}
+		order = append(order, task.ItemID)
+	}
+	if strings.Join(order, ",") != "b2,n1" {
+		t.Errorf("期望执行顺序为 b2,n1, 实际: %v", order)
+	}
+
+	if task, ok := q.claimNextTask(types, true); !ok || task.ItemID != "b1" {
+		t.Errorf("期望允许低优先级任务时获取 b1, 实际: %+v", task)
+	}
+}
+
+func TestLowPriorityAllowed(t *testing.T) {
+	q := &PersistentTaskQueue{}
+	qc := config.QueueConfig{LowPriorityHours: "23:00-02:00, 13:00-14:00"}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+
+	cases := map[string]bool{
+		"00:30": true,
+		"02:00": false,
+		"12:59": false,
+		"13:30": true,
+		"23:00": true,
+	}
+	for clock, want := range cases {
+		at, _ := time.Parse("15:04", clock)
+		now := day.Add(time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute)
+		if got := q.lowPriorityAllowed(qc, now); got != want {
+			t.Errorf("%s 期望 %v, 实际: %v", clock, want, got)
+		}
+	}
+
+	if !q.lowPriorityAllowed(config.QueueConfig{}, day) {
+		t.Error("未配置时段时应该不限制")
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base, max := 30*time.Second, 10*time.Minute
+
+	cases := []struct {
+		retries int
+		want    time.Duration // 抖动前的等待时间
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, max},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < 20; i++ {
+			delay := backoffDelay(c.retries, base, max)
+			if delay < c.want/2 || delay > c.want {
+				t.Fatalf("第 %d 次失败的等待时间应该在 %v 到 %v 之间, 实际: %v", c.retries, c.want/2, c.want, delay)
+			}
+		}
+	}
+}
+
+func TestRunHandlerTimeout(t *testing.T) {
+	q := &PersistentTaskQueue{}
+
+	var returned atomic.Bool
+	err := q.runHandler(TaskHandler{
+		Handle: func(ctx context.Context, task *MediaTask) error {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			returned.Store(true)
+			return nil
+		},
+		Timeout: 10 * time.Millisecond,
+	}, &MediaTask{})
+	if err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Errorf("期望超时错误, 实际: %v", err)
+	}
+	if !returned.Load() {
+		t.Error("超时后应该等待处理函数返回")
+	}
+
+	err = q.runHandler(TaskHandler{
+		Handle: func(ctx context.Context, task *MediaTask) error {
+			panic("boom")
+		},
+	}, &MediaTask{})
+	if err == nil || !strings.Contains(err.Error(), "panic") {
+		t.Errorf("期望 panic 错误, 实际: %v", err)
+	}
+}
+
+func TestDispatchSlowHandlerKeepsWorkerLimit(t *testing.T) {
+	setupTestDB(t)
+
+	var running, maxRunning, runs atomic.Int32
+	q := &PersistentTaskQueue{
+		db:  GetDB(),
+		cfg: &config.Config{Queue: config.QueueConfig{Workers: 1}},
+		log: logger.New(config.LogConfig{Level: "error", Output: "stdout"}),
+		handlers: map[TaskType]TaskHandler{
+			TaskTypePlaybackInfo: {
+				// 不响应 ctx 的慢处理函数，超时后仍会继续执行
+				Handle: func(ctx context.Context, task *MediaTask) error {
+					n := running.Add(1)
+					defer running.Add(-1)
+					if n > maxRunning.Load() {
+						maxRunning.Store(n)
+					}
+					runs.Add(1)
+					time.Sleep(100 * time.Millisecond)
+					return nil
+				},
+				Timeout: 10 * time.Millisecond,
+			},
+		},
+	}
+
+	if _, _, err := q.AddTasks([]string{"e1", "e2"}); err != nil {
+		t.Fatalf("AddTasks 失败: %v", err)
+	}
+
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		q.dispatch()
+		time.Sleep(5 * time.Millisecond)
+	}
+	q.taskWg.Wait()
+
+	if maxRunning.Load() != 1 {
+		t.Errorf("超时的处理函数返回前不应该开始新的任务, 最多同时执行: %d", maxRunning.Load())
+	}
+	if runs.Load() != 2 {
+		t.Errorf("期望 e1 和 e2 各执行 1 次, 实际执行: %d 次", runs.Load())
+	}
+
+	var pending int64
+	q.db.Model(&MediaTask{}).Where("status = ? AND next_run_at > ?", TaskStatusPending, time.Now()).Count(&pending)
+	if pending != 2 {
+		t.Errorf("期望 2 个超时的任务等待重试, 实际: %d", pending)
+	}
+}
+
+func TestRetryFailedTasksAndStats(t *testing.T) {
+	setupTestDB(t)
+
+	q, err := OpenTaskQueue(nil, logger.New(config.LogConfig{Level: "error", Output: "stdout"}))
+	if err != nil {
+		t.Fatalf("OpenTaskQueue 失败: %v", err)
+	}
+
+	GetDB().Create(&[]MediaTask{
+		{Type: TaskTypePlaybackInfo, ItemID: "e1", Status: TaskStatusFailed, Retries: 3, ErrorMsg: "boom"},
+		{Type: TaskTypePlaybackInfo, ItemID: "e2", Status: TaskStatusCompleted},
+		{Type: TaskTypeCopyFile, ItemID: "/a", Status: TaskStatusFailed},
+	})
+
+	count, err := q.RetryFailedTasks()
+	if err != nil || count != 2 {
+		t.Fatalf("期望重新排队 2 个任务, 实际: %d, 错误: %v", count, err)
+	}
+
+	stats, err := q.GetQueueStatsByType()
+	if err != nil {
+		t.Fatalf("GetQueueStatsByType 失败: %v", err)
+	}
+	if stats[TaskTypePlaybackInfo][TaskStatusPending] != 1 || stats[TaskTypePlaybackInfo][TaskStatusCompleted] != 1 ||
+		stats[TaskTypeCopyFile][TaskStatusPending] != 1 || stats[TaskTypeCopyFile][TaskStatusFailed] != 0 {
+		t.Errorf("统计结果错误: %v", stats)
+	}
+
+	task, _ := q.GetTask(1)
+	if task.Retries != 0 || task.ErrorMsg != "" {
+		t.Errorf("重试后应该清零重试次数和错误, 实际: %+v", task)
+	}
+}
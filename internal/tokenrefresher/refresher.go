@@ -2,10 +2,12 @@ package tokenrefresher
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"cinexus/internal/logger"
+	"cinexus/internal/notify"
 	"cinexus/internal/storage"
 
 	sdk115 "github.com/xhofe/115-sdk-go"
@@ -21,6 +23,8 @@ type TokenRefresher struct {
 	wg            sync.WaitGroup
 	mu            sync.RWMutex
 	isRefreshing  bool
+	lastRefreshAt time.Time // 最后一次刷新时间
+	lastErr       error     // 最后一次刷新的错误
 }
 
 // Config 刷新器配置
@@ -161,8 +165,23 @@ func (r *TokenRefresher) checkAndRefreshIfNeeded() {
 	r.refreshToken()
 }
 
+// RefreshNow 立即刷新115 token，正在刷新时返回错误
+func (r *TokenRefresher) RefreshNow() error {
+	if r.IsRefreshing() {
+		return fmt.Errorf("token 正在刷新中")
+	}
+	return r.refreshToken()
+}
+
+// Status 返回最后一次刷新的时间和错误
+func (r *TokenRefresher) Status() (lastRefreshAt time.Time, lastErr error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastRefreshAt, r.lastErr
+}
+
 // refreshToken 刷新115 token
-func (r *TokenRefresher) refreshToken() {
+func (r *TokenRefresher) refreshToken() (err error) {
 	r.mu.Lock()
 	r.isRefreshing = true
 	r.mu.Unlock()
@@ -170,6 +189,8 @@ func (r *TokenRefresher) refreshToken() {
 	defer func() {
 		r.mu.Lock()
 		r.isRefreshing = false
+		r.lastRefreshAt = time.Now()
+		r.lastErr = err
 		r.mu.Unlock()
 	}()
 
@@ -179,7 +200,7 @@ func (r *TokenRefresher) refreshToken() {
 	select {
 	case <-r.ctx.Done():
 		r.logger.Info("🔄 Token刷新被取消")
-		return
+		return r.ctx.Err()
 	default:
 	}
 
@@ -187,12 +208,13 @@ func (r *TokenRefresher) refreshToken() {
 	tokens, err := storage.ReadTokensForRefresh()
 	if err != nil {
 		r.logger.Errorf("❌ 读取当前token失败: %v", err)
-		return
+		return err
 	}
 
 	if tokens.RefreshToken == "" {
 		r.logger.Error("❌ RefreshToken为空，无法刷新")
-		return
+		notify.Send(notify.EventTokenRefreshFailed, "115open Token 刷新失败", "RefreshToken为空，请执行 cinexus login 115 登录")
+		return fmt.Errorf("RefreshToken为空，无法刷新")
 	}
 
 	// 创建115 SDK客户端
@@ -209,7 +231,7 @@ func (r *TokenRefresher) refreshToken() {
 	select {
 	case <-r.ctx.Done():
 		r.logger.Info("🔄 Token刷新在API调用前被取消")
-		return
+		return r.ctx.Err()
 	default:
 	}
 
@@ -221,25 +243,27 @@ func (r *TokenRefresher) refreshToken() {
 		// 检查是否是因为取消导致的错误
 		if r.ctx.Err() != nil {
 			r.logger.Info("🔄 Token刷新因关闭而取消")
-			return
+			return r.ctx.Err()
 		}
 		r.logger.Errorf("❌ 刷新token失败: %v", err)
-		return
+		notify.Send(notify.EventTokenRefreshFailed, "115open Token 刷新失败", fmt.Sprintf("请检查 refresh token 或执行 cinexus login 115 重新登录: %v", err))
+		return err
 	}
 
 	// 最后检查是否已被取消
 	select {
 	case <-r.ctx.Done():
 		r.logger.Info("🔄 Token刷新在保存前被取消")
-		return
+		return r.ctx.Err()
 	default:
 	}
 
 	// 保存新的tokens
 	if err := storage.UpdateTokens(newTokens.RefreshToken, newTokens.AccessToken); err != nil {
 		r.logger.Errorf("❌ 保存新token失败: %v", err)
-		return
+		return err
 	}
 
 	r.logger.Info("✅ Token刷新成功！")
+	return nil
 }